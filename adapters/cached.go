@@ -0,0 +1,504 @@
+package adapters
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem/file"
+	"io"
+	"io/fs"
+	pathpkg "path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultCacheTTL     = 5 * time.Minute
+	DefaultCacheMaxSize = 64 << 20
+	// metaCacheEntries 内置元数据缓存的最大条目数
+	metaCacheEntries = 10000
+)
+
+// CacheConfig 缓存配置
+type CacheConfig struct {
+	// TTL 文件内容的缓存时间，默认 5 分钟
+	TTL time.Duration
+	// MetaTTL Exists、Size、LastModified 的缓存时间，默认与 TTL 相同
+	MetaTTL time.Duration
+	// MaxSize 内容缓存的最大字节数，超出后淘汰最久未使用的文件，默认 64MB
+	MaxSize int64
+	// Disk 保存文件内容的磁盘，例如本地磁盘，为空时缓存在内存中，该磁盘应该只用于缓存
+	Disk contracts.FileSystem
+	// Store 保存元数据的缓存，例如 goal-web 的 redis 缓存，为空时缓存在内存中
+	Store contracts.CacheStore
+}
+
+// lruEntry 缓存条目，内容保存在缓存磁盘中时 file 为缓存文件的路径
+type lruEntry struct {
+	key     string
+	value   []byte
+	file    string
+	size    int64
+	expires time.Time
+}
+
+// lru 带过期时间的 LRU，size 为 0 的条目按 1 计算数量
+type lru struct {
+	capacity int64
+	size     int64
+	items    map[string]*list.Element
+	order    *list.List
+	// evicted 条目被移除时调用
+	evicted func(entry *lruEntry)
+}
+
+func newLru(capacity int64, evicted func(entry *lruEntry)) *lru {
+	return &lru{capacity: capacity, items: make(map[string]*list.Element), order: list.New(), evicted: evicted}
+}
+
+func (this *lru) get(key string) (*lruEntry, bool) {
+	var element, exists = this.items[key]
+	if !exists {
+		return nil, false
+	}
+	var entry = element.Value.(*lruEntry)
+	if time.Now().After(entry.expires) {
+		this.remove(element)
+		return nil, false
+	}
+	this.order.MoveToFront(element)
+	return entry, true
+}
+
+// add 添加条目，条目本身超出容量时不缓存
+func (this *lru) add(entry *lruEntry) bool {
+	if entry.size > this.capacity {
+		return false
+	}
+	if element, exists := this.items[entry.key]; exists {
+		this.remove(element)
+	}
+	this.items[entry.key] = this.order.PushFront(entry)
+	this.size += entry.size
+	for this.size > this.capacity {
+		this.remove(this.order.Back())
+	}
+	return true
+}
+
+func (this *lru) forget(key string) {
+	if element, exists := this.items[key]; exists {
+		this.remove(element)
+	}
+}
+
+// forgetPrefix 移除所有以 prefix 开头的条目
+func (this *lru) forgetPrefix(prefix string) {
+	for key, element := range this.items {
+		if strings.HasPrefix(key, prefix) {
+			this.remove(element)
+		}
+	}
+}
+
+func (this *lru) remove(element *list.Element) {
+	var entry = element.Value.(*lruEntry)
+	this.order.Remove(element)
+	delete(this.items, entry.key)
+	this.size -= entry.size
+	if this.evicted != nil {
+		this.evicted(entry)
+	}
+}
+
+// NewCached 创建带缓存的磁盘，读取的内容和元数据会被缓存，通过该磁盘写入时会清除对应的缓存
+// 其他途径修改的文件需要等待缓存过期
+func NewCached(name string, disk contracts.FileSystem, config CacheConfig) *Cached {
+	if config.TTL <= 0 {
+		config.TTL = DefaultCacheTTL
+	}
+	if config.MetaTTL <= 0 {
+		config.MetaTTL = config.TTL
+	}
+	if config.MaxSize <= 0 {
+		config.MaxSize = DefaultCacheMaxSize
+	}
+
+	var cached = &Cached{FileSystem: disk, name: name, config: config, meta: newLru(metaCacheEntries, nil)}
+	cached.contents = newLru(config.MaxSize, func(entry *lruEntry) {
+		// 持有锁时调用，缓存文件在释放锁之后由 sweep 删除
+		if entry.file != "" {
+			cached.garbage = append(cached.garbage, entry.file)
+		}
+	})
+	return cached
+}
+
+type Cached struct {
+	contracts.FileSystem
+	name   string
+	config CacheConfig
+
+	mutex    sync.Mutex
+	contents *lru
+	meta     *lru
+	// version 每次清除缓存时递增，读取期间发生了写入时不缓存读取结果
+	version int64
+	// generation 目录变更时递增，使外部缓存中的元数据全部失效
+	generation int64
+	// sequence 读取的序号，用于生成缓存文件的路径
+	sequence int64
+	// garbage 已经淘汰、等待删除的缓存文件
+	garbage []string
+}
+
+// Unwrap 获取被包装的磁盘
+func (this *Cached) Unwrap() contracts.FileSystem {
+	return this.FileSystem
+}
+
+func (this *Cached) Name() string {
+	return this.name
+}
+
+// Flush 清空所有缓存
+func (this *Cached) Flush() {
+	defer this.sweep()
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	this.contents.forgetPrefix("")
+	this.meta.forgetPrefix("")
+	this.version++
+	this.generation++
+}
+
+// cachePath 内容在缓存磁盘中的路径，使用哈希避免文件与目录同名冲突
+// 每次读取使用不同的序号，并发或者过期的读取不会覆盖、删除其他读取写入的缓存文件
+func (this *Cached) cachePath(path string, sequence int64) string {
+	var sum = md5.Sum([]byte(fmt.Sprintf("%s\x00%d", path, sequence)))
+	var key = hex.EncodeToString(sum[:])
+	return key[:2] + "/" + key[2:]
+}
+
+// sweep 删除已经淘汰的缓存文件，不能持有锁调用，避免缓存磁盘的 I/O 阻塞其他读取
+func (this *Cached) sweep() {
+	this.mutex.Lock()
+	var garbage = this.garbage
+	this.garbage = nil
+	this.mutex.Unlock()
+
+	for _, path := range garbage {
+		_ = this.config.Disk.Delete(path)
+	}
+}
+
+// key 与内置适配器一样规范化路径，a.txt、/a.txt 以及 ./a.txt 使用同一个缓存
+func (this *Cached) key(path string) string {
+	return strings.TrimPrefix(pathpkg.Clean("/"+path), "/")
+}
+
+// storeKey 元数据在外部缓存中的键
+func (this *Cached) storeKey(kind, path string) string {
+	return fmt.Sprintf("filesystem:%s:%d:%s:%s", this.name, this.generation, kind, path)
+}
+
+// remember 获取元数据，不存在时调用 provider 并缓存结果，provider 返回错误时不缓存
+func (this *Cached) remember(kind, path string, provider func() (string, error)) (string, error) {
+	path = this.key(path)
+	this.mutex.Lock()
+	var (
+		key     = this.storeKey(kind, path)
+		version = this.version
+	)
+	if this.config.Store != nil {
+		this.mutex.Unlock()
+		if value, ok := this.config.Store.Get(key).(string); ok {
+			return value, nil
+		}
+	} else {
+		var entry, exists = this.meta.get(kind + "\x00" + path)
+		this.mutex.Unlock()
+		if exists {
+			return string(entry.value), nil
+		}
+	}
+
+	var value, err = provider()
+	if err != nil {
+		return "", err
+	}
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	if version != this.version {
+		return value, nil
+	}
+	if this.config.Store != nil {
+		_ = this.config.Store.Put(key, value, this.config.MetaTTL)
+	} else {
+		this.meta.add(&lruEntry{key: kind + "\x00" + path, value: []byte(value), size: 1, expires: time.Now().Add(this.config.MetaTTL)})
+	}
+	return value, nil
+}
+
+// load 读取文件内容，优先使用缓存，缓存磁盘的读写都在释放锁之后进行
+func (this *Cached) load(path string) ([]byte, error) {
+	defer this.sweep()
+
+	var key = this.key(path)
+	this.mutex.Lock()
+	this.sequence++
+	var (
+		entry, exists = this.contents.get(key)
+		version       = this.version
+		sequence      = this.sequence
+	)
+	this.mutex.Unlock()
+	if exists {
+		if entry.file == "" {
+			return entry.value, nil
+		}
+		if contents, err := this.config.Disk.Read(entry.file); err == nil {
+			return contents, nil
+		}
+	}
+
+	var contents, err = this.FileSystem.Read(path)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(contents)) > this.config.MaxSize {
+		return contents, nil
+	}
+
+	entry = &lruEntry{key: key, size: int64(len(contents)), expires: time.Now().Add(this.config.TTL)}
+	if this.config.Disk == nil {
+		entry.value = contents
+	} else {
+		entry.file = this.cachePath(key, sequence)
+		if this.config.Disk.Put(entry.file, string(contents)) != nil {
+			return contents, nil
+		}
+	}
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+	// 读取期间发生了写入，丢弃读取结果
+	if version != this.version || !this.contents.add(entry) {
+		if entry.file != "" {
+			this.garbage = append(this.garbage, entry.file)
+		}
+	}
+	return contents, nil
+}
+
+// forget 清除元数据缓存
+func (this *Cached) forget(kind, path string) {
+	this.meta.forget(kind + "\x00" + path)
+	if this.config.Store != nil {
+		_ = this.config.Store.Forget(this.storeKey(kind, path))
+	}
+}
+
+// invalidate 清除文件的缓存，写入可能创建或者删除上级目录，所以同时清除上级目录的 Exists 缓存
+func (this *Cached) invalidate(paths ...string) {
+	defer this.sweep()
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	for _, path := range paths {
+		path = this.key(path)
+		this.contents.forget(path)
+		this.forget("size", path)
+		this.forget("modified", path)
+		this.forget("exists", path)
+		for index := strings.LastIndex(path, "/"); index > 0; index = strings.LastIndex(path[:index], "/") {
+			this.forget("exists", path[:index])
+		}
+	}
+	this.version++
+}
+
+// invalidateDirectory 清除目录下所有文件的缓存
+func (this *Cached) invalidateDirectory(directory string) {
+	defer this.sweep()
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	var prefix = this.key(directory) + "/"
+	if prefix == "/" {
+		prefix = ""
+	}
+	this.contents.forgetPrefix(prefix)
+	for _, kind := range []string{"exists", "size", "modified"} {
+		this.meta.forgetPrefix(kind + "\x00" + prefix)
+	}
+	for path := strings.TrimSuffix(prefix, "/"); path != ""; path = pathpkg.Dir(path) {
+		this.forget("exists", path)
+		if !strings.Contains(path, "/") {
+			break
+		}
+	}
+	this.version++
+	this.generation++
+}
+
+func (this *Cached) Exists(path string) bool {
+	var value, _ = this.remember("exists", path, func() (string, error) {
+		return strconv.FormatBool(this.FileSystem.Exists(path)), nil
+	})
+	return value == "true"
+}
+
+func (this *Cached) Get(path string) (string, error) {
+	var contents, err = this.load(path)
+	return string(contents), err
+}
+
+func (this *Cached) Read(path string) ([]byte, error) {
+	var contents, err = this.load(path)
+	if err != nil {
+		return nil, err
+	}
+	// 返回副本，避免调用方修改缓存
+	return append([]byte(nil), contents...), nil
+}
+
+func (this *Cached) ReadStream(path string) (*bufio.Reader, error) {
+	var contents, err = this.load(path)
+	if err != nil {
+		return nil, err
+	}
+	return bufio.NewReader(bytes.NewReader(contents)), nil
+}
+
+func (this *Cached) Open(path string) (io.ReadSeekCloser, error) {
+	return Open(this.FileSystem, path)
+}
+
+func (this *Cached) ReadRange(path string, offset, length int64) (io.ReadCloser, error) {
+	return ReadRange(this.FileSystem, path, offset, length)
+}
+
+func (this *Cached) Checksum(path string) (string, error) {
+	return Checksum(this.FileSystem, path)
+}
+
+func (this *Cached) SupportsUrls() bool {
+	return SupportsUrls(this.FileSystem)
+}
+
+func (this *Cached) Url(path string) string {
+	var url, _ = Url(this.FileSystem, path)
+	return url
+}
+
+func (this *Cached) TemporaryUrl(path string, ttl time.Duration, opts ...file.UrlOption) (string, error) {
+	return TemporaryUrl(this.FileSystem, path, ttl, opts...)
+}
+
+func (this *Cached) Size(path string) (int64, error) {
+	var value, err = this.remember("size", path, func() (string, error) {
+		var size, err = this.FileSystem.Size(path)
+		return strconv.FormatInt(size, 10), err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+func (this *Cached) LastModified(path string) (time.Time, error) {
+	var value, err = this.remember("modified", path, func() (string, error) {
+		var modTime, err = this.FileSystem.LastModified(path)
+		return modTime.Format(time.RFC3339Nano), err
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+func (this *Cached) Put(path, contents string) error {
+	defer this.invalidate(path)
+	return this.FileSystem.Put(path, contents)
+}
+
+func (this *Cached) WriteStream(path string, contents string) error {
+	defer this.invalidate(path)
+	return this.FileSystem.WriteStream(path, contents)
+}
+
+func (this *Cached) PutStream(path string, r io.Reader, opts ...file.WriteOption) (int64, error) {
+	defer this.invalidate(path)
+	return PutStream(this.FileSystem, path, r, opts...)
+}
+
+func (this *Cached) SetVisibility(path string, perm fs.FileMode) error {
+	defer this.invalidate(path)
+	return this.FileSystem.SetVisibility(path, perm)
+}
+
+func (this *Cached) Touch(path string, modTime time.Time) error {
+	defer this.invalidate(path)
+	return Touch(this.FileSystem, path, modTime)
+}
+
+func (this *Cached) Prepend(path, contents string) error {
+	defer this.invalidate(path)
+	return this.FileSystem.Prepend(path, contents)
+}
+
+func (this *Cached) Append(path, contents string) error {
+	defer this.invalidate(path)
+	return this.FileSystem.Append(path, contents)
+}
+
+func (this *Cached) Delete(path string) error {
+	defer this.invalidate(path)
+	return this.FileSystem.Delete(path)
+}
+
+func (this *Cached) Copy(from, to string) error {
+	defer this.invalidate(to)
+	return this.FileSystem.Copy(from, to)
+}
+
+// Move 移动文件或者目录，同时清除两个路径下所有文件的缓存
+func (this *Cached) Move(from, to string) error {
+	defer this.invalidateDirectory(to)
+	defer this.invalidateDirectory(from)
+	defer this.invalidate(from, to)
+	return this.FileSystem.Move(from, to)
+}
+
+func (this *Cached) files(files []contracts.File) []contracts.File {
+	return wrapFiles(this.name, files, func(path string) (string, bool) {
+		return path, true
+	})
+}
+
+func (this *Cached) Files(directory string) []contracts.File {
+	return this.files(this.FileSystem.Files(directory))
+}
+
+func (this *Cached) AllFiles(directory string) []contracts.File {
+	return this.files(this.FileSystem.AllFiles(directory))
+}
+
+func (this *Cached) MakeDirectory(path string) error {
+	defer this.invalidateDirectory(path)
+	return this.FileSystem.MakeDirectory(path)
+}
+
+func (this *Cached) DeleteDirectory(directory string) error {
+	defer this.invalidateDirectory(directory)
+	return this.FileSystem.DeleteDirectory(directory)
+}
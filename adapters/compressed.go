@@ -0,0 +1,571 @@
+package adapters
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem/file"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"io/ioutil"
+	pathpkg "path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 压缩文件格式：文件头 | 压缩后的内容 | 文件尾
+// 文件头：magic(4) | 算法名称长度(1) | 算法名称，读取时根据文件头选择算法，修改配置不影响已有文件
+// 文件尾：原始大小(8) | magic(4)，获取原始大小时只需要读取文件尾
+const (
+	compressedMagic       = "GFZ\x01"
+	compressedTrailerSize = 8 + len(compressedMagic)
+)
+
+var (
+	UnknownCompressorErr  = errors.New("unknown compression algorithm")
+	CompressionCorruptErr = errors.New("compressed file is corrupt")
+
+	// DefaultSkipExtensions 默认不压缩的扩展名，这些格式本身已经压缩过
+	DefaultSkipExtensions = []string{
+		".gz", ".tgz", ".zip", ".zst", ".bz2", ".xz", ".7z", ".rar", ".br", ".lz4",
+		".jpg", ".jpeg", ".png", ".gif", ".webp", ".avif", ".heic",
+		".mp3", ".aac", ".ogg", ".mp4", ".mov", ".webm", ".mkv",
+		".pdf", ".docx", ".xlsx", ".pptx", ".woff", ".woff2",
+	}
+)
+
+// Compressor 压缩算法，level 为 0 时使用算法的默认级别
+type Compressor struct {
+	NewWriter func(w io.Writer, level int) (io.WriteCloser, error)
+	NewReader func(r io.Reader) (io.ReadCloser, error)
+}
+
+var (
+	compressorsMutex sync.RWMutex
+	compressors      = map[string]Compressor{
+		"gzip": {
+			NewWriter: func(w io.Writer, level int) (io.WriteCloser, error) {
+				if level == 0 {
+					level = gzip.DefaultCompression
+				}
+				return gzip.NewWriterLevel(w, level)
+			},
+			NewReader: func(r io.Reader) (io.ReadCloser, error) {
+				var reader, err = gzip.NewReader(r)
+				if err != nil {
+					return nil, err
+				}
+				// 只读取一个 gzip 成员，后面是文件尾
+				reader.Multistream(false)
+				return reader, nil
+			},
+		},
+		"zstd": {
+			NewWriter: func(w io.Writer, level int) (io.WriteCloser, error) {
+				if level == 0 {
+					return zstd.NewWriter(w)
+				}
+				return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+			},
+			NewReader: func(r io.Reader) (io.ReadCloser, error) {
+				// 逐个文件流式读取，不需要并发解码
+				var reader, err = zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+				if err != nil {
+					return nil, err
+				}
+				return reader.IOReadCloser(), nil
+			},
+		},
+		"flate": {
+			NewWriter: func(w io.Writer, level int) (io.WriteCloser, error) {
+				if level == 0 {
+					level = flate.DefaultCompression
+				}
+				return flate.NewWriter(w, level)
+			},
+			NewReader: func(r io.Reader) (io.ReadCloser, error) {
+				return flate.NewReader(r), nil
+			},
+		},
+	}
+)
+
+// RegisterCompressor 注册压缩算法，同名时替换内置的算法
+func RegisterCompressor(name string, compressor Compressor) {
+	compressorsMutex.Lock()
+	defer compressorsMutex.Unlock()
+
+	compressors[name] = compressor
+}
+
+func getCompressor(name string) (Compressor, error) {
+	compressorsMutex.RLock()
+	defer compressorsMutex.RUnlock()
+
+	var compressor, exists = compressors[name]
+	if !exists {
+		return Compressor{}, fmt.Errorf("%w: [%s]", UnknownCompressorErr, name)
+	}
+	return compressor, nil
+}
+
+// CompressionConfig 压缩配置
+type CompressionConfig struct {
+	// Algorithm 写入时使用的算法，默认 gzip，内置 gzip、zstd 和 flate，其他算法需要先调用 RegisterCompressor
+	Algorithm string
+	// Level 压缩级别，为 0 时使用算法的默认级别
+	Level int
+	// Skip 不压缩的扩展名，为 nil 时使用 DefaultSkipExtensions
+	Skip []string
+}
+
+// NewCompressed 创建压缩磁盘，写入时压缩，读取时解压，Size 返回原始大小，StoredSize 返回实际占用的大小
+// 读取时根据文件头判断是否压缩过，所以磁盘中已有的未压缩文件也可以正常读取
+func NewCompressed(name string, disk contracts.FileSystem, config CompressionConfig) (*Compressed, error) {
+	if config.Algorithm == "" {
+		config.Algorithm = "gzip"
+	}
+	if config.Skip == nil {
+		config.Skip = DefaultSkipExtensions
+	}
+	var compressor, err = getCompressor(config.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	var skip = make(map[string]bool, len(config.Skip))
+	for _, extension := range config.Skip {
+		skip[strings.ToLower("."+strings.TrimPrefix(extension, "."))] = true
+	}
+	return &Compressed{FileSystem: disk, name: name, config: config, compressor: compressor, skip: skip}, nil
+}
+
+type Compressed struct {
+	contracts.FileSystem
+	name       string
+	config     CompressionConfig
+	compressor Compressor
+	skip       map[string]bool
+}
+
+// Unwrap 获取被包装的磁盘
+func (this *Compressed) Unwrap() contracts.FileSystem {
+	return this.FileSystem
+}
+
+func (this *Compressed) Name() string {
+	return this.name
+}
+
+func (this *Compressed) error(op, path string, err error) error {
+	var wrapped *file.Error
+	if err == nil || errors.As(err, &wrapped) {
+		return err
+	}
+	return file.NewError(op, this.name, path, file.Kind(err), err)
+}
+
+// Skipped 判断路径是否不需要压缩
+func (this *Compressed) Skipped(path string) bool {
+	return this.skip[strings.ToLower(pathpkg.Ext(path))]
+}
+
+// compress 将 r 中的内容压缩后写入 w
+func (this *Compressed) compress(w io.Writer, r io.Reader) error {
+	var header = append([]byte(compressedMagic), byte(len(this.config.Algorithm)))
+	if _, err := w.Write(append(header, this.config.Algorithm...)); err != nil {
+		return err
+	}
+	var writer, err = this.compressor.NewWriter(w, this.config.Level)
+	if err != nil {
+		return err
+	}
+	var counter = &countingReader{Reader: r}
+	if _, err = io.Copy(writer, counter); err != nil {
+		return err
+	}
+	if err = writer.Close(); err != nil {
+		return err
+	}
+
+	var trailer = binary.BigEndian.AppendUint64(nil, uint64(counter.count))
+	_, err = w.Write(append(trailer, compressedMagic...))
+	return err
+}
+
+func (this *Compressed) PutStream(path string, r io.Reader, opts ...file.WriteOption) (int64, error) {
+	if this.Skipped(path) {
+		return PutStream(this.FileSystem, path, r, opts...)
+	}
+
+	var (
+		reader, writer = io.Pipe()
+		counter        = &countingReader{Reader: r}
+		done           = make(chan struct{})
+	)
+	go func() {
+		defer close(done)
+		_ = writer.CloseWithError(this.compress(writer, counter))
+	}()
+	var _, err = PutStream(this.FileSystem, path, reader, opts...)
+	// 写入失败时结束压缩协程
+	_ = reader.CloseWithError(io.ErrClosedPipe)
+	<-done
+	if err != nil {
+		return 0, this.error("write", path, err)
+	}
+	return counter.count, nil
+}
+
+func (this *Compressed) Put(path, contents string) error {
+	var _, err = this.PutStream(path, strings.NewReader(contents))
+	return err
+}
+
+func (this *Compressed) WriteStream(path string, contents string) error {
+	return this.Put(path, contents)
+}
+
+// trailerReader 读取时保留最后 compressedTrailerSize 个字节，读取结束后可以从 trailer 中获取文件尾
+type trailerReader struct {
+	src     *bufio.Reader
+	trailer []byte
+}
+
+func (this *trailerReader) Read(p []byte) (int, error) {
+	if this.trailer != nil {
+		return 0, io.EOF
+	}
+	if max := this.src.Size() - compressedTrailerSize; len(p) > max {
+		p = p[:max]
+	}
+	var data, err = this.src.Peek(len(p) + compressedTrailerSize)
+	if len(data) > compressedTrailerSize {
+		var n = copy(p, data[:len(data)-compressedTrailerSize])
+		_, _ = this.src.Discard(n)
+		return n, nil
+	}
+	if err == io.EOF {
+		if len(data) < compressedTrailerSize {
+			return 0, CompressionCorruptErr
+		}
+		this.trailer = append([]byte(nil), data...)
+		return 0, io.EOF
+	}
+	return 0, err
+}
+
+// decompressReader 解压内容，读取结束时校验原始大小
+type decompressReader struct {
+	reader  io.ReadCloser
+	trailer *trailerReader
+	source  io.Closer
+	count   int64
+}
+
+func (this *decompressReader) Read(p []byte) (int, error) {
+	var n, err = this.reader.Read(p)
+	this.count += int64(n)
+	if err == io.EOF {
+		if _, err = io.Copy(ioutil.Discard, this.trailer); err != nil {
+			return n, err
+		}
+		if this.trailer.trailer == nil || string(this.trailer.trailer[8:]) != compressedMagic ||
+			int64(binary.BigEndian.Uint64(this.trailer.trailer)) != this.count {
+			return n, CompressionCorruptErr
+		}
+		return n, io.EOF
+	}
+	if err != nil && !errors.Is(err, CompressionCorruptErr) {
+		// 解压算法的错误统一视为文件损坏，传输错误保持原样
+		var corrupt = errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, gzip.ErrHeader) || errors.Is(err, gzip.ErrChecksum)
+		var flateErr flate.CorruptInputError
+		if corrupt || errors.As(err, &flateErr) {
+			err = fmt.Errorf("%w: %v", CompressionCorruptErr, err)
+		}
+	}
+	return n, err
+}
+
+func (this *decompressReader) Close() error {
+	_ = this.reader.Close()
+	return this.source.Close()
+}
+
+// stream 打开解压后的读取流，文件没有压缩时返回原始内容
+func (this *Compressed) stream(op, path string) (io.ReadCloser, error) {
+	var source, err = ReadRange(this.FileSystem, path, 0, -1)
+	if err != nil {
+		return nil, this.error(op, path, err)
+	}
+
+	var buffered = bufio.NewReaderSize(source, 64<<10)
+	var header, _ = buffered.Peek(len(compressedMagic) + 1)
+	if len(header) <= len(compressedMagic) || string(header[:len(compressedMagic)]) != compressedMagic {
+		return limitedReadCloser{Reader: buffered, Closer: source}, nil
+	}
+
+	var compressor Compressor
+	name, err := buffered.Peek(len(header) + int(header[len(compressedMagic)]))
+	if err == nil {
+		compressor, err = getCompressor(string(name[len(header):]))
+	}
+	if err == nil {
+		_, err = buffered.Discard(len(name))
+	}
+
+	var trailer = &trailerReader{src: buffered}
+	var reader io.ReadCloser
+	if err == nil {
+		reader, err = compressor.NewReader(trailer)
+	}
+	if err != nil {
+		_ = source.Close()
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, gzip.ErrHeader) {
+			err = fmt.Errorf("%w: %v", CompressionCorruptErr, err)
+		}
+		return nil, this.error(op, path, err)
+	}
+	return &decompressReader{reader: reader, trailer: trailer, source: source}, nil
+}
+
+// compressedHandle 解压后的读取句柄，向后定位时丢弃中间的内容，向前定位时重新打开
+type compressedHandle struct {
+	disk   *Compressed
+	path   string
+	offset int64
+	reader io.ReadCloser
+}
+
+func (this *compressedHandle) Read(p []byte) (int, error) {
+	if this.reader == nil {
+		var reader, err = this.disk.stream("read", this.path)
+		if err != nil {
+			return 0, err
+		}
+		this.reader = reader
+		if _, err = io.CopyN(ioutil.Discard, reader, this.offset); err == io.EOF {
+			return 0, io.EOF
+		} else if err != nil {
+			return 0, this.disk.error("read", this.path, err)
+		}
+	}
+
+	var n, err = this.reader.Read(p)
+	this.offset += int64(n)
+	if err != nil && err != io.EOF {
+		err = this.disk.error("read", this.path, err)
+	}
+	return n, err
+}
+
+func (this *compressedHandle) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += this.offset
+	case io.SeekEnd:
+		var size, err = this.disk.Size(this.path)
+		if err != nil {
+			return 0, err
+		}
+		offset += size
+	default:
+		return 0, this.disk.error("seek", this.path, InvalidSeekErr)
+	}
+	if offset < 0 {
+		return 0, this.disk.error("seek", this.path, file.ErrInvalidRange)
+	}
+	if offset > this.offset && this.reader != nil {
+		if _, err := io.CopyN(ioutil.Discard, this, offset-this.offset); err != nil && err != io.EOF {
+			return 0, err
+		}
+	}
+	if offset != this.offset {
+		_ = this.Close()
+		this.offset = offset
+	}
+	return offset, nil
+}
+
+func (this *compressedHandle) Close() error {
+	var err error
+	if this.reader != nil {
+		err = this.reader.Close()
+		this.reader = nil
+	}
+	return err
+}
+
+func (this *Compressed) Open(path string) (io.ReadSeekCloser, error) {
+	var reader, err = this.stream("open", path)
+	if err != nil {
+		return nil, err
+	}
+	return &compressedHandle{disk: this, path: path, reader: reader}, nil
+}
+
+func (this *Compressed) ReadRange(path string, offset, length int64) (io.ReadCloser, error) {
+	var size, err = this.Size(path)
+	if err == nil {
+		length, err = rangeLength(size, offset, length)
+	}
+	if err != nil {
+		return nil, this.error("read", path, err)
+	}
+
+	handle, err := this.Open(path)
+	if err == nil {
+		_, err = handle.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return limitedReadCloser{Reader: io.LimitReader(handle, length), Closer: handle}, nil
+}
+
+func (this *Compressed) Read(path string) ([]byte, error) {
+	var reader, err = this.stream("read", path)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	contents, err := ioutil.ReadAll(reader)
+	if err != nil {
+		return nil, this.error("read", path, err)
+	}
+	return contents, nil
+}
+
+func (this *Compressed) Get(path string) (string, error) {
+	var contents, err = this.Read(path)
+	return string(contents), err
+}
+
+func (this *Compressed) ReadStream(path string) (*bufio.Reader, error) {
+	return ReadStream(this, path)
+}
+
+// StoredSize 获取文件实际占用的大小
+func (this *Compressed) StoredSize(path string) (int64, error) {
+	return this.FileSystem.Size(path)
+}
+
+// Size 获取原始大小，压缩过的文件从文件尾读取，不需要解压
+// 文件头和文件尾的 magic 都匹配时才视为压缩过的文件，未压缩的文件恰好以 magic 结尾时返回实际大小
+func (this *Compressed) Size(path string) (int64, error) {
+	var size, err = this.FileSystem.Size(path)
+	if err != nil || size < int64(len(compressedMagic)+1+compressedTrailerSize) {
+		return size, err
+	}
+
+	trailer, err := this.readAt(path, size-int64(compressedTrailerSize), compressedTrailerSize)
+	if err != nil {
+		return 0, this.error("size", path, err)
+	}
+	if string(trailer[8:]) != compressedMagic {
+		return size, nil
+	}
+	magic, err := this.readAt(path, 0, len(compressedMagic))
+	if err != nil {
+		return 0, this.error("size", path, err)
+	}
+	if string(magic) != compressedMagic {
+		return size, nil
+	}
+	return int64(binary.BigEndian.Uint64(trailer)), nil
+}
+
+// readAt 读取被包装磁盘中文件从 offset 开始的 length 个字节
+func (this *Compressed) readAt(path string, offset int64, length int) ([]byte, error) {
+	var reader, err = ReadRange(this.FileSystem, path, offset, int64(length))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var data = make([]byte, length)
+	if _, err = io.ReadFull(reader, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// modify 读取原有内容后整体重新压缩写入，文件不存在时视为空文件
+func (this *Compressed) modify(path string, modify func(original []byte) []byte) error {
+	var original, err = this.Read(path)
+	if err != nil && !errors.Is(err, file.ErrNotFound) {
+		return err
+	}
+	_, err = this.PutStream(path, bytes.NewReader(modify(original)))
+	return err
+}
+
+func (this *Compressed) Prepend(path, contents string) error {
+	return this.modify(path, func(original []byte) []byte {
+		return append([]byte(contents), original...)
+	})
+}
+
+func (this *Compressed) Append(path, contents string) error {
+	return this.modify(path, func(original []byte) []byte {
+		return append(original, contents...)
+	})
+}
+
+func (this *Compressed) Touch(path string, modTime time.Time) error {
+	return Touch(this.FileSystem, path, modTime)
+}
+
+// files 将文件大小转换为原始大小，读取时解压
+func (this *Compressed) files(files []contracts.File) []contracts.File {
+	var results = wrapFiles(this.name, files, func(path string) (string, bool) {
+		return path, true
+	})
+	for i, item := range results {
+		results[i] = &CompressedFile{ScopedFile: item.(*ScopedFile), disk: this}
+	}
+	return results
+}
+
+func (this *Compressed) Files(directory string) []contracts.File {
+	return this.files(this.FileSystem.Files(directory))
+}
+
+func (this *Compressed) AllFiles(directory string) []contracts.File {
+	return this.files(this.FileSystem.AllFiles(directory))
+}
+
+// CompressedFile 压缩磁盘中的文件，Size 为原始大小，StoredSize 为实际占用的大小
+type CompressedFile struct {
+	*ScopedFile
+	disk *Compressed
+}
+
+func (this *CompressedFile) Size() int64 {
+	var size, err = this.disk.Size(this.Path())
+	if err != nil {
+		return this.ScopedFile.Size()
+	}
+	return size
+}
+
+func (this *CompressedFile) StoredSize() int64 {
+	return this.ScopedFile.Size()
+}
+
+func (this *CompressedFile) Read() []byte {
+	var contents, _ = this.disk.Read(this.Path())
+	return contents
+}
+
+func (this *CompressedFile) ReadString() string {
+	return string(this.Read())
+}
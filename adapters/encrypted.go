@@ -0,0 +1,636 @@
+package adapters
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem/file"
+	"github.com/goal-web/supports/logs"
+	"io"
+	"io/ioutil"
+	pathpkg "path"
+	"strings"
+	"time"
+)
+
+// 加密文件格式：文件头之后是若干个加密块，每块最多 encryptedChunkSize 字节明文，加上 GCM 的认证标签
+// 文件头：magic(4) | 密钥 ID 长度(1) | 密钥 ID，不足 32 字节补零(32) | 随机盐(32) | nonce 前缀(7)
+// 每个文件使用 HKDF-SHA256 从主密钥和随机盐派生的密钥加密，nonce 只需要在同一个文件内不重复
+// 每块的 nonce 为 nonce 前缀 | 块序号(4) | 是否最后一块(1)，文件头以及路径作为附加数据参与认证，可以发现块被替换、重排、截断或者文件被移动
+const (
+	encryptedMagic      = "GFE\x01"
+	encryptedKeyIdSize  = 32
+	encryptedSaltSize   = 32
+	encryptedPrefixSize = 7
+	encryptedHeaderSize = len(encryptedMagic) + 1 + encryptedKeyIdSize + encryptedSaltSize + encryptedPrefixSize
+	encryptedKeyInfo    = "goal-web/filesystem encrypted file"
+	encryptedChunkSize  = 64 << 10
+	encryptedTagSize    = 16
+	encryptedBlockSize  = encryptedChunkSize + encryptedTagSize
+)
+
+var (
+	EncryptionKeyErr     = errors.New("unknown encryption key")
+	EncryptionCorruptErr = errors.New("encrypted file is corrupt or has been tampered with")
+	NotEncryptedErr      = errors.New("file is not encrypted")
+)
+
+// EncryptionConfig 加密配置
+type EncryptionConfig struct {
+	// Keys 密钥 ID 到密钥的映射，密钥长度为 16、24 或者 32 字节，ID 不能超过 32 字节
+	Keys map[string][]byte
+	// KeyId 写入时使用的密钥，轮换密钥时添加新密钥并修改 KeyId，旧密钥保留用于读取，然后调用 Rekey
+	KeyId string
+}
+
+// NewEncrypted 创建客户端加密磁盘，内容使用 AES-GCM 分块加密后写入 disk，读取时解密
+// 被包装的磁盘只能看到密文，文件名、目录结构以及大致的文件大小不会被加密
+func NewEncrypted(name string, disk contracts.FileSystem, config EncryptionConfig) (*Encrypted, error) {
+	var keys = make(map[string][]byte, len(config.Keys))
+	for id, key := range config.Keys {
+		if id == "" || len(id) > encryptedKeyIdSize {
+			return nil, fmt.Errorf("%w: invalid key id [%s]", EncryptionKeyErr, id)
+		}
+		if _, err := aes.NewCipher(key); err != nil {
+			return nil, fmt.Errorf("%w: key [%s]: %v", EncryptionKeyErr, id, err)
+		}
+		keys[id] = append([]byte(nil), key...)
+	}
+	if _, exists := keys[config.KeyId]; !exists {
+		return nil, fmt.Errorf("%w: [%s]", EncryptionKeyErr, config.KeyId)
+	}
+	return &Encrypted{FileSystem: disk, name: name, keyId: config.KeyId, keys: keys}, nil
+}
+
+type Encrypted struct {
+	contracts.FileSystem
+	name  string
+	keyId string
+	keys  map[string][]byte
+}
+
+// encryptionHeader 解析后的文件头，aad 为文件头加上路径
+type encryptionHeader struct {
+	keyId string
+	raw   []byte
+	aad   []byte
+	aead  cipher.AEAD
+}
+
+// deriveKey 使用 HKDF-SHA256 从主密钥和随机盐派生文件密钥，长度与主密钥相同
+func deriveKey(key, salt []byte) []byte {
+	var extract = hmac.New(sha256.New, salt)
+	extract.Write(key)
+
+	var (
+		expand  = hmac.New(sha256.New, extract.Sum(nil))
+		derived []byte
+		block   []byte
+	)
+	for counter := byte(1); len(derived) < len(key); counter++ {
+		expand.Reset()
+		expand.Write(block)
+		expand.Write([]byte(encryptedKeyInfo))
+		expand.Write([]byte{counter})
+		block = expand.Sum(nil)
+		derived = append(derived, block...)
+	}
+	return derived[:len(key)]
+}
+
+// header 根据文件头中的密钥 ID 和随机盐创建加密块使用的 AEAD
+func (this *Encrypted) header(keyId string, raw []byte, path string) (*encryptionHeader, error) {
+	var salt = raw[len(encryptedMagic)+1+encryptedKeyIdSize : encryptedHeaderSize-encryptedPrefixSize]
+	var block, err = aes.NewCipher(deriveKey(this.keys[keyId], salt))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	var aad = append(append(make([]byte, 0, len(raw)+len(path)), raw...), this.key(path)...)
+	return &encryptionHeader{keyId: keyId, raw: raw, aad: aad, aead: aead}, nil
+}
+
+// nonce 第 index 块的 nonce
+func (this *encryptionHeader) nonce(index uint32, final bool) []byte {
+	var nonce = make([]byte, 0, 12)
+	nonce = append(nonce, this.raw[encryptedHeaderSize-encryptedPrefixSize:]...)
+	nonce = binary.BigEndian.AppendUint32(nonce, index)
+	if final {
+		return append(nonce, 1)
+	}
+	return append(nonce, 0)
+}
+
+// Unwrap 获取被包装的磁盘
+func (this *Encrypted) Unwrap() contracts.FileSystem {
+	return this.FileSystem
+}
+
+func (this *Encrypted) Name() string {
+	return this.name
+}
+
+// key 与内置适配器一样规范化路径，a.txt 与 /a.txt 使用相同的附加数据
+func (this *Encrypted) key(path string) string {
+	return strings.TrimPrefix(pathpkg.Clean("/"+path), "/")
+}
+
+func (this *Encrypted) error(op, path string, err error) error {
+	var wrapped *file.Error
+	if err == nil || errors.As(err, &wrapped) {
+		return err
+	}
+	return file.NewError(op, this.name, path, file.Kind(err), err)
+}
+
+// newHeader 使用当前密钥以及新的随机盐和 nonce 前缀为 path 创建文件头
+func (this *Encrypted) newHeader(path string) (*encryptionHeader, error) {
+	var raw = make([]byte, encryptedHeaderSize)
+	copy(raw, encryptedMagic)
+	raw[len(encryptedMagic)] = byte(len(this.keyId))
+	copy(raw[len(encryptedMagic)+1:], this.keyId)
+	if _, err := rand.Read(raw[len(encryptedMagic)+1+encryptedKeyIdSize:]); err != nil {
+		return nil, err
+	}
+	return this.header(this.keyId, raw, path)
+}
+
+// parseHeader 解析 path 的文件头，不是加密文件时返回 NotEncryptedErr
+func (this *Encrypted) parseHeader(raw []byte, path string) (*encryptionHeader, error) {
+	if len(raw) < encryptedHeaderSize || string(raw[:len(encryptedMagic)]) != encryptedMagic {
+		return nil, NotEncryptedErr
+	}
+	var length = int(raw[len(encryptedMagic)])
+	if length == 0 || length > encryptedKeyIdSize {
+		return nil, EncryptionCorruptErr
+	}
+	var keyId = string(raw[len(encryptedMagic)+1 : len(encryptedMagic)+1+length])
+	if _, exists := this.keys[keyId]; !exists {
+		return nil, fmt.Errorf("%w: [%s]", EncryptionKeyErr, keyId)
+	}
+	return this.header(keyId, raw[:encryptedHeaderSize], path)
+}
+
+// readHeader 从 r 中读取 path 的文件头
+func (this *Encrypted) readHeader(r io.Reader, path string) (*encryptionHeader, error) {
+	var raw = make([]byte, encryptedHeaderSize)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, NotEncryptedErr
+		}
+		return nil, err
+	}
+	return this.parseHeader(raw, path)
+}
+
+// plainSize 根据密文大小计算明文大小
+func plainSize(size int64) int64 {
+	size -= int64(encryptedHeaderSize)
+	if size <= 0 {
+		return 0
+	}
+	var blocks, rest = size / encryptedBlockSize, size % encryptedBlockSize
+	if rest > encryptedTagSize {
+		rest -= encryptedTagSize
+	} else {
+		rest = 0
+	}
+	return blocks*encryptedChunkSize + rest
+}
+
+// encryptReader 读取时将 src 中的明文加密，先输出文件头，再逐块输出密文
+type encryptReader struct {
+	header  *encryptionHeader
+	src     *bufio.Reader
+	index   uint32
+	pending []byte
+	plain   []byte
+	sealed  []byte
+	done    bool
+}
+
+func newEncryptReader(header *encryptionHeader, src io.Reader) *encryptReader {
+	return &encryptReader{
+		header:  header,
+		src:     bufio.NewReaderSize(src, encryptedChunkSize),
+		pending: header.raw,
+		plain:   make([]byte, encryptedChunkSize),
+		sealed:  make([]byte, 0, encryptedBlockSize),
+	}
+}
+
+func (this *encryptReader) Read(p []byte) (int, error) {
+	for len(this.pending) == 0 {
+		if this.done {
+			return 0, io.EOF
+		}
+		var n, err = io.ReadFull(this.src, this.plain)
+		switch {
+		case err == io.EOF || err == io.ErrUnexpectedEOF:
+			this.done = true
+		case err != nil:
+			return 0, err
+		default:
+			// 读满一块时检查后面是否还有内容，决定这一块是否为最后一块
+			if _, err = this.src.Peek(1); err == io.EOF {
+				this.done = true
+			} else if err != nil {
+				return 0, err
+			}
+		}
+		this.pending = this.header.aead.Seal(this.sealed[:0], this.header.nonce(this.index, this.done), this.plain[:n], this.header.aad)
+		this.index++
+	}
+
+	var n = copy(p, this.pending)
+	this.pending = this.pending[n:]
+	return n, nil
+}
+
+// decryptReader 从 src 中逐块读取密文并解密，src 从第 index 块的开头开始
+type decryptReader struct {
+	header  *encryptionHeader
+	src     *bufio.Reader
+	index   uint32
+	block   []byte
+	pending []byte
+	done    bool
+}
+
+func newDecryptReader(header *encryptionHeader, src io.Reader, index uint32) *decryptReader {
+	return &decryptReader{
+		header: header,
+		src:    bufio.NewReaderSize(src, encryptedBlockSize),
+		index:  index,
+		block:  make([]byte, encryptedBlockSize),
+	}
+}
+
+func (this *decryptReader) Read(p []byte) (int, error) {
+	for len(this.pending) == 0 {
+		if this.done {
+			return 0, io.EOF
+		}
+		var n, err = io.ReadFull(this.src, this.block)
+		switch {
+		case err == io.EOF || err == io.ErrUnexpectedEOF:
+			// 已经读到末尾，这一块必须是按最后一块加密的，否则说明文件被截断
+			this.done = true
+		case err != nil:
+			return 0, err
+		default:
+			if _, err = this.src.Peek(1); err == io.EOF {
+				this.done = true
+			} else if err != nil {
+				return 0, err
+			}
+		}
+		if n < encryptedTagSize {
+			return 0, EncryptionCorruptErr
+		}
+		var plain, openErr = this.header.aead.Open(this.block[:0], this.header.nonce(this.index, this.done), this.block[:n], this.header.aad)
+		if openErr != nil {
+			return 0, EncryptionCorruptErr
+		}
+		this.pending = plain
+		this.index++
+	}
+
+	var n = copy(p, this.pending)
+	this.pending = this.pending[n:]
+	return n, nil
+}
+
+// encryptedHandle 可以定位的解密句柄，定位后从所在块的开头重新读取密文
+type encryptedHandle struct {
+	disk   *Encrypted
+	path   string
+	header *encryptionHeader
+	offset int64
+	reader io.Reader
+	closer io.Closer
+}
+
+func (this *encryptedHandle) Read(p []byte) (int, error) {
+	if this.reader == nil {
+		var (
+			index = this.offset / encryptedChunkSize
+			start = int64(encryptedHeaderSize) + index*encryptedBlockSize
+		)
+		var size, err = this.disk.FileSystem.Size(this.path)
+		if err != nil {
+			return 0, this.disk.error("read", this.path, err)
+		}
+		if start >= size {
+			return 0, io.EOF
+		}
+		source, err := ReadRange(this.disk.FileSystem, this.path, start, -1)
+		if err != nil {
+			return 0, this.disk.error("read", this.path, err)
+		}
+		var reader = newDecryptReader(this.header, source, uint32(index))
+		if _, err = io.CopyN(ioutil.Discard, reader, this.offset-index*encryptedChunkSize); err != nil {
+			_ = source.Close()
+			if err == io.EOF {
+				return 0, io.EOF
+			}
+			return 0, this.disk.error("read", this.path, err)
+		}
+		this.reader, this.closer = reader, source
+	}
+
+	var n, err = this.reader.Read(p)
+	this.offset += int64(n)
+	if err != nil && err != io.EOF {
+		err = this.disk.error("read", this.path, err)
+	}
+	return n, err
+}
+
+func (this *encryptedHandle) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += this.offset
+	case io.SeekEnd:
+		var size, err = this.disk.Size(this.path)
+		if err != nil {
+			return 0, err
+		}
+		offset += size
+	default:
+		return 0, this.disk.error("seek", this.path, InvalidSeekErr)
+	}
+	if offset < 0 {
+		return 0, this.disk.error("seek", this.path, file.ErrInvalidRange)
+	}
+	if offset != this.offset {
+		_ = this.Close()
+		this.offset = offset
+	}
+	return offset, nil
+}
+
+func (this *encryptedHandle) Close() error {
+	var err error
+	if this.closer != nil {
+		err = this.closer.Close()
+	}
+	this.reader, this.closer = nil, nil
+	return err
+}
+
+// Open 打开文件用于读取，顺序读取时只需要一次请求，定位后从所在的块开始读取
+func (this *Encrypted) Open(path string) (io.ReadSeekCloser, error) {
+	var source, err = ReadRange(this.FileSystem, path, 0, -1)
+	if err != nil {
+		return nil, this.error("open", path, err)
+	}
+	header, err := this.readHeader(source, path)
+	if err != nil {
+		_ = source.Close()
+		return nil, this.error("open", path, err)
+	}
+	return &encryptedHandle{disk: this, path: path, header: header, reader: newDecryptReader(header, source, 0), closer: source}, nil
+}
+
+func (this *Encrypted) ReadRange(path string, offset, length int64) (io.ReadCloser, error) {
+	var size, err = this.Size(path)
+	if err == nil {
+		length, err = rangeLength(size, offset, length)
+	}
+	if err != nil {
+		return nil, this.error("read", path, err)
+	}
+
+	handle, err := this.Open(path)
+	if err == nil {
+		_, err = handle.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return limitedReadCloser{Reader: io.LimitReader(handle, length), Closer: handle}, nil
+}
+
+func (this *Encrypted) Read(path string) ([]byte, error) {
+	var handle, err = this.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer handle.Close()
+	return ioutil.ReadAll(handle)
+}
+
+func (this *Encrypted) Get(path string) (string, error) {
+	var contents, err = this.Read(path)
+	return string(contents), err
+}
+
+func (this *Encrypted) ReadStream(path string) (*bufio.Reader, error) {
+	return ReadStream(this, path)
+}
+
+// Size 获取明文大小，根据密文大小计算，不需要读取文件
+func (this *Encrypted) Size(path string) (int64, error) {
+	var size, err = this.FileSystem.Size(path)
+	if err != nil {
+		return 0, err
+	}
+	return plainSize(size), nil
+}
+
+func (this *Encrypted) PutStream(path string, r io.Reader, opts ...file.WriteOption) (int64, error) {
+	return this.write(path, path, r, opts...)
+}
+
+// write 将 r 加密后写入 target，密文与 path 绑定，重新加密时先写入临时文件再移动到 path
+func (this *Encrypted) write(target, path string, r io.Reader, opts ...file.WriteOption) (int64, error) {
+	var header, err = this.newHeader(path)
+	if err != nil {
+		return 0, this.error("write", path, err)
+	}
+	var counter = &countingReader{Reader: r}
+	if _, err = PutStream(this.FileSystem, target, newEncryptReader(header, counter), opts...); err != nil {
+		return 0, this.error("write", path, err)
+	}
+	return counter.count, nil
+}
+
+func (this *Encrypted) Put(path, contents string) error {
+	var _, err = this.PutStream(path, strings.NewReader(contents))
+	return err
+}
+
+func (this *Encrypted) WriteStream(path string, contents string) error {
+	return this.Put(path, contents)
+}
+
+// modify 读取原有内容后整体重新加密写入，文件不存在时视为空文件
+func (this *Encrypted) modify(path string, modify func(original []byte) []byte) error {
+	var original, err = this.Read(path)
+	if err != nil && !errors.Is(err, file.ErrNotFound) {
+		return err
+	}
+	_, err = this.PutStream(path, bytes.NewReader(modify(original)))
+	return err
+}
+
+func (this *Encrypted) Prepend(path, contents string) error {
+	return this.modify(path, func(original []byte) []byte {
+		return append([]byte(contents), original...)
+	})
+}
+
+func (this *Encrypted) Append(path, contents string) error {
+	return this.modify(path, func(original []byte) []byte {
+		return append(original, contents...)
+	})
+}
+
+// Copy 解密后重新加密写入 to，密文与路径绑定，不能直接复制，未加密的文件直接复制
+func (this *Encrypted) Copy(from, to string) error {
+	if this.key(from) == this.key(to) {
+		return nil
+	}
+	var handle, err = this.Open(from)
+	if errors.Is(err, NotEncryptedErr) {
+		return this.FileSystem.Copy(from, to)
+	}
+	if err != nil {
+		return this.error("copy", from, err)
+	}
+	defer handle.Close()
+
+	_, err = this.write(to, to, handle)
+	return this.error("copy", to, err)
+}
+
+// Move 重新加密写入 to 之后删除 from
+func (this *Encrypted) Move(from, to string) error {
+	if this.key(from) == this.key(to) {
+		return nil
+	}
+	if err := this.Copy(from, to); err != nil {
+		return err
+	}
+	return this.error("move", from, this.FileSystem.Delete(from))
+}
+
+func (this *Encrypted) Touch(path string, modTime time.Time) error {
+	return Touch(this.FileSystem, path, modTime)
+}
+
+// Rekey 使用当前密钥重新加密 directory 下的文件，未加密的文件也会被加密，返回重新加密的文件数量
+// 新内容先写入临时文件再覆盖原文件，密钥未知或者内容被篡改的文件会导致返回错误，但不会中断其他文件
+func (this *Encrypted) Rekey(directory string) (int, error) {
+	var (
+		count    int
+		firstErr error
+	)
+	for _, item := range this.FileSystem.AllFiles(directory) {
+		var path = item.Name()
+		if withPath, ok := item.(file.File); ok {
+			path = withPath.Path()
+		}
+		var rekeyed, err = this.rekey(path)
+		if err != nil {
+			logs.WithError(err).WithField("disk", this.name).WithField("path", path).Error("Encrypted.Rekey: failed to re-encrypt file")
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if rekeyed {
+			count++
+		}
+	}
+	return count, firstErr
+}
+
+func (this *Encrypted) rekey(path string) (bool, error) {
+	var source, err = ReadRange(this.FileSystem, path, 0, -1)
+	if err != nil {
+		return false, this.error("rekey", path, err)
+	}
+	defer source.Close()
+
+	var raw = make([]byte, encryptedHeaderSize)
+	n, err := io.ReadFull(source, raw)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return false, this.error("rekey", path, err)
+	}
+
+	var reader io.Reader
+	var header, headerErr = this.parseHeader(raw[:n], path)
+	switch {
+	case headerErr == nil && header.keyId == this.keyId:
+		return false, nil
+	case headerErr == nil:
+		reader = newDecryptReader(header, source, 0)
+	case errors.Is(headerErr, NotEncryptedErr):
+		reader = io.MultiReader(bytes.NewReader(raw[:n]), source)
+	default:
+		return false, this.error("rekey", path, headerErr)
+	}
+
+	var temporary = path + ".rekey"
+	if _, err = this.write(temporary, path, reader); err != nil {
+		_ = this.FileSystem.Delete(temporary)
+		return false, this.error("rekey", path, err)
+	}
+	if err = this.FileSystem.Move(temporary, path); err != nil {
+		_ = this.FileSystem.Delete(temporary)
+		return false, this.error("rekey", path, err)
+	}
+	return true, nil
+}
+
+// files 将文件大小转换为明文大小，读取时解密
+func (this *Encrypted) files(files []contracts.File) []contracts.File {
+	var results = wrapFiles(this.name, files, func(path string) (string, bool) {
+		return path, true
+	})
+	for i, item := range results {
+		results[i] = &EncryptedFile{ScopedFile: item.(*ScopedFile), disk: this}
+	}
+	return results
+}
+
+func (this *Encrypted) Files(directory string) []contracts.File {
+	return this.files(this.FileSystem.Files(directory))
+}
+
+func (this *Encrypted) AllFiles(directory string) []contracts.File {
+	return this.files(this.FileSystem.AllFiles(directory))
+}
+
+// EncryptedFile 加密磁盘中的文件，大小为明文大小
+type EncryptedFile struct {
+	*ScopedFile
+	disk *Encrypted
+}
+
+func (this *EncryptedFile) Size() int64 {
+	return plainSize(this.ScopedFile.Size())
+}
+
+func (this *EncryptedFile) Read() []byte {
+	var contents, _ = this.disk.Read(this.Path())
+	return contents
+}
+
+func (this *EncryptedFile) ReadString() string {
+	return string(this.Read())
+}
@@ -0,0 +1,421 @@
+package adapters
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem/file"
+	"github.com/goal-web/supports/logs"
+	"github.com/qiniu/go-sdk/v7/storage"
+	"io"
+	"io/fs"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultProbeInterval 健康检查的默认间隔
+const DefaultProbeInterval = 30 * time.Second
+
+// IsTransportError 判断错误是否由网络或者服务端故障导致，文件不存在、没有权限等错误不属于传输错误
+func IsTransportError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var statusErr *HttpStatusError
+	if errors.As(err, &statusErr) {
+		return serverFailure(statusErr.StatusCode)
+	}
+	var s3Err *S3Error
+	if errors.As(err, &s3Err) {
+		return serverFailure(s3Err.StatusCode)
+	}
+	var qiniuErr *storage.ErrorInfo
+	if errors.As(err, &qiniuErr) {
+		return serverFailure(qiniuErr.Code)
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// serverFailure 只有 5xx 表示服务端故障，七牛的 6xx 是文件不存在、文件已存在等业务错误
+func serverFailure(code int) bool {
+	return code >= 500 && code < 600
+}
+
+// FailoverEvent 切换磁盘事件，Recovered 为 true 时表示切换回了优先级更高的磁盘
+type FailoverEvent struct {
+	Disk      string
+	From      string
+	To        string
+	Err       error
+	Recovered bool
+	Time      time.Time
+}
+
+// NewFailover 创建故障转移磁盘，disks 按优先级排列，当前磁盘出现传输错误时自动切换到下一个磁盘
+// 切换后会每隔 interval 检查优先级更高的磁盘，恢复后自动切换回去
+func NewFailover(name string, disks []contracts.FileSystem, interval time.Duration) *Failover {
+	if interval <= 0 {
+		interval = DefaultProbeInterval
+	}
+	return &Failover{name: name, disks: disks, interval: interval, probePath: ".health", closed: make(chan struct{})}
+}
+
+type Failover struct {
+	name      string
+	disks     []contracts.FileSystem
+	interval  time.Duration
+	probePath string
+
+	mutex     sync.RWMutex
+	active    int
+	probing   bool
+	listeners []func(event FailoverEvent)
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// SetProbePath 设置健康检查时读取的路径，文件不需要存在
+func (this *Failover) SetProbePath(path string) *Failover {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	this.probePath = path
+	return this
+}
+
+// OnFailover 注册切换磁盘时的回调
+func (this *Failover) OnFailover(listener func(event FailoverEvent)) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	this.listeners = append(this.listeners, listener)
+}
+
+// Active 获取当前使用的磁盘
+func (this *Failover) Active() contracts.FileSystem {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+
+	return this.disks[this.active]
+}
+
+// Close 停止后台的健康检查
+func (this *Failover) Close() error {
+	this.closeOnce.Do(func() {
+		close(this.closed)
+	})
+	return nil
+}
+
+// healthy 磁盘可以正常响应时视为健康，文件不存在不影响健康状态
+func (this *Failover) healthy(disk contracts.FileSystem) error {
+	this.mutex.RLock()
+	var path = this.probePath
+	this.mutex.RUnlock()
+
+	if _, err := disk.Size(path); IsTransportError(err) {
+		return err
+	}
+	return nil
+}
+
+// Check 检查优先级比当前磁盘更高的磁盘，恢复时切换回去，返回当前是否使用首选磁盘
+func (this *Failover) Check() bool {
+	this.mutex.RLock()
+	var active = this.active
+	this.mutex.RUnlock()
+
+	for i := 0; i < active; i++ {
+		if this.healthy(this.disks[i]) == nil {
+			this.switchTo(active, i, nil)
+			return i == 0
+		}
+	}
+	return active == 0
+}
+
+// switchTo 从 from 切换到 to，from 已经不是当前磁盘时不做处理
+func (this *Failover) switchTo(from, to int, err error) {
+	this.mutex.Lock()
+	if this.active != from {
+		this.mutex.Unlock()
+		return
+	}
+	this.active = to
+	var (
+		listeners = append(make([]func(event FailoverEvent), 0, len(this.listeners)), this.listeners...)
+		probe     = to > 0 && !this.probing
+	)
+	if probe {
+		this.probing = true
+	}
+	this.mutex.Unlock()
+
+	var event = FailoverEvent{
+		Disk:      this.name,
+		From:      this.disks[from].Name(),
+		To:        this.disks[to].Name(),
+		Err:       err,
+		Recovered: to < from,
+		Time:      time.Now(),
+	}
+	var logger = logs.WithField("disk", this.name).WithField("from", event.From).WithField("to", event.To)
+	if event.Recovered {
+		logger.Info(fmt.Sprintf("Failover: disk %s recovered to %s", this.name, event.To))
+	} else {
+		logger.WithError(err).Warn(fmt.Sprintf("Failover: disk %s failed over to %s", this.name, event.To))
+	}
+	for _, listener := range listeners {
+		listener(event)
+	}
+
+	if probe {
+		go this.probe()
+	}
+}
+
+// probe 在后台定期检查，切换回首选磁盘或者关闭后退出
+func (this *Failover) probe() {
+	var ticker = time.NewTicker(this.interval)
+	defer ticker.Stop()
+	defer func() {
+		this.mutex.Lock()
+		this.probing = false
+		this.mutex.Unlock()
+	}()
+
+	for {
+		select {
+		case <-this.closed:
+			return
+		case <-ticker.C:
+			if this.Check() {
+				return
+			}
+		}
+	}
+}
+
+// call 在当前磁盘上执行操作，出现传输错误时依次切换到后面的磁盘重试
+func (this *Failover) call(call func(disk contracts.FileSystem) error) error {
+	this.mutex.RLock()
+	var active = this.active
+	this.mutex.RUnlock()
+
+	var err, cause error
+	for i := active; i < len(this.disks); i++ {
+		if err = call(this.disks[i]); !IsTransportError(err) {
+			if i != active {
+				this.switchTo(active, i, cause)
+			}
+			return err
+		}
+		cause = err
+		if i+1 < len(this.disks) {
+			logs.WithError(err).WithField("disk", this.disks[i].Name()).Debug("Failover: transport error, trying next disk")
+		}
+	}
+	return err
+}
+
+func (this *Failover) Name() string {
+	return this.name
+}
+
+func (this *Failover) Exists(path string) bool {
+	return this.Active().Exists(path)
+}
+
+func (this *Failover) Get(path string) (contents string, err error) {
+	err = this.call(func(disk contracts.FileSystem) (err error) {
+		contents, err = disk.Get(path)
+		return
+	})
+	return
+}
+
+func (this *Failover) Read(path string) (contents []byte, err error) {
+	err = this.call(func(disk contracts.FileSystem) (err error) {
+		contents, err = disk.Read(path)
+		return
+	})
+	return
+}
+
+func (this *Failover) Open(path string) (handle io.ReadSeekCloser, err error) {
+	err = this.call(func(disk contracts.FileSystem) (err error) {
+		handle, err = Open(disk, path)
+		return
+	})
+	return
+}
+
+func (this *Failover) ReadRange(path string, offset, length int64) (reader io.ReadCloser, err error) {
+	err = this.call(func(disk contracts.FileSystem) (err error) {
+		reader, err = ReadRange(disk, path, offset, length)
+		return
+	})
+	return
+}
+
+func (this *Failover) ReadStream(path string) (reader *bufio.Reader, err error) {
+	err = this.call(func(disk contracts.FileSystem) (err error) {
+		reader, err = disk.ReadStream(path)
+		return
+	})
+	return
+}
+
+func (this *Failover) Checksum(path string) (sum string, err error) {
+	err = this.call(func(disk contracts.FileSystem) (err error) {
+		sum, err = Checksum(disk, path)
+		return
+	})
+	return
+}
+
+// SupportsUrls 任意一个磁盘可以生成地址时返回 true，当前磁盘不支持时 Url 返回空字符串
+func (this *Failover) SupportsUrls() bool {
+	for _, disk := range this.disks {
+		if SupportsUrls(disk) {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *Failover) Url(path string) string {
+	var url, _ = Url(this.Active(), path)
+	return url
+}
+
+func (this *Failover) TemporaryUrl(path string, ttl time.Duration, opts ...file.UrlOption) (string, error) {
+	return TemporaryUrl(this.Active(), path, ttl, opts...)
+}
+
+func (this *Failover) Put(path, contents string) error {
+	return this.call(func(disk contracts.FileSystem) error {
+		return disk.Put(path, contents)
+	})
+}
+
+func (this *Failover) WriteStream(path string, contents string) error {
+	return this.call(func(disk contracts.FileSystem) error {
+		return disk.WriteStream(path, contents)
+	})
+}
+
+// PutStream 流式写入无法重放，当前磁盘出现传输错误时直接返回错误，下一次调用才会使用其他磁盘
+func (this *Failover) PutStream(path string, r io.Reader, opts ...file.WriteOption) (int64, error) {
+	this.mutex.RLock()
+	var active = this.active
+	this.mutex.RUnlock()
+
+	var written, err = PutStream(this.disks[active], path, r, opts...)
+	if IsTransportError(err) && active+1 < len(this.disks) {
+		this.switchTo(active, active+1, err)
+	}
+	return written, err
+}
+
+func (this *Failover) GetVisibility(path string) contracts.FileVisibility {
+	return this.Active().GetVisibility(path)
+}
+
+func (this *Failover) SetVisibility(path string, perm fs.FileMode) error {
+	return this.call(func(disk contracts.FileSystem) error {
+		return disk.SetVisibility(path, perm)
+	})
+}
+
+func (this *Failover) Touch(path string, modTime time.Time) error {
+	return this.call(func(disk contracts.FileSystem) error {
+		return Touch(disk, path, modTime)
+	})
+}
+
+func (this *Failover) Prepend(path, contents string) error {
+	return this.call(func(disk contracts.FileSystem) error {
+		return disk.Prepend(path, contents)
+	})
+}
+
+func (this *Failover) Append(path, contents string) error {
+	return this.call(func(disk contracts.FileSystem) error {
+		return disk.Append(path, contents)
+	})
+}
+
+func (this *Failover) Delete(path string) error {
+	return this.call(func(disk contracts.FileSystem) error {
+		return disk.Delete(path)
+	})
+}
+
+func (this *Failover) Copy(from, to string) error {
+	return this.call(func(disk contracts.FileSystem) error {
+		return disk.Copy(from, to)
+	})
+}
+
+func (this *Failover) Move(from, to string) error {
+	return this.call(func(disk contracts.FileSystem) error {
+		return disk.Move(from, to)
+	})
+}
+
+func (this *Failover) Size(path string) (size int64, err error) {
+	err = this.call(func(disk contracts.FileSystem) (err error) {
+		size, err = disk.Size(path)
+		return
+	})
+	return
+}
+
+func (this *Failover) LastModified(path string) (modTime time.Time, err error) {
+	err = this.call(func(disk contracts.FileSystem) (err error) {
+		modTime, err = disk.LastModified(path)
+		return
+	})
+	return
+}
+
+func (this *Failover) files(files []contracts.File) []contracts.File {
+	return wrapFiles(this.name, files, func(path string) (string, bool) {
+		return path, true
+	})
+}
+
+func (this *Failover) Files(directory string) []contracts.File {
+	return this.files(this.Active().Files(directory))
+}
+
+func (this *Failover) AllFiles(directory string) []contracts.File {
+	return this.files(this.Active().AllFiles(directory))
+}
+
+func (this *Failover) Directories(directory string) []string {
+	return this.Active().Directories(directory)
+}
+
+func (this *Failover) AllDirectories(directory string) []string {
+	return this.Active().AllDirectories(directory)
+}
+
+func (this *Failover) MakeDirectory(path string) error {
+	return this.call(func(disk contracts.FileSystem) error {
+		return disk.MakeDirectory(path)
+	})
+}
+
+func (this *Failover) DeleteDirectory(directory string) error {
+	return this.call(func(disk contracts.FileSystem) error {
+		return disk.DeleteDirectory(directory)
+	})
+}
@@ -0,0 +1,282 @@
+package adapters
+
+import (
+	"bufio"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem/file"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// TestingT 断言所需的测试对象，*testing.T 实现了该接口
+type TestingT interface {
+	Errorf(format string, args ...interface{})
+}
+
+type tHelper interface {
+	Helper()
+}
+
+// Operation 假磁盘记录的一次操作
+type Operation struct {
+	Method string
+	Path   string
+	To     string
+	Time   time.Time
+}
+
+var fakeWriteMethods = map[string]bool{
+	"Put": true, "WriteStream": true, "PutStream": true, "Prepend": true, "Append": true, "AppendStream": true, "Copy": true, "Move": true,
+}
+
+var fakeDeleteMethods = map[string]bool{
+	"Delete": true, "DeleteDirectory": true,
+}
+
+// NewFake 创建一个基于内存的假磁盘，记录所有操作并提供断言方法
+func NewFake(name string) *Fake {
+	return &Fake{Memory: NewMemoryFileSystem(name, os.ModePerm)}
+}
+
+type Fake struct {
+	*Memory
+	mutex      sync.Mutex
+	operations []Operation
+}
+
+func (this *Fake) record(method, path string, to ...string) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	var operation = Operation{Method: method, Path: path, Time: time.Now()}
+	if len(to) > 0 {
+		operation.To = to[0]
+	}
+	this.operations = append(this.operations, operation)
+}
+
+// Operations 获取所有已记录的操作
+func (this *Fake) Operations() []Operation {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	return append([]Operation(nil), this.operations...)
+}
+
+func (this *Fake) count(methods map[string]bool) (count int) {
+	for _, operation := range this.Operations() {
+		if methods[operation.Method] {
+			count++
+		}
+	}
+	return
+}
+
+func (this *Fake) Exists(path string) bool {
+	this.record("Exists", path)
+	return this.Memory.Exists(path)
+}
+
+func (this *Fake) Get(path string) (string, error) {
+	this.record("Get", path)
+	return this.Memory.Get(path)
+}
+
+func (this *Fake) Read(path string) ([]byte, error) {
+	this.record("Read", path)
+	return this.Memory.Read(path)
+}
+
+func (this *Fake) Open(path string) (io.ReadSeekCloser, error) {
+	this.record("Open", path)
+	return this.Memory.Open(path)
+}
+
+func (this *Fake) ReadRange(path string, offset, length int64) (io.ReadCloser, error) {
+	this.record("ReadRange", path)
+	return this.Memory.ReadRange(path, offset, length)
+}
+
+func (this *Fake) ReadStream(path string) (*bufio.Reader, error) {
+	this.record("ReadStream", path)
+	return this.Memory.ReadStream(path)
+}
+
+func (this *Fake) Put(path, contents string) error {
+	this.record("Put", path)
+	return this.Memory.Put(path, contents)
+}
+
+func (this *Fake) WriteStream(path string, contents string) error {
+	this.record("WriteStream", path)
+	return this.Memory.WriteStream(path, contents)
+}
+
+func (this *Fake) PutStream(path string, r io.Reader, opts ...file.WriteOption) (int64, error) {
+	this.record("PutStream", path)
+	return this.Memory.PutStream(path, r, opts...)
+}
+
+func (this *Fake) GetVisibility(path string) contracts.FileVisibility {
+	this.record("GetVisibility", path)
+	return this.Memory.GetVisibility(path)
+}
+
+func (this *Fake) SetVisibility(path string, perm fs.FileMode) error {
+	this.record("SetVisibility", path)
+	return this.Memory.SetVisibility(path, perm)
+}
+
+func (this *Fake) Prepend(path, contents string) error {
+	this.record("Prepend", path)
+	return this.Memory.Prepend(path, contents)
+}
+
+func (this *Fake) Append(path, contents string) error {
+	this.record("Append", path)
+	return this.Memory.Append(path, contents)
+}
+
+func (this *Fake) AppendStream(path string, r io.Reader) (int64, error) {
+	this.record("AppendStream", path)
+	return this.Memory.AppendStream(path, r)
+}
+
+func (this *Fake) Delete(path string) error {
+	this.record("Delete", path)
+	return this.Memory.Delete(path)
+}
+
+func (this *Fake) Copy(from, to string) error {
+	this.record("Copy", from, to)
+	return this.Memory.Copy(from, to)
+}
+
+func (this *Fake) Move(from, to string) error {
+	this.record("Move", from, to)
+	return this.Memory.Move(from, to)
+}
+
+func (this *Fake) Size(path string) (int64, error) {
+	this.record("Size", path)
+	return this.Memory.Size(path)
+}
+
+func (this *Fake) LastModified(path string) (time.Time, error) {
+	this.record("LastModified", path)
+	return this.Memory.LastModified(path)
+}
+
+func (this *Fake) Touch(path string, modTime time.Time) error {
+	this.record("Touch", path)
+	return this.Memory.Touch(path, modTime)
+}
+
+func (this *Fake) Checksum(path string) (string, error) {
+	this.record("Checksum", path)
+	return this.Memory.Checksum(path)
+}
+
+func (this *Fake) Files(directory string) []contracts.File {
+	this.record("Files", directory)
+	return this.Memory.Files(directory)
+}
+
+func (this *Fake) AllFiles(directory string) []contracts.File {
+	this.record("AllFiles", directory)
+	return this.Memory.AllFiles(directory)
+}
+
+func (this *Fake) Directories(directory string) []string {
+	this.record("Directories", directory)
+	return this.Memory.Directories(directory)
+}
+
+func (this *Fake) AllDirectories(directory string) []string {
+	this.record("AllDirectories", directory)
+	return this.Memory.AllDirectories(directory)
+}
+
+func (this *Fake) MakeDirectory(path string) error {
+	this.record("MakeDirectory", path)
+	return this.Memory.MakeDirectory(path)
+}
+
+func (this *Fake) DeleteDirectory(directory string) error {
+	this.record("DeleteDirectory", directory)
+	return this.Memory.DeleteDirectory(directory)
+}
+
+// AssertExists 断言给定的文件或目录存在
+func (this *Fake) AssertExists(t TestingT, paths ...string) bool {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+	var success = true
+	for _, path := range paths {
+		if !this.Memory.Exists(path) {
+			t.Errorf("unable to find a file or directory at path [%s] on disk [%s]", path, this.name)
+			success = false
+		}
+	}
+	return success
+}
+
+// AssertMissing 断言给定的文件或目录不存在
+func (this *Fake) AssertMissing(t TestingT, paths ...string) bool {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+	var success = true
+	for _, path := range paths {
+		if this.Memory.Exists(path) {
+			t.Errorf("found unexpected file or directory at path [%s] on disk [%s]", path, this.name)
+			success = false
+		}
+	}
+	return success
+}
+
+// AssertContent 断言文件内容与期望值一致
+func (this *Fake) AssertContent(t TestingT, path, expected string) bool {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+	var contents, err = this.Memory.Get(path)
+	if err != nil {
+		t.Errorf("unable to read file at path [%s] on disk [%s]: %v", path, this.name, err)
+		return false
+	}
+	if contents != expected {
+		t.Errorf("file [%s] on disk [%s] does not contain the expected content.\nexpected: %q\nactual  : %q", path, this.name, expected, contents)
+		return false
+	}
+	return true
+}
+
+// AssertWritten 断言写入操作（Put、WriteStream、PutStream、Prepend、Append、AppendStream、Copy、Move）的次数
+func (this *Fake) AssertWritten(t TestingT, n int) bool {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+	if count := this.count(fakeWriteMethods); count != n {
+		t.Errorf("expected %d write operations on disk [%s], got %d", n, this.name, count)
+		return false
+	}
+	return true
+}
+
+// AssertNothingDeleted 断言没有执行过 Delete 或 DeleteDirectory
+func (this *Fake) AssertNothingDeleted(t TestingT) bool {
+	if h, ok := t.(tHelper); ok {
+		h.Helper()
+	}
+	if count := this.count(fakeDeleteMethods); count > 0 {
+		t.Errorf("expected nothing to be deleted on disk [%s], got %d delete operations", this.name, count)
+		return false
+	}
+	return true
+}
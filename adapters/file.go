@@ -2,23 +2,28 @@ package adapters
 
 import (
 	"io/fs"
-	"io/ioutil"
 )
 
 type File struct {
 	fs.FileInfo
 	DiskName string
-	path     string
+	disk     *local
+	relative string
+}
+
+func (this *File) Path() string {
+	return this.relative
 }
 
+// Read 通过磁盘读取，与 Get 一样受根目录以及符号链接的限制
 func (this *File) Read() []byte {
-	var contents, _ = ioutil.ReadFile(this.path)
+	var contents, _ = this.disk.Read(this.relative)
 	return contents
 }
 
 func (this *File) ReadString() string {
-	contents, _ := ioutil.ReadFile(this.path)
-	return string(contents)
+	var contents, _ = this.disk.Get(this.relative)
+	return contents
 }
 
 func (this *File) Disk() string {
@@ -31,6 +36,10 @@ type QiniuFile struct {
 	disk     *Qiniu
 }
 
+func (this *QiniuFile) Path() string {
+	return this.Name()
+}
+
 func (this *QiniuFile) Disk() string {
 	return this.DiskName
 }
@@ -44,3 +53,52 @@ func (this *QiniuFile) ReadString() string {
 	var contents, _ = this.disk.Get(this.Name())
 	return contents
 }
+
+type S3File struct {
+	S3FileInfo
+	DiskName string
+	disk     *S3
+}
+
+func (this *S3File) Path() string {
+	return this.Name()
+}
+
+func (this *S3File) Disk() string {
+	return this.DiskName
+}
+
+func (this *S3File) Read() []byte {
+	var bytes, _ = this.disk.Read(this.Name())
+	return bytes
+}
+
+func (this *S3File) ReadString() string {
+	var contents, _ = this.disk.Get(this.Name())
+	return contents
+}
+
+type MemoryFile struct {
+	MemoryFileInfo
+	DiskName string
+	disk     *Memory
+	path     string
+}
+
+func (this *MemoryFile) Path() string {
+	return this.path
+}
+
+func (this *MemoryFile) Disk() string {
+	return this.DiskName
+}
+
+func (this *MemoryFile) Read() []byte {
+	var contents, _ = this.disk.Read(this.path)
+	return contents
+}
+
+func (this *MemoryFile) ReadString() string {
+	var contents, _ = this.disk.Get(this.path)
+	return contents
+}
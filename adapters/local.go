@@ -2,13 +2,19 @@ package adapters
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"github.com/goal-web/contracts"
 	"github.com/goal-web/filesystem/file"
 	"github.com/goal-web/supports/utils"
+	"io"
 	"io/fs"
 	"io/ioutil"
+	"net/http"
 	"os"
+	pathpkg "path"
+	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 )
@@ -17,17 +23,45 @@ type local struct {
 	name string
 	root string
 	perm fs.FileMode
+	// realRoot 解析符号链接后的根目录，为空时不检查符号链接
+	realRoot string
+	// signer 没有配置 url 时为空
+	signer *UrlSigner
+	ttl    time.Duration
 }
 
 func LocalAdapter(name string, config contracts.Fields) contracts.FileSystem {
-	return NewLocalFileSystem(
-		name,
-		utils.GetStringField(config, "root"),
-		config["perm"].(fs.FileMode),
-	)
+	return NewLocalFileSystemWithConfig(name, LocalConfig{
+		Root:             utils.GetStringField(config, "root"),
+		Perm:             config["perm"].(fs.FileMode),
+		RestrictSymlinks: utils.GetBoolField(config, "restrict_symlinks"),
+		Url:              utils.GetStringField(config, "url"),
+		Secret:           utils.GetStringField(config, "secret"),
+		TTL:              time.Duration(utils.GetIntField(config, "ttl")) * time.Second,
+	})
+}
+
+// LocalConfig 本地磁盘配置
+type LocalConfig struct {
+	Root string
+	Perm fs.FileMode
+	// RestrictSymlinks 拒绝访问通过符号链接指向根目录以外的文件
+	RestrictSymlinks bool
+	// Url 文件访问地址的前缀，例如 http://localhost:8000/files，需要在该地址下挂载 Handler
+	Url string
+	// Secret 临时地址的签名密钥，为空时不能生成临时地址
+	Secret string
+	// TTL 临时地址默认的有效期，为 0 时使用 DefaultUrlTTL
+	TTL time.Duration
 }
 
 func NewLocalFileSystem(name, root string, perm fs.FileMode) contracts.FileSystem {
+	return NewLocalFileSystemWithConfig(name, LocalConfig{Root: root, Perm: perm})
+}
+
+// NewLocalFileSystemWithConfig 创建本地磁盘，所有路径都会被限制在 Root 目录下
+func NewLocalFileSystemWithConfig(name string, config LocalConfig) contracts.FileSystem {
+	var root, perm = config.Root, config.Perm
 	stat, err := os.Stat(root)
 
 	if err != nil {
@@ -39,27 +73,131 @@ func NewLocalFileSystem(name, root string, perm fs.FileMode) contracts.FileSyste
 		panic(fmt.Errorf("%s is not a directory", root))
 	}
 
-	if !strings.HasSuffix(root, "/") {
-		root = root + "/"
+	root, err = filepath.Abs(root)
+	if err != nil {
+		panic(err)
+	}
+
+	var realRoot string
+	if config.RestrictSymlinks {
+		if realRoot, err = filepath.EvalSymlinks(root); err != nil {
+			panic(err)
+		}
+	}
+
+	var signer *UrlSigner
+	if config.Url != "" {
+		if signer, err = NewUrlSigner(config.Url, []byte(config.Secret)); err != nil {
+			panic(err)
+		}
 	}
 
 	return &local{
-		root: root,
-		perm: perm,
-		name: name,
+		root:     strings.TrimSuffix(root, string(filepath.Separator)) + string(filepath.Separator),
+		perm:     perm,
+		name:     name,
+		realRoot: realRoot,
+		signer:   signer,
+		ttl:      config.TTL,
+	}
+}
+
+// Url 获取文件不带签名的访问地址，没有配置 url 时返回空字符串，Handler 只对 VISIBLE 文件接受这样的地址
+func (this *local) Url(path string) string {
+	if this.signer == nil {
+		return ""
+	}
+	return this.signer.Url(path)
+}
+
+// TemporaryUrl 获取在 ttl 之后过期的签名地址，没有配置 url 或者 secret 时返回 file.ErrUnsupported
+func (this *local) TemporaryUrl(path string, ttl time.Duration, opts ...file.UrlOption) (string, error) {
+	if this.signer == nil {
+		return "", this.error("url", path, file.ErrUnsupported)
+	}
+	var signed, err = this.signer.TemporaryUrl(path, time.Now().Add(urlTTL(ttl, this.ttl)), opts...)
+	if err != nil {
+		return "", this.error("url", path, err)
+	}
+	return signed, nil
+}
+
+// SupportsUrls 配置了 url 时才能生成地址
+func (this *local) SupportsUrls() bool {
+	return this.signer != nil
+}
+
+// Signer 获取生成地址使用的签名器，没有配置 url 时为 nil
+func (this *local) Signer() *UrlSigner {
+	return this.signer
+}
+
+// Handler 获取输出文件的 http.Handler，需要挂载在 url 配置的路径下
+// VISIBLE 文件可以通过 Url 生成的地址直接访问，INVISIBLE 文件只能通过 TemporaryUrl 生成的签名地址访问
+func (this *local) Handler() http.Handler {
+	if this.signer == nil {
+		return http.NotFoundHandler()
+	}
+	return &SignedHandler{disk: this, signer: this.signer, public: true}
+}
+
+// resolve 将磁盘路径转换为根目录下的绝对路径，超出根目录的路径返回 file.ErrOutsideRoot
+func (this *local) resolve(op, path string) (string, error) {
+	var cleaned = pathpkg.Clean(strings.TrimLeft(filepath.ToSlash(path), "/"))
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") || strings.ContainsRune(path, 0) {
+		return "", this.error(op, path, file.ErrOutsideRoot)
+	}
+	if cleaned == "." {
+		cleaned = ""
+	}
+
+	var resolved = this.root + filepath.FromSlash(cleaned)
+	if this.realRoot != "" {
+		if err := this.checkSymlinks(resolved); err != nil {
+			return "", this.error(op, path, err)
+		}
+	}
+	return resolved, nil
+}
+
+// checkSymlinks 解析路径中已存在部分的符号链接，确认其仍然位于根目录下
+func (this *local) checkSymlinks(resolved string) error {
+	var existing = resolved
+	for {
+		if _, err := os.Lstat(existing); err == nil {
+			break
+		}
+		var parent = filepath.Dir(existing)
+		if parent == existing {
+			return nil
+		}
+		existing = parent
+	}
+
+	var real, err = filepath.EvalSymlinks(existing)
+	if err != nil {
+		return err
+	}
+	if real != this.realRoot && !strings.HasPrefix(real, this.realRoot+string(filepath.Separator)) {
+		return file.ErrOutsideRoot
 	}
+	return nil
 }
 
-func (this local) filepath(path string) string {
-	if strings.HasPrefix(path, "/") {
-		runes := []rune(path)
-		path = string(runes[1:])
+// file 创建文件对象，path 为已经过校验的相对路径
+func (this *local) file(path string, fileInfo fs.FileInfo) *File {
+	var relative = strings.TrimPrefix(pathpkg.Clean("/"+path), "/")
+	return &File{
+		FileInfo: fileInfo,
+		DiskName: this.name,
+		disk:     this,
+		relative: relative,
 	}
-	return this.root + path
 }
-func (this local) dir(path string) string {
-	var arr = strings.Split(strings.ReplaceAll(path, this.root, ""), "/")
-	return strings.Join(arr[:len(arr)-1], "/")
+
+// error 将原始错误转换为带有磁盘名称和路径的 *file.Error
+func (this *local) error(op, path string, err error) error {
+	return file.Wrap(op, this.name, path, err)
 }
 
 func (this *local) Name() string {
@@ -67,40 +205,97 @@ func (this *local) Name() string {
 }
 
 func (this *local) Exists(path string) bool {
-	_, err := os.Lstat(this.filepath(path))
+	var resolved, err = this.resolve("stat", path)
+	if err != nil {
+		return false
+	}
+	_, err = os.Lstat(resolved)
 	return !os.IsNotExist(err)
 }
 
 func (this *local) Get(path string) (string, error) {
-	contents, err := ioutil.ReadFile(this.filepath(path))
+	contents, err := this.Read(path)
 	return string(contents), err
 }
 
 func (this *local) Read(path string) ([]byte, error) {
-	contents, err := ioutil.ReadFile(this.filepath(path))
-	return contents, err
+	var resolved, err = this.resolve("read", path)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := ioutil.ReadFile(resolved)
+	return contents, this.error("read", path, err)
+}
+
+// Open 打开文件，返回的 *os.File 原生支持定位
+func (this *local) Open(path string) (io.ReadSeekCloser, error) {
+	var resolved, err = this.resolve("open", path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(resolved)
+	if err != nil {
+		return nil, this.error("open", path, err)
+	}
+	return f, nil
+}
+
+// ReadRange 使用 ReadAt 读取部分内容
+func (this *local) ReadRange(path string, offset, length int64) (io.ReadCloser, error) {
+	var resolved, err = this.resolve("read", path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(resolved)
+	if err != nil {
+		return nil, this.error("read", path, err)
+	}
+	stat, err := f.Stat()
+	if err == nil {
+		length, err = rangeLength(stat.Size(), offset, length)
+	}
+	if err != nil {
+		_ = f.Close()
+		return nil, this.error("read", path, err)
+	}
+	return limitedReadCloser{Reader: io.NewSectionReader(f, offset, length), Closer: f}, nil
 }
 
+// ReadStream 读取到末尾后会自动关闭文件，需要手动关闭时请使用 Open
 func (this *local) ReadStream(path string) (*bufio.Reader, error) {
-	var f, err = os.Open(this.filepath(path))
-	return bufio.NewReader(f), err
+	return ReadStream(this, path)
+}
+
+// mkdirFor 创建给定文件路径的上级目录
+func (this *local) mkdirFor(resolved string) error {
+	return os.MkdirAll(filepath.Dir(resolved), this.perm)
+}
+
+// create 创建或者清空文件，会自动创建上级目录
+func (this *local) create(op, path string) (*os.File, error) {
+	var resolved, err = this.resolve(op, path)
+	if err != nil {
+		return nil, err
+	}
+	if err = this.mkdirFor(resolved); err != nil {
+		return nil, this.error(op, path, err)
+	}
+	openFile, err := os.OpenFile(resolved, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, this.perm)
+	return openFile, this.error(op, path, err)
 }
 
 func (this *local) Put(path, contents string) error {
-	path = this.filepath(path)
-	var openFile, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, this.perm)
+	var openFile, err = this.create("put", path)
 	if err != nil {
-		if mkdirErr := this.MakeDirectory(this.dir(path)); mkdirErr != nil {
-			return mkdirErr
-		}
+		return err
 	}
+	defer openFile.Close()
 	_, err = openFile.WriteString(contents)
-	return err
+	return this.error("put", path, err)
 }
 
 func (this *local) WriteStream(path string, contents string) error {
-	path = this.filepath(path)
-	openFile, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, this.perm)
+	openFile, err := this.create("write", path)
 	if err != nil {
 		return err
 	}
@@ -108,59 +303,163 @@ func (this *local) WriteStream(path string, contents string) error {
 	writer := bufio.NewWriter(openFile)
 	_, err = writer.WriteString(contents)
 	if err != nil {
-		return err
+		return this.error("write", path, err)
 	}
-	return writer.Flush()
+	return this.error("write", path, writer.Flush())
 }
 
+// PutStream 直接将 r 中的内容写入磁盘
+func (this *local) PutStream(path string, r io.Reader, opts ...file.WriteOption) (int64, error) {
+	var options = file.ApplyWriteOptions(opts...)
+	openFile, err := this.create("write", path)
+	if err != nil {
+		return 0, err
+	}
+	defer openFile.Close()
+
+	written, err := io.Copy(openFile, r)
+	if err == nil && options.Perm != 0 {
+		err = openFile.Chmod(options.Perm)
+	}
+	return written, this.error("write", path, err)
+}
+
+// GetVisibility 其他用户可读的文件视为可见
 func (this *local) GetVisibility(path string) contracts.FileVisibility {
-	openFile, err := os.OpenFile(this.filepath(path), os.O_RDWR, this.perm)
-	if openFile != nil && err == nil {
-		_ = openFile.Close()
+	var resolved, err = this.resolve("stat", path)
+	if err != nil {
+		return file.INVISIBLE
+	}
+	stat, err := os.Stat(resolved)
+	if err == nil && stat.Mode().Perm()&0004 != 0 {
 		return file.VISIBLE
 	}
 	return file.INVISIBLE
 }
 
 func (this *local) SetVisibility(path string, perm fs.FileMode) error {
-	return os.Chmod(this.filepath(path), perm)
+	var resolved, err = this.resolve("chmod", path)
+	if err != nil {
+		return err
+	}
+	return this.error("chmod", path, os.Chmod(resolved, perm))
 }
 
+// Prepend 在文件开头写入内容，文件不存在时创建，读取失败时返回错误，不会覆盖原有内容
 func (this *local) Prepend(path, contents string) error {
-	originalData, err := this.Get(path)
-
-	if err != nil {
-		return this.WriteStream(path, contents)
+	var originalData, err = this.Get(path)
+	if err != nil && !errors.Is(err, file.ErrNotFound) {
+		return err
 	}
-
 	return this.WriteStream(path, contents+originalData)
 }
 
 func (this *local) Append(path, contents string) error {
-	path = this.filepath(path)
-	var openFile, err = os.OpenFile(path, os.O_APPEND|os.O_WRONLY|os.O_CREATE, os.ModeAppend|this.perm)
+	var resolved, err = this.resolve("append", path)
 	if err != nil {
 		return err
 	}
+	if err = this.mkdirFor(resolved); err != nil {
+		return this.error("append", path, err)
+	}
+	openFile, err := os.OpenFile(resolved, os.O_APPEND|os.O_WRONLY|os.O_CREATE, os.ModeAppend|this.perm)
+	if err != nil {
+		return this.error("append", path, err)
+	}
 	defer openFile.Close()
 	_, err = openFile.WriteString(contents)
-	return err
+	return this.error("append", path, err)
+}
+
+// AppendStream 以追加模式打开文件，直接把 r 中的内容写入文件末尾
+func (this *local) AppendStream(path string, r io.Reader) (int64, error) {
+	var resolved, err = this.resolve("append", path)
+	if err != nil {
+		return 0, err
+	}
+	if err = this.mkdirFor(resolved); err != nil {
+		return 0, this.error("append", path, err)
+	}
+	openFile, err := os.OpenFile(resolved, os.O_APPEND|os.O_WRONLY|os.O_CREATE, os.ModeAppend|this.perm)
+	if err != nil {
+		return 0, this.error("append", path, err)
+	}
+	defer openFile.Close()
+	written, err := io.Copy(openFile, r)
+	return written, this.error("append", path, err)
 }
 
 func (this *local) Delete(path string) error {
-	return os.Remove(this.filepath(path))
+	var resolved, err = this.resolve("delete", path)
+	if err != nil {
+		return err
+	}
+	return this.error("delete", path, os.Remove(resolved))
 }
 
+// Copy 复制文件，目标文件已存在时会被覆盖
 func (this *local) Copy(from, to string) error {
-	return utils.CopyFile(this.filepath(from), this.filepath(to), 1000)
+	var resolved, err = this.resolve("copy", from)
+	if err != nil {
+		return err
+	}
+	source, err := os.Open(resolved)
+	if err != nil {
+		return this.error("copy", from, err)
+	}
+	defer source.Close()
+
+	// 源文件和目标文件是同一个文件时直接返回，否则打开目标文件时会把内容清空
+	target, err := this.resolve("copy", to)
+	if err != nil {
+		return err
+	}
+	if sourceInfo, statErr := source.Stat(); statErr == nil {
+		if targetInfo, statErr := os.Stat(target); statErr == nil && os.SameFile(sourceInfo, targetInfo) {
+			return nil
+		}
+	}
+
+	destination, err := this.create("copy", to)
+	if err != nil {
+		return err
+	}
+	defer destination.Close()
+
+	_, err = io.Copy(destination, source)
+	return this.error("copy", to, err)
 }
 
+// Move 移动文件，目标文件已存在时会被覆盖
 func (this *local) Move(from, to string) error {
-	return os.Rename(this.filepath(from), this.filepath(to))
+	var source, err = this.resolve("move", from)
+	if err != nil {
+		return err
+	}
+	destination, err := this.resolve("move", to)
+	if err != nil {
+		return err
+	}
+	if _, err = os.Lstat(source); err != nil {
+		return this.error("move", from, err)
+	}
+	if err = this.mkdirFor(destination); err != nil {
+		return this.error("move", to, err)
+	}
+	return this.error("move", to, os.Rename(source, destination))
+}
+
+func (this *local) stat(path string) (fs.FileInfo, error) {
+	var resolved, err = this.resolve("stat", path)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := os.Stat(resolved)
+	return stat, this.error("stat", path, err)
 }
 
 func (this *local) Size(path string) (int64, error) {
-	stat, err := os.Stat(this.filepath(path))
+	stat, err := this.stat(path)
 	if err != nil {
 		return 0, err
 	}
@@ -169,7 +468,7 @@ func (this *local) Size(path string) (int64, error) {
 }
 
 func (this *local) LastModified(path string) (time.Time, error) {
-	stat, err := os.Stat(this.filepath(path))
+	stat, err := this.stat(path)
 	if err != nil {
 		return time.Time{}, err
 	}
@@ -177,19 +476,44 @@ func (this *local) LastModified(path string) (time.Time, error) {
 	return stat.ModTime(), nil
 }
 
+// Touch 设置文件的访问时间以及修改时间
+func (this *local) Touch(path string, modTime time.Time) error {
+	var resolved, err = this.resolve("touch", path)
+	if err != nil {
+		return err
+	}
+	return this.error("touch", path, os.Chtimes(resolved, modTime, modTime))
+}
+
+func (this *local) Checksum(path string) (string, error) {
+	var handle, err = this.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer handle.Close()
+
+	sum, err := checksum(handle)
+	return sum, this.error("checksum", path, err)
+}
+
+// listable 限制符号链接时，指向根目录之外的符号链接不会出现在列表中
+func (this *local) listable(resolved string) bool {
+	return this.realRoot == "" || this.checkSymlinks(resolved) == nil
+}
+
 func (this *local) Files(directory string) (results []contracts.File) {
-	fileInfos, err := ioutil.ReadDir(this.filepath(directory))
+	resolved, err := this.resolve("list", directory)
+	if err != nil {
+		return
+	}
+	fileInfos, err := ioutil.ReadDir(resolved)
 	if err != nil {
 		return
 	}
 
 	for _, fileInfo := range fileInfos {
-		if !fileInfo.IsDir() {
-			results = append(results, &File{
-				FileInfo: fileInfo,
-				DiskName: this.name,
-				path:     this.filepath(directory + "/" + fileInfo.Name()),
-			})
+		if !fileInfo.IsDir() && this.listable(filepath.Join(resolved, fileInfo.Name())) {
+			results = append(results, this.file(directory+"/"+fileInfo.Name(), fileInfo))
 		}
 	}
 
@@ -197,21 +521,29 @@ func (this *local) Files(directory string) (results []contracts.File) {
 }
 
 func (this *local) AllFiles(directory string) (results []contracts.File) {
-	fileInfos := utils.AllFiles(this.filepath(directory))
-
-	for _, fileInfo := range fileInfos {
-		results = append(results, &File{
-			FileInfo: fileInfo,
-			DiskName: this.name,
-			path:     this.filepath(directory + "/" + fileInfo.Name()),
-		})
+	resolved, err := this.resolve("list", directory)
+	if err != nil {
+		return
 	}
+	_ = filepath.WalkDir(resolved, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || !this.listable(path) {
+			return nil
+		}
+		if fileInfo, infoErr := entry.Info(); infoErr == nil {
+			results = append(results, this.file(filepath.ToSlash(strings.TrimPrefix(path, this.root)), fileInfo))
+		}
+		return nil
+	})
 
 	return
 }
 
 func (this *local) Directories(directory string) (results []string) {
-	fileInfos, err := ioutil.ReadDir(this.filepath(directory))
+	resolved, err := this.resolve("list", directory)
+	if err != nil {
+		return
+	}
+	fileInfos, err := ioutil.ReadDir(resolved)
 	if err != nil {
 		return
 	}
@@ -224,14 +556,35 @@ func (this *local) Directories(directory string) (results []string) {
 	return results
 }
 
-func (this *local) AllDirectories(directory string) []string {
-	return utils.AllDirectories(this.filepath(directory))
+// AllDirectories 获取所有子目录，返回相对于给定目录的路径
+func (this *local) AllDirectories(directory string) (results []string) {
+	resolved, err := this.resolve("list", directory)
+	if err != nil {
+		return
+	}
+	var root = strings.TrimSuffix(resolved, string(filepath.Separator))
+	_ = filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err == nil && entry.IsDir() && path != root {
+			results = append(results, filepath.ToSlash(strings.TrimPrefix(path, root+string(filepath.Separator))))
+		}
+		return nil
+	})
+	sort.Strings(results)
+	return results
 }
 
 func (this *local) MakeDirectory(path string) error {
-	return os.Mkdir(this.filepath(path), this.perm)
+	var resolved, err = this.resolve("mkdir", path)
+	if err != nil {
+		return err
+	}
+	return this.error("mkdir", path, os.MkdirAll(resolved, this.perm))
 }
 
 func (this *local) DeleteDirectory(directory string) error {
-	return os.RemoveAll(this.filepath(directory))
+	var resolved, err = this.resolve("rmdir", directory)
+	if err != nil {
+		return err
+	}
+	return this.error("rmdir", directory, os.RemoveAll(resolved))
 }
@@ -0,0 +1,499 @@
+package adapters
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem/file"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	pathpkg "path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type memoryNode struct {
+	contents []byte
+	perm     fs.FileMode
+	modTime  time.Time
+	isDir    bool
+}
+
+type MemoryFileInfo struct {
+	name    string
+	size    int64
+	perm    fs.FileMode
+	modTime time.Time
+	isDir   bool
+}
+
+func (this MemoryFileInfo) Name() string {
+	return this.name
+}
+
+func (this MemoryFileInfo) Size() int64 {
+	return this.size
+}
+
+func (this MemoryFileInfo) Mode() fs.FileMode {
+	if this.isDir {
+		return this.perm | fs.ModeDir
+	}
+	return this.perm
+}
+
+func (this MemoryFileInfo) ModTime() time.Time {
+	return this.modTime
+}
+
+func (this MemoryFileInfo) IsDir() bool {
+	return this.isDir
+}
+
+func (this MemoryFileInfo) Sys() interface{} {
+	return nil
+}
+
+func MemoryAdapter(name string, config contracts.Fields) contracts.FileSystem {
+	var perm, isPerm = config["perm"].(fs.FileMode)
+	if !isPerm {
+		perm = os.ModePerm
+	}
+	return NewMemoryFileSystem(name, perm)
+}
+
+// NewMemoryFileSystem 创建一个并发安全的内存文件系统，适用于测试以及临时存储
+func NewMemoryFileSystem(name string, perm fs.FileMode) *Memory {
+	return &Memory{
+		name:  name,
+		perm:  perm,
+		nodes: map[string]*memoryNode{"": {isDir: true, perm: perm, modTime: time.Now()}},
+	}
+}
+
+type Memory struct {
+	name  string
+	perm  fs.FileMode
+	mutex sync.RWMutex
+	nodes map[string]*memoryNode
+}
+
+// clean 规范化路径，根目录为空字符串
+func (this *Memory) clean(path string) string {
+	return strings.TrimPrefix(pathpkg.Clean("/"+path), "/")
+}
+
+// error 创建带有磁盘名称和路径的 *file.Error
+func (this *Memory) error(op, path string, err error) error {
+	return file.NewError(op, this.name, path, file.Kind(err), err)
+}
+
+func (this *Memory) parent(path string) string {
+	if index := strings.LastIndex(path, "/"); index >= 0 {
+		return path[:index]
+	}
+	return ""
+}
+
+func (this *Memory) info(path string, node *memoryNode) MemoryFileInfo {
+	return MemoryFileInfo{
+		name:    pathpkg.Base("/" + path),
+		size:    int64(len(node.contents)),
+		perm:    node.perm,
+		modTime: node.modTime,
+		isDir:   node.isDir,
+	}
+}
+
+// file 获取文件节点，调用方需持有锁
+func (this *Memory) file(op, path string) (*memoryNode, error) {
+	var node, exists = this.nodes[path]
+	if !exists {
+		return nil, this.error(op, path, file.ErrNotFound)
+	}
+	if node.isDir {
+		return nil, this.error(op, path, fs.ErrInvalid)
+	}
+	return node, nil
+}
+
+// mkdirAll 递归创建目录，调用方需持有写锁
+func (this *Memory) mkdirAll(op, path string) error {
+	if path == "" {
+		return nil
+	}
+	if node, exists := this.nodes[path]; exists {
+		if node.isDir {
+			return nil
+		}
+		return this.error(op, path, file.ErrNotDirectory)
+	}
+	if err := this.mkdirAll(op, this.parent(path)); err != nil {
+		return err
+	}
+	this.nodes[path] = &memoryNode{isDir: true, perm: this.perm, modTime: time.Now()}
+	return nil
+}
+
+// write 写入文件内容，调用方需持有写锁
+func (this *Memory) write(op, path string, contents []byte) error {
+	if node, exists := this.nodes[path]; exists && node.isDir {
+		return this.error(op, path, fs.ErrInvalid)
+	}
+	if err := this.mkdirAll(op, this.parent(path)); err != nil {
+		return err
+	}
+
+	var perm = this.perm
+	if node, exists := this.nodes[path]; exists {
+		perm = node.perm
+	}
+	this.nodes[path] = &memoryNode{contents: contents, perm: perm, modTime: time.Now()}
+	return nil
+}
+
+// children 获取目录下的子节点路径，recursive 为 true 时包含所有后代，调用方需持有锁
+func (this *Memory) children(directory string, recursive bool) []string {
+	var (
+		prefix = directory + "/"
+		paths  = make([]string, 0)
+	)
+	if directory == "" {
+		prefix = ""
+	}
+	for path := range this.nodes {
+		if path == "" || !strings.HasPrefix(path, prefix) {
+			continue
+		}
+		if recursive || !strings.Contains(strings.TrimPrefix(path, prefix), "/") {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func (this *Memory) Name() string {
+	return this.name
+}
+
+func (this *Memory) Exists(path string) bool {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+
+	var _, exists = this.nodes[this.clean(path)]
+	return exists
+}
+
+func (this *Memory) Get(path string) (string, error) {
+	var contents, err = this.Read(path)
+	return string(contents), err
+}
+
+func (this *Memory) Read(path string) ([]byte, error) {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+
+	var node, err = this.file("read", this.clean(path))
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), node.contents...), nil
+}
+
+func (this *Memory) Open(path string) (io.ReadSeekCloser, error) {
+	var contents, err = this.Read(path)
+	if err != nil {
+		return nil, err
+	}
+	return nopSeekCloser{bytes.NewReader(contents)}, nil
+}
+
+func (this *Memory) ReadRange(path string, offset, length int64) (io.ReadCloser, error) {
+	var contents, err = this.Read(path)
+	if err != nil {
+		return nil, err
+	}
+	if length, err = rangeLength(int64(len(contents)), offset, length); err != nil {
+		return nil, this.error("read", this.clean(path), err)
+	}
+	return ioutil.NopCloser(bytes.NewReader(contents[offset : offset+length])), nil
+}
+
+func (this *Memory) ReadStream(path string) (*bufio.Reader, error) {
+	return ReadStream(this, path)
+}
+
+func (this *Memory) Put(path, contents string) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	return this.write("put", this.clean(path), []byte(contents))
+}
+
+func (this *Memory) WriteStream(path string, contents string) error {
+	return this.Put(path, contents)
+}
+
+func (this *Memory) PutStream(path string, r io.Reader, opts ...file.WriteOption) (int64, error) {
+	var contents, err = ioutil.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	path = this.clean(path)
+	if err = this.write("put", path, contents); err != nil {
+		return 0, err
+	}
+	if options := file.ApplyWriteOptions(opts...); options.Perm != 0 {
+		this.nodes[path].perm = options.Perm.Perm()
+	}
+	return int64(len(contents)), nil
+}
+
+func (this *Memory) GetVisibility(path string) contracts.FileVisibility {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+
+	if node, exists := this.nodes[this.clean(path)]; exists && node.perm&0004 != 0 {
+		return file.VISIBLE
+	}
+	return file.INVISIBLE
+}
+
+func (this *Memory) SetVisibility(path string, perm fs.FileMode) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	path = this.clean(path)
+	var node, exists = this.nodes[path]
+	if !exists {
+		return this.error("chmod", path, file.ErrNotFound)
+	}
+	node.perm = perm.Perm()
+	return nil
+}
+
+func (this *Memory) Prepend(path, contents string) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	path = this.clean(path)
+	var original []byte
+	if node, err := this.file("prepend", path); err == nil {
+		original = node.contents
+	}
+	return this.write("prepend", path, append([]byte(contents), original...))
+}
+
+func (this *Memory) Append(path, contents string) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	path = this.clean(path)
+	var original []byte
+	if node, err := this.file("append", path); err == nil {
+		original = node.contents
+	}
+	return this.write("append", path, append(append([]byte(nil), original...), contents...))
+}
+
+// AppendStream 读取 r 中的内容后追加，读取出错时已经读取的内容同样会追加
+func (this *Memory) AppendStream(path string, r io.Reader) (int64, error) {
+	var contents, readErr = ioutil.ReadAll(r)
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	path = this.clean(path)
+	var original []byte
+	if node, err := this.file("append", path); err == nil {
+		original = node.contents
+	}
+	if err := this.write("append", path, append(append([]byte(nil), original...), contents...)); err != nil {
+		return 0, err
+	}
+	return int64(len(contents)), readErr
+}
+
+// Delete 删除文件或者空目录
+func (this *Memory) Delete(path string) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	path = this.clean(path)
+	var node, exists = this.nodes[path]
+	if !exists || path == "" {
+		return this.error("delete", path, file.ErrNotFound)
+	}
+	if node.isDir && len(this.children(path, false)) > 0 {
+		return this.error("delete", path, fs.ErrInvalid)
+	}
+	delete(this.nodes, path)
+	return nil
+}
+
+func (this *Memory) Copy(from, to string) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	var node, err = this.file("copy", this.clean(from))
+	if err != nil {
+		return err
+	}
+	return this.write("copy", this.clean(to), append([]byte(nil), node.contents...))
+}
+
+// Move 移动文件或者目录，目标已存在时会被覆盖
+func (this *Memory) Move(from, to string) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	from, to = this.clean(from), this.clean(to)
+	var node, exists = this.nodes[from]
+	if !exists || from == "" {
+		return this.error("move", from, file.ErrNotFound)
+	}
+	if to == from || strings.HasPrefix(to, from+"/") {
+		return this.error("move", to, fs.ErrInvalid)
+	}
+	if err := this.mkdirAll("move", this.parent(to)); err != nil {
+		return err
+	}
+
+	if node.isDir {
+		for _, child := range this.children(from, true) {
+			this.nodes[to+strings.TrimPrefix(child, from)] = this.nodes[child]
+			delete(this.nodes, child)
+		}
+	}
+	this.nodes[to] = node
+	delete(this.nodes, from)
+	return nil
+}
+
+func (this *Memory) Size(path string) (int64, error) {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+
+	var node, err = this.file("stat", this.clean(path))
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(node.contents)), nil
+}
+
+func (this *Memory) LastModified(path string) (time.Time, error) {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+
+	path = this.clean(path)
+	var node, exists = this.nodes[path]
+	if !exists {
+		return time.Time{}, this.error("stat", path, file.ErrNotFound)
+	}
+	return node.modTime, nil
+}
+
+func (this *Memory) Touch(path string, modTime time.Time) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	path = this.clean(path)
+	var node, exists = this.nodes[path]
+	if !exists {
+		return this.error("touch", path, file.ErrNotFound)
+	}
+	node.modTime = modTime
+	return nil
+}
+
+func (this *Memory) Checksum(path string) (string, error) {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+
+	var node, err = this.file("checksum", this.clean(path))
+	if err != nil {
+		return "", err
+	}
+	var sum = md5.Sum(node.contents)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func (this *Memory) files(directory string, recursive bool) []contracts.File {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+
+	var files = make([]contracts.File, 0)
+	for _, path := range this.children(this.clean(directory), recursive) {
+		if node := this.nodes[path]; !node.isDir {
+			files = append(files, &MemoryFile{
+				MemoryFileInfo: this.info(path, node),
+				DiskName:       this.name,
+				disk:           this,
+				path:           path,
+			})
+		}
+	}
+	return files
+}
+
+func (this *Memory) Files(directory string) []contracts.File {
+	return this.files(directory, false)
+}
+
+func (this *Memory) AllFiles(directory string) []contracts.File {
+	return this.files(directory, true)
+}
+
+func (this *Memory) directories(directory string, recursive bool) []string {
+	this.mutex.RLock()
+	defer this.mutex.RUnlock()
+
+	directory = this.clean(directory)
+	var directories = make([]string, 0)
+	for _, path := range this.children(directory, recursive) {
+		if this.nodes[path].isDir {
+			directories = append(directories, strings.TrimPrefix(strings.TrimPrefix(path, directory), "/"))
+		}
+	}
+	return directories
+}
+
+func (this *Memory) Directories(directory string) []string {
+	return this.directories(directory, false)
+}
+
+func (this *Memory) AllDirectories(directory string) []string {
+	return this.directories(directory, true)
+}
+
+func (this *Memory) MakeDirectory(path string) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	return this.mkdirAll("mkdir", this.clean(path))
+}
+
+func (this *Memory) DeleteDirectory(directory string) error {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	directory = this.clean(directory)
+	for _, path := range this.children(directory, true) {
+		delete(this.nodes, path)
+	}
+	if directory != "" {
+		delete(this.nodes, directory)
+	}
+	return nil
+}
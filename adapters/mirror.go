@@ -0,0 +1,547 @@
+package adapters
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem/file"
+	"github.com/goal-web/supports/logs"
+	"io"
+	"io/fs"
+	pathpkg "path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// replicaDoneErr 副本已经结束写入，用于停止向该副本分发数据
+var replicaDoneErr = errors.New("mirror: replica finished writing")
+
+// NewMirror 创建镜像磁盘，写入操作会同时发送到所有副本，至少 quorum 个副本成功时视为成功
+// quorum 小于 1 或者大于副本数时要求所有副本都成功
+func NewMirror(name string, replicas []contracts.FileSystem, quorum int) *Mirror {
+	if quorum < 1 || quorum > len(replicas) {
+		quorum = len(replicas)
+	}
+	return &Mirror{name: name, replicas: replicas, quorum: quorum, divergences: map[string]*Divergence{}}
+}
+
+// Mirror 镜像磁盘，读取操作按顺序使用第一个成功的副本，跳过该路径存在分歧的副本，列表操作使用第一个副本
+type Mirror struct {
+	name        string
+	replicas    []contracts.FileSystem
+	quorum      int
+	mutex       sync.Mutex
+	divergences map[string]*Divergence
+}
+
+// Divergence 部分副本没有成功写入的路径，Missed 为这些副本的名称
+type Divergence struct {
+	Path   string
+	Op     string
+	Missed []string
+	Errors map[string]error
+	Time   time.Time
+}
+
+// MirrorError 成功写入的副本数没有达到 quorum
+type MirrorError struct {
+	Op        string
+	Path      string
+	Succeeded int
+	Quorum    int
+	Errors    map[string]error
+	first     error
+}
+
+func (this *MirrorError) Error() string {
+	return fmt.Sprintf("mirror: %s %s succeeded on %d replicas, %d required: %v", this.Op, this.Path, this.Succeeded, this.Quorum, this.first)
+}
+
+// Unwrap 返回第一个失败副本的错误，可以通过 errors.Is 判断错误类型
+func (this *MirrorError) Unwrap() error {
+	return this.first
+}
+
+// fanoutWriter 将数据写入所有仍在接收的副本，某个副本出错后不再向其写入
+type fanoutWriter struct {
+	writers []*io.PipeWriter
+	dead    []bool
+}
+
+func (this *fanoutWriter) Write(p []byte) (int, error) {
+	var alive = 0
+	for i, writer := range this.writers {
+		if this.dead[i] {
+			continue
+		}
+		if _, err := writer.Write(p); err != nil {
+			this.dead[i] = true
+			continue
+		}
+		alive++
+	}
+	if alive == 0 {
+		return 0, replicaDoneErr
+	}
+	return len(p), nil
+}
+
+// Replicas 获取所有副本
+func (this *Mirror) Replicas() []contracts.FileSystem {
+	return append([]contracts.FileSystem(nil), this.replicas...)
+}
+
+// Divergences 获取所有存在分歧的路径，按路径排序
+func (this *Mirror) Divergences() []Divergence {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	var results = make([]Divergence, 0, len(this.divergences))
+	for _, divergence := range this.divergences {
+		results = append(results, *divergence)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Path < results[j].Path
+	})
+	return results
+}
+
+// Repair 将存在分歧的路径从成功写入的副本同步到缺失写入的副本，修复成功的路径会从分歧列表中移除
+func (this *Mirror) Repair() error {
+	var failed error
+	for _, divergence := range this.Divergences() {
+		if err := this.repair(divergence); err != nil {
+			logs.WithError(err).WithField("path", divergence.Path).Warn("Mirror.Repair: repair replica failed")
+			if failed == nil {
+				failed = err
+			}
+			continue
+		}
+		this.resolve(divergence.Path)
+	}
+	return failed
+}
+
+func (this *Mirror) repair(divergence Divergence) error {
+	var (
+		missed = make(map[string]bool)
+		source contracts.FileSystem
+	)
+	for _, name := range divergence.Missed {
+		missed[name] = true
+	}
+	for _, replica := range this.replicas {
+		if !missed[replica.Name()] {
+			source = replica
+			break
+		}
+	}
+	if source == nil {
+		return file.NewError("repair", this.name, divergence.Path, file.ErrNotFound, errors.New("no replica holds the latest write"))
+	}
+
+	for _, replica := range this.replicas {
+		if !missed[replica.Name()] {
+			continue
+		}
+		var err error
+		switch {
+		case divergence.Op == "mkdir":
+			err = replica.MakeDirectory(divergence.Path)
+		case divergence.Op == "rmdir":
+			err = replica.DeleteDirectory(divergence.Path)
+		case source.Exists(divergence.Path):
+			_, err = Transfer(source, divergence.Path, replica, divergence.Path)
+		case replica.Exists(divergence.Path):
+			err = replica.Delete(divergence.Path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// key 与内置适配器一样规范化路径，a.txt 与 /a.txt 共用同一个分歧记录
+func (this *Mirror) key(path string) string {
+	return strings.TrimPrefix(pathpkg.Clean("/"+path), "/")
+}
+
+// overwrites 判断操作是否会让所有副本中该路径的内容完全一致
+// 追加、修改权限等操作只修改一部分，即使全部成功，之前缺失写入的副本仍然是旧的内容，分歧只能由 Repair 修复
+func overwrites(op string) bool {
+	switch op {
+	case "put", "write", "delete", "copy", "move", "mkdir", "rmdir":
+		return true
+	}
+	return false
+}
+
+func (this *Mirror) resolve(paths ...string) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	for _, path := range paths {
+		delete(this.divergences, this.key(path))
+	}
+}
+
+func (this *Mirror) diverge(op string, paths []string, errs map[string]error) {
+	var missed = make([]string, 0, len(errs))
+	for name := range errs {
+		missed = append(missed, name)
+	}
+	sort.Strings(missed)
+
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	for _, path := range paths {
+		path = this.key(path)
+		var (
+			divergence = &Divergence{Path: path, Op: op, Errors: make(map[string]error, len(errs)), Time: time.Now()}
+			existing   = this.divergences[path]
+		)
+		// 只修改一部分的操作不能修复之前的分歧，合并缺失写入的副本
+		if existing != nil && !overwrites(op) {
+			divergence.Op = existing.Op
+			for name, err := range existing.Errors {
+				divergence.Errors[name] = err
+			}
+		}
+		for name, err := range errs {
+			divergence.Errors[name] = err
+		}
+		for name := range divergence.Errors {
+			divergence.Missed = append(divergence.Missed, name)
+		}
+		sort.Strings(divergence.Missed)
+		this.divergences[path] = divergence
+	}
+	logs.WithField("paths", paths).WithField("replicas", missed).
+		Warn(fmt.Sprintf("Mirror.%s: replicas diverged on disk %s", op, this.name))
+}
+
+// write 并发地在所有副本上执行写入操作，paths 为受影响的路径
+func (this *Mirror) write(op string, paths []string, write func(index int, replica contracts.FileSystem) error) error {
+	var (
+		wg      sync.WaitGroup
+		results = make([]error, len(this.replicas))
+	)
+	for i, replica := range this.replicas {
+		wg.Add(1)
+		go func(i int, replica contracts.FileSystem) {
+			defer wg.Done()
+			results[i] = write(i, replica)
+		}(i, replica)
+	}
+	wg.Wait()
+
+	var (
+		errs  = make(map[string]error)
+		first error
+	)
+	for i, err := range results {
+		if err != nil {
+			errs[this.replicas[i].Name()] = err
+			if first == nil {
+				first = err
+			}
+		}
+	}
+
+	var succeeded = len(this.replicas) - len(errs)
+	switch {
+	case len(errs) == 0:
+		if overwrites(op) {
+			this.resolve(paths...)
+		}
+	case succeeded > 0:
+		this.diverge(op, paths, errs)
+	}
+	if succeeded >= this.quorum {
+		return nil
+	}
+	var path = strings.Join(paths, ", ")
+	return file.Wrap(op, this.name, path, &MirrorError{Op: op, Path: path, Succeeded: succeeded, Quorum: this.quorum, Errors: errs, first: first})
+}
+
+// healthy 获取 path 没有分歧的副本，缺失写入的副本中的内容可能已经过期，不参与读取
+func (this *Mirror) healthy(path string) []contracts.FileSystem {
+	this.mutex.Lock()
+	var divergence = this.divergences[this.key(path)]
+	this.mutex.Unlock()
+	if divergence == nil {
+		return this.replicas
+	}
+
+	var (
+		missed   = make(map[string]bool, len(divergence.Missed))
+		replicas = make([]contracts.FileSystem, 0, len(this.replicas))
+	)
+	for _, name := range divergence.Missed {
+		missed[name] = true
+	}
+	for _, replica := range this.replicas {
+		if !missed[replica.Name()] {
+			replicas = append(replicas, replica)
+		}
+	}
+	return replicas
+}
+
+// read 按顺序在 path 没有分歧的副本上执行读取操作，返回第一个成功的结果
+func (this *Mirror) read(path string, read func(replica contracts.FileSystem) error) error {
+	var first error
+	for _, replica := range this.healthy(path) {
+		var err = read(replica)
+		if err == nil {
+			return nil
+		}
+		if first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+func (this *Mirror) Name() string {
+	return this.name
+}
+
+func (this *Mirror) Exists(path string) bool {
+	for _, replica := range this.healthy(path) {
+		if replica.Exists(path) {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *Mirror) Get(path string) (contents string, err error) {
+	err = this.read(path, func(replica contracts.FileSystem) (err error) {
+		contents, err = replica.Get(path)
+		return
+	})
+	return
+}
+
+func (this *Mirror) Read(path string) (contents []byte, err error) {
+	err = this.read(path, func(replica contracts.FileSystem) (err error) {
+		contents, err = replica.Read(path)
+		return
+	})
+	return
+}
+
+func (this *Mirror) Open(path string) (handle io.ReadSeekCloser, err error) {
+	err = this.read(path, func(replica contracts.FileSystem) (err error) {
+		handle, err = Open(replica, path)
+		return
+	})
+	return
+}
+
+func (this *Mirror) ReadRange(path string, offset, length int64) (reader io.ReadCloser, err error) {
+	err = this.read(path, func(replica contracts.FileSystem) (err error) {
+		reader, err = ReadRange(replica, path, offset, length)
+		return
+	})
+	return
+}
+
+func (this *Mirror) ReadStream(path string) (reader *bufio.Reader, err error) {
+	err = this.read(path, func(replica contracts.FileSystem) (err error) {
+		reader, err = replica.ReadStream(path)
+		return
+	})
+	return
+}
+
+func (this *Mirror) Checksum(path string) (sum string, err error) {
+	err = this.read(path, func(replica contracts.FileSystem) (err error) {
+		sum, err = Checksum(replica, path)
+		return
+	})
+	return
+}
+
+// SupportsUrls 任意一个副本可以生成地址时返回 true
+func (this *Mirror) SupportsUrls() bool {
+	for _, replica := range this.replicas {
+		if SupportsUrls(replica) {
+			return true
+		}
+	}
+	return false
+}
+
+// Url 使用第一个可以生成地址的副本
+func (this *Mirror) Url(path string) (url string) {
+	_ = this.read(path, func(replica contracts.FileSystem) (err error) {
+		url, err = Url(replica, path)
+		return
+	})
+	return
+}
+
+func (this *Mirror) TemporaryUrl(path string, ttl time.Duration, opts ...file.UrlOption) (url string, err error) {
+	err = this.read(path, func(replica contracts.FileSystem) (err error) {
+		url, err = TemporaryUrl(replica, path, ttl, opts...)
+		return
+	})
+	return
+}
+
+func (this *Mirror) Put(path, contents string) error {
+	return this.write("put", []string{path}, func(_ int, replica contracts.FileSystem) error {
+		return replica.Put(path, contents)
+	})
+}
+
+func (this *Mirror) WriteStream(path string, contents string) error {
+	return this.write("write", []string{path}, func(_ int, replica contracts.FileSystem) error {
+		return replica.WriteStream(path, contents)
+	})
+}
+
+// PutStream 只读取一次 r，通过管道同时写入所有副本
+func (this *Mirror) PutStream(path string, r io.Reader, opts ...file.WriteOption) (int64, error) {
+	var (
+		readers = make([]*io.PipeReader, len(this.replicas))
+		fanout  = &fanoutWriter{writers: make([]*io.PipeWriter, len(this.replicas)), dead: make([]bool, len(this.replicas))}
+		done    = make(chan struct{})
+		written int64
+		copyErr error
+	)
+	for i := range this.replicas {
+		readers[i], fanout.writers[i] = io.Pipe()
+	}
+	go func() {
+		defer close(done)
+		written, copyErr = io.Copy(fanout, r)
+		if copyErr == replicaDoneErr {
+			copyErr = nil
+		}
+		for _, writer := range fanout.writers {
+			_ = writer.CloseWithError(copyErr)
+		}
+	}()
+
+	var err = this.write("write", []string{path}, func(index int, replica contracts.FileSystem) error {
+		var _, err = PutStream(replica, path, readers[index], opts...)
+		_ = readers[index].CloseWithError(replicaDoneErr)
+		return err
+	})
+	<-done
+
+	if err == nil && copyErr != nil {
+		err = file.Wrap("write", this.name, path, copyErr)
+	}
+	return written, err
+}
+
+func (this *Mirror) GetVisibility(path string) (visibility contracts.FileVisibility) {
+	for _, replica := range this.healthy(path) {
+		if replica.Exists(path) {
+			return replica.GetVisibility(path)
+		}
+	}
+	return file.INVISIBLE
+}
+
+func (this *Mirror) SetVisibility(path string, perm fs.FileMode) error {
+	return this.write("chmod", []string{path}, func(_ int, replica contracts.FileSystem) error {
+		return replica.SetVisibility(path, perm)
+	})
+}
+
+func (this *Mirror) Touch(path string, modTime time.Time) error {
+	return this.write("touch", []string{path}, func(_ int, replica contracts.FileSystem) error {
+		return Touch(replica, path, modTime)
+	})
+}
+
+func (this *Mirror) Prepend(path, contents string) error {
+	return this.write("prepend", []string{path}, func(_ int, replica contracts.FileSystem) error {
+		return replica.Prepend(path, contents)
+	})
+}
+
+func (this *Mirror) Append(path, contents string) error {
+	return this.write("append", []string{path}, func(_ int, replica contracts.FileSystem) error {
+		return replica.Append(path, contents)
+	})
+}
+
+func (this *Mirror) Delete(path string) error {
+	return this.write("delete", []string{path}, func(_ int, replica contracts.FileSystem) error {
+		return replica.Delete(path)
+	})
+}
+
+func (this *Mirror) Copy(from, to string) error {
+	return this.write("copy", []string{to}, func(_ int, replica contracts.FileSystem) error {
+		return replica.Copy(from, to)
+	})
+}
+
+func (this *Mirror) Move(from, to string) error {
+	return this.write("move", []string{from, to}, func(_ int, replica contracts.FileSystem) error {
+		return replica.Move(from, to)
+	})
+}
+
+func (this *Mirror) Size(path string) (size int64, err error) {
+	err = this.read(path, func(replica contracts.FileSystem) (err error) {
+		size, err = replica.Size(path)
+		return
+	})
+	return
+}
+
+func (this *Mirror) LastModified(path string) (modTime time.Time, err error) {
+	err = this.read(path, func(replica contracts.FileSystem) (err error) {
+		modTime, err = replica.LastModified(path)
+		return
+	})
+	return
+}
+
+// files 将副本中的文件转换为当前磁盘的文件
+func (this *Mirror) files(files []contracts.File) []contracts.File {
+	return wrapFiles(this.name, files, func(path string) (string, bool) {
+		return path, true
+	})
+}
+
+func (this *Mirror) Files(directory string) []contracts.File {
+	return this.files(this.replicas[0].Files(directory))
+}
+
+func (this *Mirror) AllFiles(directory string) []contracts.File {
+	return this.files(this.replicas[0].AllFiles(directory))
+}
+
+func (this *Mirror) Directories(directory string) []string {
+	return this.replicas[0].Directories(directory)
+}
+
+func (this *Mirror) AllDirectories(directory string) []string {
+	return this.replicas[0].AllDirectories(directory)
+}
+
+func (this *Mirror) MakeDirectory(path string) error {
+	return this.write("mkdir", []string{path}, func(_ int, replica contracts.FileSystem) error {
+		return replica.MakeDirectory(path)
+	})
+}
+
+func (this *Mirror) DeleteDirectory(directory string) error {
+	return this.write("rmdir", []string{directory}, func(_ int, replica contracts.FileSystem) error {
+		return replica.DeleteDirectory(directory)
+	})
+}
@@ -0,0 +1,438 @@
+package adapters
+
+import (
+	"bufio"
+	"errors"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem/file"
+	"io"
+	"io/fs"
+	pathpkg "path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// NoMountErr 路径没有对应的挂载点
+var NoMountErr = errors.New("no disk is mounted at path")
+
+type mountPoint struct {
+	prefix string
+	disk   contracts.FileSystem
+}
+
+// NewMount 创建一个将多个磁盘挂载到不同前缀下的虚拟磁盘，前缀为空表示挂载到根目录，最长的前缀优先匹配
+func NewMount(name string, mounts map[string]contracts.FileSystem) *Mount {
+	var points = make([]mountPoint, 0, len(mounts))
+	for prefix, disk := range mounts {
+		points = append(points, mountPoint{prefix: strings.TrimPrefix(pathpkg.Clean("/"+prefix), "/"), disk: disk})
+	}
+	sort.Slice(points, func(i, j int) bool {
+		if len(points[i].prefix) != len(points[j].prefix) {
+			return len(points[i].prefix) > len(points[j].prefix)
+		}
+		return points[i].prefix < points[j].prefix
+	})
+	return &Mount{name: name, mounts: points}
+}
+
+// Mount 挂载多个磁盘的虚拟磁盘，挂载点之间的复制和移动会通过流完成
+type Mount struct {
+	name   string
+	mounts []mountPoint
+}
+
+func (this *Mount) clean(path string) string {
+	return strings.TrimPrefix(pathpkg.Clean("/"+path), "/")
+}
+
+// join 将挂载点内的路径转换为虚拟磁盘中的路径
+func (this *Mount) join(prefix, path string) string {
+	return strings.TrimPrefix(prefix+"/"+strings.TrimPrefix(path, "/"), "/")
+}
+
+// contains 判断 path 是否位于 prefix 下（包括 prefix 本身）
+func (this *Mount) contains(prefix, path string) bool {
+	return prefix == "" || path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+// route 获取路径对应的挂载点以及挂载点内的路径
+func (this *Mount) route(path string) (*mountPoint, string) {
+	path = this.clean(path)
+	for i := range this.mounts {
+		if this.contains(this.mounts[i].prefix, path) {
+			return &this.mounts[i], strings.TrimPrefix(strings.TrimPrefix(path, this.mounts[i].prefix), "/")
+		}
+	}
+	return nil, ""
+}
+
+// nested 获取位于 directory 下（不包括 directory 本身）的挂载点
+func (this *Mount) nested(directory string) (points []*mountPoint) {
+	directory = this.clean(directory)
+	for i := range this.mounts {
+		if this.mounts[i].prefix != directory && this.contains(directory, this.mounts[i].prefix) {
+			points = append(points, &this.mounts[i])
+		}
+	}
+	return
+}
+
+// owns 判断虚拟磁盘中的路径是否由给定挂载点负责，被更深的挂载点覆盖的路径不属于该挂载点
+func (this *Mount) owns(point *mountPoint, path string) bool {
+	var routed, _ = this.route(path)
+	return routed == point
+}
+
+// error 将挂载磁盘的错误转换为当前磁盘的名称和路径
+func (this *Mount) error(op, path string, point *mountPoint, err error) error {
+	if err == nil {
+		return nil
+	}
+	if point == nil {
+		return file.NewError(op, this.name, this.clean(path), file.ErrNotFound, NoMountErr)
+	}
+	var wrapped *file.Error
+	if !errors.As(err, &wrapped) {
+		return file.Wrap(op, this.name, this.clean(path), err)
+	}
+	var mounted = *wrapped
+	mounted.Disk, mounted.Path = this.name, this.join(point.prefix, wrapped.Path)
+	return &mounted
+}
+
+func (this *Mount) files(point *mountPoint, files []contracts.File) []contracts.File {
+	return wrapFiles(this.name, files, func(path string) (string, bool) {
+		path = this.join(point.prefix, path)
+		return path, this.owns(point, path)
+	})
+}
+
+func (this *Mount) Name() string {
+	return this.name
+}
+
+// Exists 挂载点的上级目录也视为存在
+func (this *Mount) Exists(path string) bool {
+	if point, inner := this.route(path); point != nil && point.disk.Exists(inner) {
+		return true
+	}
+	return len(this.nested(path)) > 0
+}
+
+func (this *Mount) Get(path string) (string, error) {
+	var contents, err = this.Read(path)
+	return string(contents), err
+}
+
+func (this *Mount) Read(path string) ([]byte, error) {
+	var point, inner = this.route(path)
+	if point == nil {
+		return nil, this.error("read", path, nil, NoMountErr)
+	}
+	var contents, err = point.disk.Read(inner)
+	return contents, this.error("read", path, point, err)
+}
+
+func (this *Mount) Open(path string) (io.ReadSeekCloser, error) {
+	var point, inner = this.route(path)
+	if point == nil {
+		return nil, this.error("open", path, nil, NoMountErr)
+	}
+	var handle, err = Open(point.disk, inner)
+	return handle, this.error("open", path, point, err)
+}
+
+func (this *Mount) ReadRange(path string, offset, length int64) (io.ReadCloser, error) {
+	var point, inner = this.route(path)
+	if point == nil {
+		return nil, this.error("read", path, nil, NoMountErr)
+	}
+	var reader, err = ReadRange(point.disk, inner, offset, length)
+	return reader, this.error("read", path, point, err)
+}
+
+func (this *Mount) ReadStream(path string) (*bufio.Reader, error) {
+	var point, inner = this.route(path)
+	if point == nil {
+		return nil, this.error("read", path, nil, NoMountErr)
+	}
+	var reader, err = point.disk.ReadStream(inner)
+	return reader, this.error("read", path, point, err)
+}
+
+// write 在路径对应的挂载点上执行写入操作
+func (this *Mount) write(op, path string, write func(disk contracts.FileSystem, path string) error) error {
+	var point, inner = this.route(path)
+	if point == nil {
+		return this.error(op, path, nil, NoMountErr)
+	}
+	return this.error(op, path, point, write(point.disk, inner))
+}
+
+func (this *Mount) Checksum(path string) (string, error) {
+	var point, inner = this.route(path)
+	if point == nil {
+		return "", this.error("checksum", path, nil, NoMountErr)
+	}
+	var sum, err = Checksum(point.disk, inner)
+	return sum, this.error("checksum", path, point, err)
+}
+
+// SupportsUrls 任意一个挂载的磁盘可以生成地址时返回 true
+func (this *Mount) SupportsUrls() bool {
+	for _, point := range this.mounts {
+		if SupportsUrls(point.disk) {
+			return true
+		}
+	}
+	return false
+}
+
+func (this *Mount) Url(path string) string {
+	var point, inner = this.route(path)
+	if point == nil {
+		return ""
+	}
+	var url, _ = Url(point.disk, inner)
+	return url
+}
+
+func (this *Mount) TemporaryUrl(path string, ttl time.Duration, opts ...file.UrlOption) (string, error) {
+	var point, inner = this.route(path)
+	if point == nil {
+		return "", this.error("url", path, nil, NoMountErr)
+	}
+	var url, err = TemporaryUrl(point.disk, inner, ttl, opts...)
+	return url, this.error("url", path, point, err)
+}
+
+func (this *Mount) Put(path, contents string) error {
+	return this.write("put", path, func(disk contracts.FileSystem, path string) error {
+		return disk.Put(path, contents)
+	})
+}
+
+func (this *Mount) WriteStream(path string, contents string) error {
+	return this.write("write", path, func(disk contracts.FileSystem, path string) error {
+		return disk.WriteStream(path, contents)
+	})
+}
+
+func (this *Mount) PutStream(path string, r io.Reader, opts ...file.WriteOption) (written int64, err error) {
+	err = this.write("write", path, func(disk contracts.FileSystem, path string) (err error) {
+		written, err = PutStream(disk, path, r, opts...)
+		return
+	})
+	return
+}
+
+func (this *Mount) GetVisibility(path string) contracts.FileVisibility {
+	if point, inner := this.route(path); point != nil {
+		return point.disk.GetVisibility(inner)
+	}
+	return file.INVISIBLE
+}
+
+func (this *Mount) SetVisibility(path string, perm fs.FileMode) error {
+	return this.write("chmod", path, func(disk contracts.FileSystem, path string) error {
+		return disk.SetVisibility(path, perm)
+	})
+}
+
+func (this *Mount) Prepend(path, contents string) error {
+	return this.write("prepend", path, func(disk contracts.FileSystem, path string) error {
+		return disk.Prepend(path, contents)
+	})
+}
+
+func (this *Mount) Append(path, contents string) error {
+	return this.write("append", path, func(disk contracts.FileSystem, path string) error {
+		return disk.Append(path, contents)
+	})
+}
+
+func (this *Mount) Delete(path string) error {
+	return this.write("delete", path, func(disk contracts.FileSystem, path string) error {
+		return disk.Delete(path)
+	})
+}
+
+// Copy 同一个磁盘内直接复制，不同磁盘之间通过流复制
+func (this *Mount) Copy(from, to string) error {
+	var source, sourcePath = this.route(from)
+	if source == nil {
+		return this.error("copy", from, nil, NoMountErr)
+	}
+	var destination, destinationPath = this.route(to)
+	if destination == nil {
+		return this.error("copy", to, nil, NoMountErr)
+	}
+
+	if source.disk == destination.disk {
+		return this.error("copy", to, destination, source.disk.Copy(sourcePath, destinationPath))
+	}
+	if _, err := Transfer(source.disk, sourcePath, destination.disk, destinationPath); err != nil {
+		var wrapped *file.Error
+		if errors.As(err, &wrapped) && wrapped.Disk == source.disk.Name() {
+			return this.error("copy", from, source, err)
+		}
+		return this.error("copy", to, destination, err)
+	}
+	return nil
+}
+
+// Move 同一个磁盘内直接移动，不同磁盘之间先复制再删除源文件
+func (this *Mount) Move(from, to string) error {
+	var source, sourcePath = this.route(from)
+	if source == nil {
+		return this.error("move", from, nil, NoMountErr)
+	}
+	var destination, destinationPath = this.route(to)
+	if destination == nil {
+		return this.error("move", to, nil, NoMountErr)
+	}
+
+	if source.disk == destination.disk {
+		return this.error("move", to, destination, source.disk.Move(sourcePath, destinationPath))
+	}
+	if err := this.Copy(from, to); err != nil {
+		return err
+	}
+	return this.error("move", from, source, source.disk.Delete(sourcePath))
+}
+
+func (this *Mount) Size(path string) (int64, error) {
+	var point, inner = this.route(path)
+	if point == nil {
+		return 0, this.error("stat", path, nil, NoMountErr)
+	}
+	var size, err = point.disk.Size(inner)
+	return size, this.error("stat", path, point, err)
+}
+
+func (this *Mount) LastModified(path string) (time.Time, error) {
+	var point, inner = this.route(path)
+	if point == nil {
+		return time.Time{}, this.error("stat", path, nil, NoMountErr)
+	}
+	var modTime, err = point.disk.LastModified(inner)
+	return modTime, this.error("stat", path, point, err)
+}
+
+func (this *Mount) Touch(path string, modTime time.Time) error {
+	return this.write("touch", path, func(disk contracts.FileSystem, path string) error {
+		return Touch(disk, path, modTime)
+	})
+}
+
+func (this *Mount) Files(directory string) []contracts.File {
+	var point, inner = this.route(directory)
+	if point == nil {
+		return []contracts.File{}
+	}
+	return this.files(point, point.disk.Files(inner))
+}
+
+// AllFiles 包含 directory 下所有挂载点中的文件
+func (this *Mount) AllFiles(directory string) []contracts.File {
+	var results = make([]contracts.File, 0)
+	if point, inner := this.route(directory); point != nil {
+		results = append(results, this.files(point, point.disk.AllFiles(inner))...)
+	}
+	for _, point := range this.nested(directory) {
+		results = append(results, this.files(point, point.disk.AllFiles(""))...)
+	}
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].(file.File).Path() < results[j].(file.File).Path()
+	})
+	return results
+}
+
+// directories 合并挂载磁盘中的目录以及挂载点形成的虚拟目录
+func (this *Mount) directories(directory string, recursive bool) []string {
+	directory = this.clean(directory)
+	var (
+		exists = make(map[string]bool)
+		add    = func(path string) {
+			var relative = strings.TrimPrefix(strings.TrimPrefix(path, directory), "/")
+			if !recursive {
+				relative = strings.SplitN(relative, "/", 2)[0]
+			}
+			if relative != "" {
+				exists[relative] = true
+			}
+		}
+		list = func(point *mountPoint, inner string) {
+			var children []string
+			if recursive {
+				children = point.disk.AllDirectories(inner)
+			} else {
+				children = point.disk.Directories(inner)
+			}
+			for _, child := range children {
+				var path = this.join(point.prefix, pathpkg.Join(inner, child))
+				if this.owns(point, path) || this.isMountPoint(path) {
+					add(path)
+				}
+			}
+		}
+	)
+
+	if point, inner := this.route(directory); point != nil {
+		list(point, inner)
+	}
+	for _, point := range this.nested(directory) {
+		// 挂载点以及它的所有上级目录
+		for path := point.prefix; path != "." && this.contains(directory, path) && path != directory; path = pathpkg.Dir(path) {
+			add(path)
+		}
+		if recursive {
+			list(point, "")
+		}
+	}
+
+	var results = make([]string, 0, len(exists))
+	for path := range exists {
+		results = append(results, path)
+	}
+	sort.Strings(results)
+	return results
+}
+
+func (this *Mount) isMountPoint(path string) bool {
+	for _, point := range this.mounts {
+		if point.prefix == path {
+			return true
+		}
+	}
+	return false
+}
+
+// Directories 根目录会列出所有挂载点
+func (this *Mount) Directories(directory string) []string {
+	return this.directories(directory, false)
+}
+
+func (this *Mount) AllDirectories(directory string) []string {
+	return this.directories(directory, true)
+}
+
+func (this *Mount) MakeDirectory(path string) error {
+	return this.write("mkdir", path, func(disk contracts.FileSystem, path string) error {
+		return disk.MakeDirectory(path)
+	})
+}
+
+// DeleteDirectory 同时清空 directory 下所有挂载点中的内容，挂载点本身依然存在
+func (this *Mount) DeleteDirectory(directory string) error {
+	for _, point := range this.nested(directory) {
+		if err := point.disk.DeleteDirectory(""); err != nil {
+			return this.error("rmdir", point.prefix, point, err)
+		}
+	}
+	if point, inner := this.route(directory); point != nil {
+		return this.error("rmdir", directory, point, point.disk.DeleteDirectory(inner))
+	}
+	return nil
+}
@@ -3,20 +3,27 @@ package adapters
 import (
 	"bufio"
 	"context"
+	"errors"
 	"github.com/goal-web/contracts"
 	"github.com/goal-web/filesystem/file"
 	"github.com/goal-web/supports/logs"
 	"github.com/goal-web/supports/utils"
 	"github.com/qiniu/go-sdk/v7/auth/qbox"
 	"github.com/qiniu/go-sdk/v7/storage"
+	"io"
 	"io/fs"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
+	"sort"
 	"strings"
 	"time"
 )
 
+// qiniuBatchLimit 七牛单次批量操作的最大数量
+const qiniuBatchLimit = 1000
+
 type QiniuFileInfo struct {
 	isDir bool
 	*storage.FileInfo
@@ -112,68 +119,122 @@ func (qiniu *Qiniu) PolicyToken(policy storage.PutPolicy) string {
 	return policy.UploadToken(qiniu.mac)
 }
 
+// Url 获取文件的访问地址，私有空间的地址使用 ttl 配置的有效期签名
 func (qiniu *Qiniu) Url(key string) string {
 	if qiniu.private {
-		return storage.MakePrivateURL(qiniu.mac, qiniu.domain, key, time.Now().Add(qiniu.ttl).Unix())
+		return storage.MakePrivateURL(qiniu.mac, qiniu.domain, key, time.Now().Add(urlTTL(0, qiniu.ttl)).Unix())
 	}
 	return storage.MakePublicURL(qiniu.domain, key)
 }
 
-func (qiniu *Qiniu) Exists(path string) bool {
-	var _, err = qiniu.bucketManager.Stat(qiniu.bucket, path)
-	if err != nil {
-		return false
-	}
-	return true
-}
-
-func (qiniu *Qiniu) Get(path string) (string, error) {
+// TemporaryUrl 获取在 ttl 之后过期的访问地址，公开空间的地址不会过期
+func (qiniu *Qiniu) TemporaryUrl(key string, ttl time.Duration, opts ...file.UrlOption) (string, error) {
 	var (
-		url   = qiniu.Url(path)
-		bytes []byte
+		options = file.ApplyUrlOptions(opts...)
+		query   url.Values
 	)
+	if options.Download != "" {
+		query = url.Values{"attname": {options.Download}}
+	}
+	if qiniu.private {
+		return storage.MakePrivateURLv2WithQuery(qiniu.mac, qiniu.domain, key, query, time.Now().Add(urlTTL(ttl, qiniu.ttl)).Unix()), nil
+	}
+	return storage.MakePublicURLv2WithQuery(qiniu.domain, key, query), nil
+}
+
+// error 将七牛的错误码转换为 file 包中的错误类型
+func (qiniu *Qiniu) error(op, path string, err error) error {
+	var info *storage.ErrorInfo
+	if errors.As(err, &info) {
+		var kind = statusKind(info.Code)
+		switch info.Code {
+		case 612, 631: // 文件或空间不存在
+			kind = file.ErrNotFound
+		case 614: // 目标文件已存在
+			kind = file.ErrAlreadyExists
+		}
+		if kind != nil {
+			return file.NewError(op, qiniu.name, path, kind, err)
+		}
+	}
+	return file.Wrap(op, qiniu.name, path, err)
+}
 
-	var res, err = http.Get(url)
+// download 通过 Url 生成的地址下载文件，非 2xx 的响应会被转换为错误
+func (qiniu *Qiniu) download(path, rangeHeader string) (*http.Response, error) {
+	var req, err = http.NewRequest(http.MethodGet, qiniu.Url(path), nil)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+	if rangeHeader != "" {
+		req.Header.Set("Range", rangeHeader)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		_ = res.Body.Close()
+		return nil, &HttpStatusError{StatusCode: res.StatusCode, Status: res.Status}
 	}
+	return res, nil
+}
 
-	bytes, err = ioutil.ReadAll(res.Body)
+func (qiniu *Qiniu) Exists(path string) bool {
+	var _, err = qiniu.bucketManager.Stat(qiniu.bucket, path)
+	if err == nil {
+		return true
+	}
+
+	// 可能是目录
+	var entries, commonPrefixes, _, _, listErr = qiniu.bucketManager.ListFiles(qiniu.bucket, qiniu.prefix(path), "/", "", 1)
+	return listErr == nil && (len(entries) > 0 || len(commonPrefixes) > 0)
+}
 
+func (qiniu *Qiniu) Get(path string) (string, error) {
+	var bytes, err = qiniu.Read(path)
 	return string(bytes), err
 }
 
 func (qiniu *Qiniu) Read(path string) ([]byte, error) {
-	var (
-		url   = qiniu.Url(path)
-		bytes []byte
-	)
-	var res, err = http.Get(url)
+	var res, err = qiniu.download(path, "")
 	if err != nil {
-		return nil, err
+		return nil, qiniu.error("read", path, err)
 	}
+	defer res.Body.Close()
 
-	bytes, err = ioutil.ReadAll(res.Body)
-
-	return bytes, err
+	bytes, err := ioutil.ReadAll(res.Body)
+	return bytes, qiniu.error("read", path, err)
 }
 
-func (qiniu *Qiniu) ReadStream(path string) (*bufio.Reader, error) {
-	var (
-		url string
-	)
-	if qiniu.private {
-		url = storage.MakePrivateURL(qiniu.mac, qiniu.domain, path, time.Now().Add(qiniu.ttl).Unix())
-	} else {
-		url = storage.MakePublicURL(qiniu.domain, path)
+// Open 打开文件，通过 HTTP Range 请求实现定位
+func (qiniu *Qiniu) Open(path string) (io.ReadSeekCloser, error) {
+	var stat, err = qiniu.bucketManager.Stat(qiniu.bucket, path)
+	if err != nil {
+		return nil, qiniu.error("open", path, err)
 	}
 
-	var res, err = http.Get(url)
+	return newRangeReader(stat.Fsize, func(offset int64) (*http.Response, error) {
+		return qiniu.download(path, rangeHeader(offset))
+	}), nil
+}
+
+// ReadRange 在 Url 生成的地址上发起 Range 请求读取部分内容
+func (qiniu *Qiniu) ReadRange(path string, offset, length int64) (io.ReadCloser, error) {
+	var stat, err = qiniu.bucketManager.Stat(qiniu.bucket, path)
 	if err != nil {
-		return nil, err
+		return nil, qiniu.error("read", path, err)
 	}
 
-	return bufio.NewReader(res.Body), err
+	reader, err := httpRange(stat.Fsize, offset, length, func(header string) (*http.Response, error) {
+		return qiniu.download(path, header)
+	})
+	return reader, qiniu.error("read", path, err)
+}
+
+// ReadStream 读取到末尾后会自动关闭响应，需要手动关闭时请使用 Open
+func (qiniu *Qiniu) ReadStream(path string) (*bufio.Reader, error) {
+	return ReadStream(qiniu, path)
 }
 
 func (qiniu *Qiniu) Put(path, contents string) error {
@@ -193,13 +254,31 @@ func (qiniu *Qiniu) Put(path, contents string) error {
 		}
 	)
 
-	return uploader.Put(context.Background(), &ret, token, path, reader, reader.Size(), extra)
+	return qiniu.error("put", path, uploader.Put(context.Background(), &ret, token, path, reader, reader.Size(), extra))
 }
 
 func (qiniu *Qiniu) WriteStream(path string, contents string) error {
 	return qiniu.Put(path, contents)
 }
 
+// PutStream 使用分片上传 v2 流式上传，不需要预先知道文件大小
+func (qiniu *Qiniu) PutStream(path string, r io.Reader, opts ...file.WriteOption) (int64, error) {
+	var (
+		options  = file.ApplyWriteOptions(opts...)
+		token    = qiniu.UploadToken(path)
+		uploader = storage.NewResumeUploaderV2(qiniu.bucketConfig)
+		reader   = &countingReader{Reader: r}
+		ret      = storage.PutRet{}
+		extra    = &storage.RputV2Extra{
+			MimeType: options.ContentType,
+			Metadata: options.Metadata,
+		}
+	)
+
+	var err = uploader.PutWithoutSize(context.Background(), &ret, token, path, reader, extra)
+	return reader.count, qiniu.error("write", path, err)
+}
+
 func (qiniu *Qiniu) GetVisibility(path string) contracts.FileVisibility {
 	if qiniu.private {
 		return file.INVISIBLE
@@ -207,37 +286,43 @@ func (qiniu *Qiniu) GetVisibility(path string) contracts.FileVisibility {
 	return file.VISIBLE
 }
 
-// SetVisibility 七牛不支持修改单个文件的可见性
+// SetVisibility 七牛不支持修改单个文件的可见性，可见性由空间的 private 配置决定
 func (qiniu *Qiniu) SetVisibility(path string, perm fs.FileMode) error {
-	return nil
+	return file.NewError("chmod", qiniu.name, path, file.ErrUnsupported, nil)
 }
 
 func (qiniu *Qiniu) Prepend(path, contents string) error {
-	var raw, _ = qiniu.Get(path)
+	var raw, err = qiniu.Get(path)
+	if err != nil && !errors.Is(err, file.ErrNotFound) {
+		return err
+	}
 	return qiniu.Put(path, contents+raw)
 }
 
 func (qiniu *Qiniu) Append(path, contents string) error {
-	var raw, _ = qiniu.Get(path)
+	var raw, err = qiniu.Get(path)
+	if err != nil && !errors.Is(err, file.ErrNotFound) {
+		return err
+	}
 	return qiniu.Put(path, raw+contents)
 }
 
 func (qiniu *Qiniu) Delete(path string) error {
-	return qiniu.bucketManager.Delete(qiniu.bucket, path)
+	return qiniu.error("delete", path, qiniu.bucketManager.Delete(qiniu.bucket, path))
 }
 
 func (qiniu *Qiniu) Copy(from, to string) error {
-	return qiniu.bucketManager.Copy(qiniu.bucket, from, qiniu.bucket, to, true)
+	return qiniu.error("copy", from, qiniu.bucketManager.Copy(qiniu.bucket, from, qiniu.bucket, to, true))
 }
 
 func (qiniu *Qiniu) Move(from, to string) error {
-	return qiniu.bucketManager.Move(qiniu.bucket, from, qiniu.bucket, to, true)
+	return qiniu.error("move", from, qiniu.bucketManager.Move(qiniu.bucket, from, qiniu.bucket, to, true))
 }
 
 func (qiniu *Qiniu) Size(path string) (int64, error) {
 	var stat, err = qiniu.bucketManager.Stat(qiniu.bucket, path)
 	if err != nil {
-		return 0, err
+		return 0, qiniu.error("stat", path, err)
 	}
 
 	return stat.Fsize, nil
@@ -246,63 +331,51 @@ func (qiniu *Qiniu) Size(path string) (int64, error) {
 func (qiniu *Qiniu) LastModified(path string) (time.Time, error) {
 	var stat, err = qiniu.bucketManager.Stat(qiniu.bucket, path)
 	if err != nil {
-		return time.Time{}, err
+		return time.Time{}, qiniu.error("stat", path, err)
 	}
 
-	return storage.ParsePutTime(stat.PutTime), err
+	return storage.ParsePutTime(stat.PutTime), nil
 }
 
-func (qiniu *Qiniu) Files(directory string) []contracts.File {
+// prefix 将目录转换为列举用的前缀
+func (qiniu *Qiniu) prefix(directory string) string {
+	directory = strings.Trim(directory, "/")
+	if directory == "" {
+		return ""
+	}
+	return directory + "/"
+}
+
+func (qiniu *Qiniu) list(prefix, delimiter string, handler func(entries []storage.ListItem, commonPrefixes []string)) error {
 	var (
-		limit     = 1000
-		delimiter = ""
-		marker    = ""
-		files     = make([]contracts.File, 0)
+		limit  = 1000
+		marker = ""
 	)
 	//初始列举marker为空
 	for {
-		var entries, _, nextMarker, hashNext, err = qiniu.bucketManager.ListFiles(qiniu.bucket, directory, delimiter, marker, limit)
+		var entries, commonPrefixes, nextMarker, hashNext, err = qiniu.bucketManager.ListFiles(qiniu.bucket, prefix, delimiter, marker, limit)
 		if err != nil {
-			logs.WithError(err).WithField("dir", directory).Debug("Qiniu.Files: ListFiles failed")
-			break
-		}
-		//print entries
-		for _, entry := range entries {
-			files = append(files, &QiniuFile{
-				disk: qiniu,
-				QiniuFileInfo: QiniuFileInfo{
-					ListItem: &entry,
-					name:     entry.Key,
-				},
-				DiskName: qiniu.Name(),
-			})
+			return err
 		}
+		handler(entries, commonPrefixes)
 		if hashNext {
 			marker = nextMarker
 		} else {
 			//list end
-			break
+			return nil
 		}
 	}
-	return files
 }
 
-func (qiniu *Qiniu) AllFiles(directory string) []contracts.File {
-	var (
-		limit     = 1000
-		delimiter = ""
-		marker    = ""
-		files     = make([]contracts.File, 0)
-	)
-	//初始列举marker为空
-	for {
-		var entries, _, nextMarker, hashNext, err = qiniu.bucketManager.ListFiles(qiniu.bucket, directory, delimiter, marker, limit)
-		if err != nil {
-			logs.WithError(err).WithField("dir", directory).Warn("Qiniu.Files: ListFiles failed")
-			break
-		}
-		//print entries
-		for _, entry := range entries {
+func (qiniu *Qiniu) files(directory, delimiter string) []contracts.File {
+	var files = make([]contracts.File, 0)
+	var err = qiniu.list(qiniu.prefix(directory), delimiter, func(entries []storage.ListItem, _ []string) {
+		for i := range entries {
+			var entry = entries[i]
+			// 以分隔符结尾的是目录标记
+			if strings.HasSuffix(entry.Key, "/") {
+				continue
+			}
 			files = append(files, &QiniuFile{
 				disk: qiniu,
 				QiniuFileInfo: QiniuFileInfo{
@@ -312,50 +385,100 @@ func (qiniu *Qiniu) AllFiles(directory string) []contracts.File {
 				DiskName: qiniu.Name(),
 			})
 		}
-		if hashNext {
-			marker = nextMarker
-		} else {
-			//list end
-			break
-		}
+	})
+	if err != nil {
+		logs.WithError(err).WithField("dir", directory).Debug("Qiniu.Files: ListFiles failed")
 	}
 	return files
 }
 
+func (qiniu *Qiniu) Files(directory string) []contracts.File {
+	return qiniu.files(directory, "/")
+}
+
+func (qiniu *Qiniu) AllFiles(directory string) []contracts.File {
+	return qiniu.files(directory, "")
+}
+
 func (qiniu *Qiniu) Directories(directory string) []string {
-	return nil
+	var (
+		prefix      = qiniu.prefix(directory)
+		directories = make([]string, 0)
+	)
+	var err = qiniu.list(prefix, "/", func(_ []storage.ListItem, commonPrefixes []string) {
+		for _, commonPrefix := range commonPrefixes {
+			directories = append(directories, strings.TrimSuffix(strings.TrimPrefix(commonPrefix, prefix), "/"))
+		}
+	})
+	if err != nil {
+		logs.WithError(err).WithField("dir", directory).Debug("Qiniu.Directories: ListFiles failed")
+	}
+	sort.Strings(directories)
+	return directories
 }
 
+// AllDirectories 七牛没有真实目录，通过文件名推导出所有层级的目录
 func (qiniu *Qiniu) AllDirectories(directory string) []string {
-	return nil
+	var (
+		prefix = qiniu.prefix(directory)
+		exists = make(map[string]bool)
+	)
+	var err = qiniu.list(prefix, "", func(entries []storage.ListItem, _ []string) {
+		for _, entry := range entries {
+			var segments = strings.Split(strings.TrimPrefix(entry.Key, prefix), "/")
+			for i := 1; i < len(segments); i++ {
+				exists[strings.Join(segments[:i], "/")] = true
+			}
+		}
+	})
+	if err != nil {
+		logs.WithError(err).WithField("dir", directory).Debug("Qiniu.AllDirectories: ListFiles failed")
+	}
+
+	var directories = make([]string, 0, len(exists))
+	for dir := range exists {
+		directories = append(directories, dir)
+	}
+	sort.Strings(directories)
+	return directories
 }
 
+// MakeDirectory 写入一个以分隔符结尾的空文件作为目录标记
 func (qiniu *Qiniu) MakeDirectory(path string) error {
-	return nil
+	return qiniu.error("mkdir", path, qiniu.Put(qiniu.prefix(path), ""))
 }
 
 func (qiniu *Qiniu) DeleteDirectory(directory string) error {
-	var (
-		files = qiniu.Files(directory)
-		keys  = make([]string, 0, len(files))
-	)
-	for _, item := range files {
-		keys = append(keys, storage.URIDelete(qiniu.bucket, item.Name()))
+	var keys = make([]string, 0)
+	var listErr = qiniu.list(qiniu.prefix(directory), "", func(entries []storage.ListItem, _ []string) {
+		for _, entry := range entries {
+			keys = append(keys, storage.URIDelete(qiniu.bucket, entry.Key))
+		}
+	})
+	if listErr != nil {
+		return qiniu.error("rmdir", directory, listErr)
 	}
-	rets, err := qiniu.bucketManager.Batch(keys)
-	if err != nil {
-		// 遇到错误
-		if _, ok := err.(*storage.ErrorInfo); ok {
-			for _, ret := range rets {
-				// 200 为成功
-				if ret.Code != 200 {
-					logs.WithError(err).WithField("ret", ret).Debug("Qiniu.DeleteDirectory: delete directory failed")
+	// 七牛单次批量操作最多 1000 个
+	for start := 0; start < len(keys); start += qiniuBatchLimit {
+		var end = start + qiniuBatchLimit
+		if end > len(keys) {
+			end = len(keys)
+		}
+		rets, err := qiniu.bucketManager.Batch(keys[start:end])
+		if err != nil {
+			// 遇到错误
+			if _, ok := err.(*storage.ErrorInfo); ok {
+				for _, ret := range rets {
+					// 200 为成功
+					if ret.Code != 200 {
+						logs.WithError(err).WithField("ret", ret).Debug("Qiniu.DeleteDirectory: delete directory failed")
+					}
 				}
+			} else {
+				logs.WithError(err).WithField("rets", rets).Debug("Qiniu.DeleteDirectory: delete directory failed")
 			}
-		} else {
-			logs.WithError(err).WithField("rets", rets).Debug("Qiniu.DeleteDirectory: delete directory failed")
+			return qiniu.error("rmdir", directory, err)
 		}
-		return err
 	}
 	return nil
 }
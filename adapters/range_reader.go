@@ -0,0 +1,163 @@
+package adapters
+
+import (
+	"errors"
+	"fmt"
+	"github.com/goal-web/filesystem/file"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+var InvalidSeekErr = errors.New("seek: invalid offset")
+
+// HttpStatusError HTTP 请求返回了非预期的状态码
+type HttpStatusError struct {
+	StatusCode int
+	Status     string
+}
+
+func (this *HttpStatusError) Error() string {
+	return "unexpected http status: " + this.Status
+}
+
+// Is 根据状态码匹配 file 包中的错误类型，例如 404 与 fs.ErrNotExist 等价
+func (this *HttpStatusError) Is(target error) bool {
+	var kind = statusKind(this.StatusCode)
+	return kind != nil && errors.Is(kind, target)
+}
+
+// statusKind 获取 HTTP 状态码对应的错误类型，无法识别时返回 nil
+func statusKind(code int) error {
+	switch code {
+	case http.StatusNotFound, http.StatusGone:
+		return file.ErrNotFound
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return file.ErrPermission
+	case http.StatusRequestedRangeNotSatisfiable:
+		return file.ErrInvalidRange
+	}
+	return nil
+}
+
+// rangeReader 通过 HTTP Range 请求模拟可定位的读取句柄，只有在读取时才会发起请求
+type rangeReader struct {
+	size   int64
+	offset int64
+	body   io.ReadCloser
+	open   func(offset int64) (*http.Response, error)
+}
+
+func newRangeReader(size int64, open func(offset int64) (*http.Response, error)) *rangeReader {
+	return &rangeReader{size: size, open: open}
+}
+
+func (this *rangeReader) Read(p []byte) (int, error) {
+	if this.offset >= this.size {
+		return 0, io.EOF
+	}
+	if this.body == nil {
+		var res, err = this.open(this.offset)
+		if err != nil {
+			return 0, err
+		}
+		if this.body, err = rangeBody(res, this.offset); err != nil {
+			return 0, err
+		}
+	}
+
+	var n, err = this.body.Read(p)
+	this.offset += int64(n)
+	return n, err
+}
+
+func (this *rangeReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += this.offset
+	case io.SeekEnd:
+		offset += this.size
+	default:
+		return 0, InvalidSeekErr
+	}
+	if offset < 0 {
+		return 0, InvalidSeekErr
+	}
+
+	if offset != this.offset && this.body != nil {
+		_ = this.body.Close()
+		this.body = nil
+	}
+	this.offset = offset
+	return offset, nil
+}
+
+func (this *rangeReader) Close() error {
+	if this.body == nil {
+		return nil
+	}
+	var err = this.body.Close()
+	this.body = nil
+	return err
+}
+
+func rangeHeader(offset int64) string {
+	return fmt.Sprintf("bytes=%d-", offset)
+}
+
+// rangeBody 检查 Range 请求的响应，返回从 offset 开始的内容
+func rangeBody(res *http.Response, offset int64) (io.ReadCloser, error) {
+	switch res.StatusCode {
+	case http.StatusPartialContent:
+		return res.Body, nil
+	case http.StatusOK:
+		// 服务端忽略了 Range 请求头，跳过前面的内容
+		if _, err := io.CopyN(ioutil.Discard, res.Body, offset); err != nil {
+			_ = res.Body.Close()
+			return nil, err
+		}
+		return res.Body, nil
+	default:
+		_ = res.Body.Close()
+		return nil, &HttpStatusError{StatusCode: res.StatusCode, Status: res.Status}
+	}
+}
+
+// rangeLength 校验读取范围并返回实际读取的长度
+func rangeLength(size, offset, length int64) (int64, error) {
+	if offset < 0 || offset > size {
+		return 0, file.ErrInvalidRange
+	}
+	if length < 0 || offset+length > size {
+		length = size - offset
+	}
+	return length, nil
+}
+
+// httpRange 发起 Range 请求读取 [offset, offset+length) 的内容
+func httpRange(size, offset, length int64, do func(header string) (*http.Response, error)) (io.ReadCloser, error) {
+	var err error
+	if length, err = rangeLength(size, offset, length); err != nil {
+		return nil, err
+	}
+	if length == 0 {
+		return ioutil.NopCloser(strings.NewReader("")), nil
+	}
+
+	res, err := do(fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	if err != nil {
+		return nil, err
+	}
+	body, err := rangeBody(res, offset)
+	if err != nil {
+		return nil, err
+	}
+	return limitedReadCloser{Reader: io.LimitReader(body, length), Closer: body}, nil
+}
+
+type limitedReadCloser struct {
+	io.Reader
+	io.Closer
+}
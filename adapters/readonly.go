@@ -0,0 +1,105 @@
+package adapters
+
+import (
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem/file"
+	"io"
+	"io/fs"
+	"time"
+)
+
+// NewReadOnly 创建只读磁盘，所有写入操作都会返回 file.ErrReadOnly，读取操作直接交给 disk
+func NewReadOnly(name string, disk contracts.FileSystem) *ReadOnly {
+	return &ReadOnly{FileSystem: disk, name: name}
+}
+
+type ReadOnly struct {
+	contracts.FileSystem
+	name string
+}
+
+func (this *ReadOnly) error(op, path string) error {
+	return file.NewError(op, this.name, path, file.ErrReadOnly, nil)
+}
+
+// Unwrap 获取被包装的磁盘
+func (this *ReadOnly) Unwrap() contracts.FileSystem {
+	return this.FileSystem
+}
+
+func (this *ReadOnly) Name() string {
+	return this.name
+}
+
+func (this *ReadOnly) Open(path string) (io.ReadSeekCloser, error) {
+	return Open(this.FileSystem, path)
+}
+
+func (this *ReadOnly) ReadRange(path string, offset, length int64) (io.ReadCloser, error) {
+	return ReadRange(this.FileSystem, path, offset, length)
+}
+
+func (this *ReadOnly) Checksum(path string) (string, error) {
+	return Checksum(this.FileSystem, path)
+}
+
+func (this *ReadOnly) SupportsUrls() bool {
+	return SupportsUrls(this.FileSystem)
+}
+
+func (this *ReadOnly) Url(path string) string {
+	var url, _ = Url(this.FileSystem, path)
+	return url
+}
+
+func (this *ReadOnly) TemporaryUrl(path string, ttl time.Duration, opts ...file.UrlOption) (string, error) {
+	return TemporaryUrl(this.FileSystem, path, ttl, opts...)
+}
+
+func (this *ReadOnly) Put(path, contents string) error {
+	return this.error("put", path)
+}
+
+func (this *ReadOnly) WriteStream(path string, contents string) error {
+	return this.error("write", path)
+}
+
+func (this *ReadOnly) PutStream(path string, r io.Reader, opts ...file.WriteOption) (int64, error) {
+	return 0, this.error("write", path)
+}
+
+func (this *ReadOnly) SetVisibility(path string, perm fs.FileMode) error {
+	return this.error("chmod", path)
+}
+
+func (this *ReadOnly) Prepend(path, contents string) error {
+	return this.error("prepend", path)
+}
+
+func (this *ReadOnly) Append(path, contents string) error {
+	return this.error("append", path)
+}
+
+func (this *ReadOnly) Delete(path string) error {
+	return this.error("delete", path)
+}
+
+func (this *ReadOnly) Copy(from, to string) error {
+	return this.error("copy", to)
+}
+
+func (this *ReadOnly) Move(from, to string) error {
+	return this.error("move", from)
+}
+
+func (this *ReadOnly) Touch(path string, modTime time.Time) error {
+	return this.error("touch", path)
+}
+
+func (this *ReadOnly) MakeDirectory(path string) error {
+	return this.error("mkdir", path)
+}
+
+func (this *ReadOnly) DeleteDirectory(directory string) error {
+	return this.error("rmdir", directory)
+}
@@ -0,0 +1,813 @@
+package adapters
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem/file"
+	"github.com/goal-web/supports/logs"
+	"github.com/goal-web/supports/utils"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	s3BatchDeleteLimit = 1000
+	s3DefaultPartSize  = 8 << 20
+	s3MaxPresignTTL    = 7 * 24 * time.Hour
+)
+
+type S3FileInfo struct {
+	name         string
+	size         int64
+	lastModified time.Time
+	isDir        bool
+}
+
+func (this S3FileInfo) Name() string {
+	return this.name
+}
+
+func (this S3FileInfo) Size() int64 {
+	return this.size
+}
+
+func (this S3FileInfo) Mode() fs.FileMode {
+	return os.ModePerm
+}
+
+func (this S3FileInfo) ModTime() time.Time {
+	return this.lastModified
+}
+
+func (this S3FileInfo) IsDir() bool {
+	return this.isDir
+}
+
+func (this S3FileInfo) Sys() interface{} {
+	return nil
+}
+
+// S3Error S3 协议返回的错误
+type S3Error struct {
+	StatusCode int
+	Code       string `xml:"Code"`
+	Message    string `xml:"Message"`
+	Key        string `xml:"Key"`
+}
+
+func (this *S3Error) Error() string {
+	return fmt.Sprintf("s3: %d %s: %s", this.StatusCode, this.Code, this.Message)
+}
+
+// Is 根据错误码以及状态码匹配 file 包中的错误类型，例如 NoSuchKey 与 fs.ErrNotExist 等价
+func (this *S3Error) Is(target error) bool {
+	var kind = statusKind(this.StatusCode)
+	switch this.Code {
+	case "NoSuchKey", "NoSuchBucket":
+		kind = file.ErrNotFound
+	case "AccessDenied":
+		kind = file.ErrPermission
+	case "InvalidRange":
+		kind = file.ErrInvalidRange
+	}
+	return kind != nil && errors.Is(kind, target)
+}
+
+func S3Adapter(name string, config contracts.Fields) contracts.FileSystem {
+	var client, _ = config["client"].(*http.Client)
+	return NewS3FileSystem(name, S3Config{
+		Endpoint:     utils.GetStringField(config, "endpoint"),
+		Region:       utils.GetStringField(config, "region", "us-east-1"),
+		Bucket:       utils.GetStringField(config, "bucket"),
+		AccessKey:    utils.GetStringField(config, "access_key"),
+		SecretKey:    utils.GetStringField(config, "secret_key"),
+		SessionToken: utils.GetStringField(config, "session_token"),
+		PathStyle:    utils.GetBoolField(config, "path_style"),
+		PartSize:     utils.GetInt64Field(config, "part_size", s3DefaultPartSize),
+		TTL:          time.Duration(utils.GetIntField(config, "ttl")) * time.Second,
+		Client:       client,
+	})
+}
+
+type S3Config struct {
+	// Endpoint 服务地址，例如 https://s3.amazonaws.com 或者 http://127.0.0.1:9000
+	Endpoint     string
+	Region       string
+	Bucket       string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	// PathStyle 使用 endpoint/bucket/key 形式的地址，MinIO 等自建服务通常需要开启
+	PathStyle bool
+	// PartSize 流式上传时每个分片的大小，S3 要求除最后一个分片外不小于 5MB
+	PartSize int64
+	// TTL 预签名地址默认的有效期，为 0 时使用 DefaultUrlTTL
+	TTL    time.Duration
+	Client *http.Client
+}
+
+func NewS3FileSystem(name string, config S3Config) *S3 {
+	var endpoint, err = url.Parse(config.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		panic(fmt.Errorf("invalid s3 endpoint: %s", config.Endpoint))
+	}
+	if config.Client == nil {
+		config.Client = http.DefaultClient
+	}
+	if config.PartSize <= 0 {
+		config.PartSize = s3DefaultPartSize
+	}
+
+	return &S3{
+		name:     name,
+		bucket:   config.Bucket,
+		endpoint: endpoint,
+		client:   config.Client,
+		path:     config.PathStyle,
+		partSize: config.PartSize,
+		ttl:      config.TTL,
+		signer: &s3Signer{
+			accessKey:    config.AccessKey,
+			secretKey:    config.SecretKey,
+			sessionToken: config.SessionToken,
+			region:       config.Region,
+		},
+	}
+}
+
+type S3 struct {
+	name     string
+	bucket   string
+	endpoint *url.URL
+	path     bool
+	partSize int64
+	ttl      time.Duration
+	client   *http.Client
+	signer   *s3Signer
+}
+
+type s3Object struct {
+	Key          string    `xml:"Key"`
+	LastModified time.Time `xml:"LastModified"`
+	Size         int64     `xml:"Size"`
+}
+
+type s3ListResult struct {
+	IsTruncated           bool       `xml:"IsTruncated"`
+	Contents              []s3Object `xml:"Contents"`
+	CommonPrefixes        []string   `xml:"CommonPrefixes>Prefix"`
+	NextContinuationToken string     `xml:"NextContinuationToken"`
+}
+
+type s3CompletedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+type s3CompleteRequest struct {
+	XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+	Parts   []s3CompletedPart `xml:"Part"`
+}
+
+type s3DeleteRequest struct {
+	XMLName xml.Name         `xml:"Delete"`
+	Quiet   bool             `xml:"Quiet"`
+	Objects []s3DeleteObject `xml:"Object"`
+}
+
+type s3DeleteObject struct {
+	Key string `xml:"Key"`
+}
+
+type s3DeleteResult struct {
+	Errors []S3Error `xml:"Error"`
+}
+
+func (this *S3) Name() string {
+	return this.name
+}
+
+func (this *S3) Bucket() string {
+	return this.bucket
+}
+
+// Url 获取对象的地址，只有公开读的存储桶可以直接访问，私有对象请使用 TemporaryUrl
+func (this *S3) Url(path string) string {
+	return this.objectUrl(this.key(path), nil).String()
+}
+
+// TemporaryUrl 获取预签名的下载地址，S3 要求有效期不超过 7 天
+func (this *S3) TemporaryUrl(path string, ttl time.Duration, opts ...file.UrlOption) (string, error) {
+	ttl = urlTTL(ttl, this.ttl)
+	if ttl > s3MaxPresignTTL {
+		return "", this.error("url", path, fmt.Errorf("%w: s3 presigned urls expire in at most 7 days", fs.ErrInvalid))
+	}
+
+	var (
+		options = file.ApplyUrlOptions(opts...)
+		query   = url.Values{}
+	)
+	if options.Download != "" {
+		query.Set("response-content-disposition", mime.FormatMediaType("attachment", map[string]string{"filename": options.Download}))
+	}
+	if options.ContentType != "" {
+		query.Set("response-content-type", options.ContentType)
+	}
+	return this.signer.Presign(http.MethodGet, this.objectUrl(this.key(path), query), ttl, time.Now()), nil
+}
+
+// key 将路径转换为对象键，去掉开头的分隔符
+func (this *S3) key(path string) string {
+	return strings.TrimPrefix(path, "/")
+}
+
+// prefix 将目录转换为列举用的前缀
+func (this *S3) prefix(directory string) string {
+	directory = strings.Trim(directory, "/")
+	if directory == "" {
+		return ""
+	}
+	return directory + "/"
+}
+
+func (this *S3) objectUrl(key string, query url.Values) *url.URL {
+	var u = *this.endpoint
+	if this.path {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + this.bucket
+		if key != "" {
+			u.Path += "/" + key
+		}
+	} else {
+		u.Host = this.bucket + "." + u.Host
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/" + key
+	}
+	u.RawPath = s3EncodePath(u.Path)
+	if query != nil {
+		u.RawQuery = s3CanonicalQuery(query)
+	}
+	return &u
+}
+
+func (this *S3) do(method, key string, query url.Values, header http.Header, body io.Reader, payloadHash string) (*http.Response, error) {
+	var req, err = http.NewRequest(method, this.objectUrl(key, query).String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	this.signer.Sign(req, payloadHash, time.Now())
+
+	res, err := this.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode >= 300 {
+		defer res.Body.Close()
+		return nil, this.responseError(res)
+	}
+
+	return res, nil
+}
+
+// error 将原始错误转换为带有磁盘名称和路径的 *file.Error
+func (this *S3) error(op, path string, err error) error {
+	return file.Wrap(op, this.name, path, err)
+}
+
+func (this *S3) responseError(res *http.Response) error {
+	var (
+		s3Err     = &S3Error{StatusCode: res.StatusCode}
+		body, _   = ioutil.ReadAll(res.Body)
+		decodeErr = xml.Unmarshal(body, s3Err)
+	)
+	if decodeErr != nil || s3Err.Code == "" {
+		s3Err.Code = http.StatusText(res.StatusCode)
+	}
+	return s3Err
+}
+
+func (this *S3) head(path string) (*http.Response, error) {
+	var res, err = this.do(http.MethodHead, this.key(path), nil, nil, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	_ = res.Body.Close()
+	return res, nil
+}
+
+func (this *S3) list(prefix, delimiter string, handler func(result *s3ListResult)) error {
+	var token = ""
+	for {
+		var query = url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if delimiter != "" {
+			query.Set("delimiter", delimiter)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		var res, err = this.do(http.MethodGet, "", query, nil, nil, "")
+		if err != nil {
+			return err
+		}
+
+		var result s3ListResult
+		err = xml.NewDecoder(res.Body).Decode(&result)
+		_ = res.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		handler(&result)
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func (this *S3) files(directory, delimiter string) []contracts.File {
+	var (
+		prefix = this.prefix(directory)
+		files  = make([]contracts.File, 0)
+	)
+	var err = this.list(prefix, delimiter, func(result *s3ListResult) {
+		for _, object := range result.Contents {
+			if strings.HasSuffix(object.Key, "/") {
+				continue
+			}
+			files = append(files, &S3File{
+				S3FileInfo: S3FileInfo{
+					name:         object.Key,
+					size:         object.Size,
+					lastModified: object.LastModified,
+				},
+				DiskName: this.name,
+				disk:     this,
+			})
+		}
+	})
+	if err != nil {
+		logs.WithError(err).WithField("dir", directory).Debug("S3.Files: ListObjectsV2 failed")
+	}
+	return files
+}
+
+func (this *S3) Exists(path string) bool {
+	if _, err := this.head(path); err == nil {
+		return true
+	}
+
+	var exists = false
+	_ = this.list(this.prefix(path), "/", func(result *s3ListResult) {
+		exists = exists || len(result.Contents) > 0 || len(result.CommonPrefixes) > 0
+	})
+	return exists
+}
+
+func (this *S3) Get(path string) (string, error) {
+	var contents, err = this.Read(path)
+	return string(contents), err
+}
+
+func (this *S3) Read(path string) ([]byte, error) {
+	var res, err = this.do(http.MethodGet, this.key(path), nil, nil, nil, "")
+	if err != nil {
+		return nil, this.error("read", path, err)
+	}
+	defer res.Body.Close()
+
+	contents, err := ioutil.ReadAll(res.Body)
+	return contents, this.error("read", path, err)
+}
+
+// Open 打开对象，通过 HTTP Range 请求实现定位
+func (this *S3) Open(path string) (io.ReadSeekCloser, error) {
+	var size, err = this.Size(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var key = this.key(path)
+	return newRangeReader(size, func(offset int64) (*http.Response, error) {
+		return this.do(http.MethodGet, key, nil, http.Header{"Range": {rangeHeader(offset)}}, nil, "")
+	}), nil
+}
+
+func (this *S3) ReadRange(path string, offset, length int64) (io.ReadCloser, error) {
+	var size, err = this.Size(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var key = this.key(path)
+	reader, err := httpRange(size, offset, length, func(header string) (*http.Response, error) {
+		return this.do(http.MethodGet, key, nil, http.Header{"Range": {header}}, nil, "")
+	})
+	return reader, this.error("read", path, err)
+}
+
+// ReadStream 读取到末尾后会自动关闭响应，需要手动关闭时请使用 Open
+func (this *S3) ReadStream(path string) (*bufio.Reader, error) {
+	return ReadStream(this, path)
+}
+
+func (this *S3) Put(path, contents string) error {
+	var res, err = this.do(http.MethodPut, this.key(path), nil, nil, strings.NewReader(contents), "")
+	if err != nil {
+		return this.error("put", path, err)
+	}
+	return res.Body.Close()
+}
+
+func (this *S3) WriteStream(path string, contents string) error {
+	return this.Put(path, contents)
+}
+
+func (this *S3) writeHeader(options file.WriteOptions) http.Header {
+	var header = http.Header{}
+	if options.ContentType != "" {
+		header.Set("Content-Type", options.ContentType)
+	}
+	for key, value := range options.Metadata {
+		header.Set("X-Amz-Meta-"+key, value)
+	}
+	if options.Perm != 0 {
+		header.Set("X-Amz-Acl", s3Acl(options.Perm))
+	}
+	return header
+}
+
+// PutStream 流式上传，内容不超过一个分片时直接上传，否则使用分片上传
+func (this *S3) PutStream(path string, r io.Reader, opts ...file.WriteOption) (int64, error) {
+	var (
+		key    = this.key(path)
+		header = this.writeHeader(file.ApplyWriteOptions(opts...))
+		buffer = make([]byte, this.partSize)
+	)
+
+	var n, err = io.ReadFull(r, buffer)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		var res, putErr = this.do(http.MethodPut, key, nil, header, bytes.NewReader(buffer[:n]), "")
+		if putErr != nil {
+			return 0, this.error("write", path, putErr)
+		}
+		return int64(n), res.Body.Close()
+	}
+	if err != nil {
+		return 0, this.error("write", path, err)
+	}
+
+	uploadId, err := this.createMultipartUpload(key, header)
+	if err != nil {
+		return 0, this.error("write", path, err)
+	}
+
+	var (
+		parts   []s3CompletedPart
+		written int64
+	)
+	for number := 1; n > 0; number++ {
+		var etag, uploadErr = this.uploadPart(key, uploadId, number, buffer[:n])
+		if uploadErr != nil {
+			this.abortMultipartUpload(key, uploadId)
+			return written, this.error("write", path, uploadErr)
+		}
+		parts = append(parts, s3CompletedPart{PartNumber: number, ETag: etag})
+		written += int64(n)
+
+		n, err = io.ReadFull(r, buffer)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			this.abortMultipartUpload(key, uploadId)
+			return written, this.error("write", path, err)
+		}
+	}
+
+	if err = this.completeMultipartUpload(key, uploadId, parts); err != nil {
+		this.abortMultipartUpload(key, uploadId)
+		return written, this.error("write", path, err)
+	}
+	return written, nil
+}
+
+func (this *S3) createMultipartUpload(key string, header http.Header) (string, error) {
+	var res, err = this.do(http.MethodPost, key, url.Values{"uploads": {""}}, header, nil, "")
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+
+	var result struct {
+		UploadId string `xml:"UploadId"`
+	}
+	if err = xml.NewDecoder(res.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	return result.UploadId, nil
+}
+
+func (this *S3) uploadPart(key, uploadId string, number int, part []byte) (string, error) {
+	var query = url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {uploadId}}
+	var res, err = this.do(http.MethodPut, key, query, nil, bytes.NewReader(part), "")
+	if err != nil {
+		return "", err
+	}
+	_ = res.Body.Close()
+	return res.Header.Get("ETag"), nil
+}
+
+func (this *S3) completeMultipartUpload(key, uploadId string, parts []s3CompletedPart) error {
+	var body, err = xml.Marshal(s3CompleteRequest{Parts: parts})
+	if err != nil {
+		return err
+	}
+
+	res, err := this.do(http.MethodPost, key, url.Values{"uploadId": {uploadId}}, nil, bytes.NewReader(body), "")
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// 合并失败时 S3 也可能返回 200 状态码，需要检查响应体
+	var completeErr = &S3Error{StatusCode: res.StatusCode}
+	if respBody, _ := ioutil.ReadAll(res.Body); xml.Unmarshal(respBody, completeErr) == nil && completeErr.Code != "" {
+		return completeErr
+	}
+	return nil
+}
+
+func (this *S3) abortMultipartUpload(key, uploadId string) {
+	var res, err = this.do(http.MethodDelete, key, url.Values{"uploadId": {uploadId}}, nil, nil, "")
+	if err != nil {
+		logs.WithError(err).WithField("key", key).Debug("S3.PutStream: abort multipart upload failed")
+		return
+	}
+	_ = res.Body.Close()
+}
+
+func (this *S3) GetVisibility(path string) contracts.FileVisibility {
+	var res, err = this.do(http.MethodGet, this.key(path), url.Values{"acl": {""}}, nil, nil, "")
+	if err != nil {
+		return file.INVISIBLE
+	}
+	defer res.Body.Close()
+
+	var policy struct {
+		Grants []struct {
+			URI        string `xml:"Grantee>URI"`
+			Permission string `xml:"Permission"`
+		} `xml:"AccessControlList>Grant"`
+	}
+	if err = xml.NewDecoder(res.Body).Decode(&policy); err != nil {
+		return file.INVISIBLE
+	}
+	for _, grant := range policy.Grants {
+		if strings.HasSuffix(grant.URI, "/AllUsers") && (grant.Permission == "READ" || grant.Permission == "FULL_CONTROL") {
+			return file.VISIBLE
+		}
+	}
+	return file.INVISIBLE
+}
+
+func s3Acl(perm fs.FileMode) string {
+	if perm&0004 != 0 {
+		return "public-read"
+	}
+	return "private"
+}
+
+// SetVisibility 其他人可读时设置为 public-read，否则设置为 private
+func (this *S3) SetVisibility(path string, perm fs.FileMode) error {
+	var res, err = this.do(http.MethodPut, this.key(path), url.Values{"acl": {""}}, http.Header{"X-Amz-Acl": {s3Acl(perm)}}, nil, "")
+	if err != nil {
+		return this.error("chmod", path, err)
+	}
+	return res.Body.Close()
+}
+
+func (this *S3) Prepend(path, contents string) error {
+	var raw, err = this.Get(path)
+	if err != nil && !errors.Is(err, file.ErrNotFound) {
+		return err
+	}
+	return this.Put(path, contents+raw)
+}
+
+func (this *S3) Append(path, contents string) error {
+	var raw, err = this.Get(path)
+	if err != nil && !errors.Is(err, file.ErrNotFound) {
+		return err
+	}
+	return this.Put(path, raw+contents)
+}
+
+// Delete 删除对象，对象不存在时返回错误，与本地文件系统保持一致
+func (this *S3) Delete(path string) error {
+	if _, err := this.head(path); err != nil {
+		return this.error("delete", path, err)
+	}
+	var res, err = this.do(http.MethodDelete, this.key(path), nil, nil, nil, "")
+	if err != nil {
+		return this.error("delete", path, err)
+	}
+	return res.Body.Close()
+}
+
+// Copy 使用服务端复制，不经过本地中转
+func (this *S3) Copy(from, to string) error {
+	var (
+		source   = "/" + this.bucket + "/" + s3Escape(this.key(from), false)
+		res, err = this.do(http.MethodPut, this.key(to), nil, http.Header{"X-Amz-Copy-Source": {source}}, nil, "")
+	)
+	if err != nil {
+		return this.error("copy", from, err)
+	}
+	defer res.Body.Close()
+
+	// 复制失败时 S3 也可能返回 200 状态码，需要检查响应体
+	var body, _ = ioutil.ReadAll(res.Body)
+	var copyErr = &S3Error{StatusCode: res.StatusCode}
+	if xml.Unmarshal(body, copyErr) == nil && copyErr.Code != "" {
+		return this.error("copy", to, copyErr)
+	}
+	return nil
+}
+
+func (this *S3) Move(from, to string) error {
+	if err := this.Copy(from, to); err != nil {
+		return err
+	}
+	return this.Delete(from)
+}
+
+func (this *S3) Size(path string) (int64, error) {
+	var res, err = this.head(path)
+	if err != nil {
+		return 0, this.error("stat", path, err)
+	}
+	return strconv.ParseInt(res.Header.Get("Content-Length"), 10, 64)
+}
+
+func (this *S3) LastModified(path string) (time.Time, error) {
+	var res, err = this.head(path)
+	if err != nil {
+		return time.Time{}, this.error("stat", path, err)
+	}
+	return http.ParseTime(res.Header.Get("Last-Modified"))
+}
+
+// Checksum 单次上传的对象 ETag 即为 MD5，分片上传的对象无法获取 MD5
+func (this *S3) Checksum(path string) (string, error) {
+	var res, err = this.head(path)
+	if err != nil {
+		return "", this.error("checksum", path, err)
+	}
+	var etag = strings.Trim(res.Header.Get("ETag"), `"`)
+	if len(etag) != 32 || strings.Contains(etag, "-") {
+		return "", file.NewError("checksum", this.name, path, file.ErrUnsupported, nil)
+	}
+	return strings.ToLower(etag), nil
+}
+
+func (this *S3) Files(directory string) []contracts.File {
+	return this.files(directory, "/")
+}
+
+func (this *S3) AllFiles(directory string) []contracts.File {
+	return this.files(directory, "")
+}
+
+func (this *S3) Directories(directory string) []string {
+	var (
+		prefix      = this.prefix(directory)
+		directories = make([]string, 0)
+	)
+	var err = this.list(prefix, "/", func(result *s3ListResult) {
+		for _, commonPrefix := range result.CommonPrefixes {
+			directories = append(directories, strings.TrimSuffix(strings.TrimPrefix(commonPrefix, prefix), "/"))
+		}
+	})
+	if err != nil {
+		logs.WithError(err).WithField("dir", directory).Debug("S3.Directories: ListObjectsV2 failed")
+	}
+	sort.Strings(directories)
+	return directories
+}
+
+// AllDirectories 对象存储没有真实目录，通过对象键推导出所有层级的目录
+func (this *S3) AllDirectories(directory string) []string {
+	var (
+		prefix = this.prefix(directory)
+		exists = make(map[string]bool)
+	)
+	var err = this.list(prefix, "", func(result *s3ListResult) {
+		for _, object := range result.Contents {
+			var segments = strings.Split(strings.TrimPrefix(object.Key, prefix), "/")
+			for i := 1; i < len(segments); i++ {
+				exists[strings.Join(segments[:i], "/")] = true
+			}
+		}
+	})
+	if err != nil {
+		logs.WithError(err).WithField("dir", directory).Debug("S3.AllDirectories: ListObjectsV2 failed")
+	}
+
+	var directories = make([]string, 0, len(exists))
+	for dir := range exists {
+		directories = append(directories, dir)
+	}
+	sort.Strings(directories)
+	return directories
+}
+
+// MakeDirectory 写入一个以分隔符结尾的空对象作为目录标记
+func (this *S3) MakeDirectory(path string) error {
+	var res, err = this.do(http.MethodPut, this.prefix(path), nil, nil, strings.NewReader(""), "")
+	if err != nil {
+		return this.error("mkdir", path, err)
+	}
+	return res.Body.Close()
+}
+
+func (this *S3) DeleteDirectory(directory string) error {
+	var keys = make([]string, 0)
+	var err = this.list(this.prefix(directory), "", func(result *s3ListResult) {
+		for _, object := range result.Contents {
+			keys = append(keys, object.Key)
+		}
+	})
+	if err != nil {
+		return this.error("rmdir", directory, err)
+	}
+
+	for start := 0; start < len(keys); start += s3BatchDeleteLimit {
+		var end = start + s3BatchDeleteLimit
+		if end > len(keys) {
+			end = len(keys)
+		}
+		if err = this.deleteObjects(keys[start:end]); err != nil {
+			return this.error("rmdir", directory, err)
+		}
+	}
+	return nil
+}
+
+// deleteObjects 批量删除，单次最多 1000 个
+func (this *S3) deleteObjects(keys []string) error {
+	var request = s3DeleteRequest{Quiet: true}
+	for _, key := range keys {
+		request.Objects = append(request.Objects, s3DeleteObject{Key: key})
+	}
+
+	var body, err = xml.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	var (
+		sum    = md5.Sum(body)
+		header = http.Header{
+			"Content-Md5":  {base64.StdEncoding.EncodeToString(sum[:])},
+			"Content-Type": {"application/xml"},
+		}
+		res *http.Response
+	)
+	res, err = this.do(http.MethodPost, "", url.Values{"delete": {""}}, header, bytes.NewReader(body), "")
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	var result s3DeleteResult
+	if err = xml.NewDecoder(res.Body).Decode(&result); err != nil && err != io.EOF {
+		return err
+	}
+	for _, deleteErr := range result.Errors {
+		logs.WithField("key", deleteErr.Key).WithField("code", deleteErr.Code).Debug("S3.DeleteDirectory: delete object failed")
+	}
+	if len(result.Errors) > 0 {
+		var deleteErr = result.Errors[0]
+		deleteErr.StatusCode = res.StatusCode
+		return &deleteErr
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package adapters
+
+import (
+	"bufio"
+	"errors"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem/file"
+	"io"
+	"io/fs"
+	pathpkg "path"
+	"strings"
+	"time"
+)
+
+// NewScoped 创建一个给所有路径加上 prefix 的磁盘，路径无法通过 .. 跳出前缀
+func NewScoped(name string, disk contracts.FileSystem, prefix string) *Scoped {
+	prefix = strings.Trim(pathpkg.Clean("/"+prefix), "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &Scoped{name: name, disk: disk, prefix: prefix}
+}
+
+// Scoped 带前缀的磁盘，返回的文件路径以及错误中的路径都不包含前缀
+type Scoped struct {
+	name   string
+	disk   contracts.FileSystem
+	prefix string
+}
+
+// wrapFiles 将被包装磁盘中的文件转换为 name 磁盘中的文件，path 转换文件路径，返回 false 时忽略该文件
+func wrapFiles(name string, files []contracts.File, path func(path string) (string, bool)) []contracts.File {
+	var results = make([]contracts.File, 0, len(files))
+	for _, item := range files {
+		var original = item.Name()
+		if withPath, ok := item.(file.File); ok {
+			original = withPath.Path()
+		}
+		if wrapped, ok := path(original); ok {
+			results = append(results, &ScopedFile{File: item, DiskName: name, path: wrapped})
+		}
+	}
+	return results
+}
+
+// ScopedFile 去掉前缀后的文件
+type ScopedFile struct {
+	contracts.File
+	DiskName string
+	path     string
+}
+
+func (this *ScopedFile) Path() string {
+	return this.path
+}
+
+// Name 与 fs.FileInfo 一致返回文件名，S3、七牛等磁盘的 Name 是完整的键，直接使用会暴露前缀
+func (this *ScopedFile) Name() string {
+	return pathpkg.Base(this.path)
+}
+
+func (this *ScopedFile) Disk() string {
+	return this.DiskName
+}
+
+// Prefix 获取前缀，非空时以 / 结尾
+func (this *Scoped) Prefix() string {
+	return this.prefix
+}
+
+// Unwrap 获取被包装的磁盘
+func (this *Scoped) Unwrap() contracts.FileSystem {
+	return this.disk
+}
+
+func (this *Scoped) path(path string) string {
+	return this.prefix + strings.TrimPrefix(pathpkg.Clean("/"+path), "/")
+}
+
+func (this *Scoped) strip(path string) string {
+	return strings.TrimPrefix(strings.TrimPrefix(path, "/"), this.prefix)
+}
+
+// error 将被包装磁盘的错误转换为当前磁盘的名称和路径
+func (this *Scoped) error(err error) error {
+	var wrapped *file.Error
+	if err == nil || !errors.As(err, &wrapped) {
+		return err
+	}
+	var scoped = *wrapped
+	scoped.Disk, scoped.Path = this.name, this.strip(wrapped.Path)
+	return &scoped
+}
+
+func (this *Scoped) files(files []contracts.File) []contracts.File {
+	return wrapFiles(this.name, files, func(path string) (string, bool) {
+		return this.strip(path), true
+	})
+}
+
+func (this *Scoped) Name() string {
+	return this.name
+}
+
+func (this *Scoped) Exists(path string) bool {
+	return this.disk.Exists(this.path(path))
+}
+
+func (this *Scoped) Get(path string) (string, error) {
+	var contents, err = this.disk.Get(this.path(path))
+	return contents, this.error(err)
+}
+
+func (this *Scoped) Read(path string) ([]byte, error) {
+	var contents, err = this.disk.Read(this.path(path))
+	return contents, this.error(err)
+}
+
+func (this *Scoped) Open(path string) (io.ReadSeekCloser, error) {
+	var handle, err = Open(this.disk, this.path(path))
+	return handle, this.error(err)
+}
+
+func (this *Scoped) ReadRange(path string, offset, length int64) (io.ReadCloser, error) {
+	var reader, err = ReadRange(this.disk, this.path(path), offset, length)
+	return reader, this.error(err)
+}
+
+func (this *Scoped) ReadStream(path string) (*bufio.Reader, error) {
+	var reader, err = this.disk.ReadStream(this.path(path))
+	return reader, this.error(err)
+}
+
+func (this *Scoped) Checksum(path string) (string, error) {
+	var sum, err = Checksum(this.disk, this.path(path))
+	return sum, this.error(err)
+}
+
+func (this *Scoped) SupportsUrls() bool {
+	return SupportsUrls(this.disk)
+}
+
+func (this *Scoped) Url(path string) string {
+	var url, _ = Url(this.disk, this.path(path))
+	return url
+}
+
+func (this *Scoped) TemporaryUrl(path string, ttl time.Duration, opts ...file.UrlOption) (string, error) {
+	var url, err = TemporaryUrl(this.disk, this.path(path), ttl, opts...)
+	return url, this.error(err)
+}
+
+func (this *Scoped) Put(path, contents string) error {
+	return this.error(this.disk.Put(this.path(path), contents))
+}
+
+func (this *Scoped) WriteStream(path string, contents string) error {
+	return this.error(this.disk.WriteStream(this.path(path), contents))
+}
+
+func (this *Scoped) PutStream(path string, r io.Reader, opts ...file.WriteOption) (int64, error) {
+	var written, err = PutStream(this.disk, this.path(path), r, opts...)
+	return written, this.error(err)
+}
+
+func (this *Scoped) GetVisibility(path string) contracts.FileVisibility {
+	return this.disk.GetVisibility(this.path(path))
+}
+
+func (this *Scoped) SetVisibility(path string, perm fs.FileMode) error {
+	return this.error(this.disk.SetVisibility(this.path(path), perm))
+}
+
+func (this *Scoped) Prepend(path, contents string) error {
+	return this.error(this.disk.Prepend(this.path(path), contents))
+}
+
+func (this *Scoped) Append(path, contents string) error {
+	return this.error(this.disk.Append(this.path(path), contents))
+}
+
+func (this *Scoped) Delete(path string) error {
+	return this.error(this.disk.Delete(this.path(path)))
+}
+
+func (this *Scoped) Copy(from, to string) error {
+	return this.error(this.disk.Copy(this.path(from), this.path(to)))
+}
+
+func (this *Scoped) Move(from, to string) error {
+	return this.error(this.disk.Move(this.path(from), this.path(to)))
+}
+
+func (this *Scoped) Size(path string) (int64, error) {
+	var size, err = this.disk.Size(this.path(path))
+	return size, this.error(err)
+}
+
+func (this *Scoped) LastModified(path string) (time.Time, error) {
+	var modTime, err = this.disk.LastModified(this.path(path))
+	return modTime, this.error(err)
+}
+
+func (this *Scoped) Touch(path string, modTime time.Time) error {
+	return this.error(Touch(this.disk, this.path(path), modTime))
+}
+
+func (this *Scoped) Files(directory string) []contracts.File {
+	return this.files(this.disk.Files(this.path(directory)))
+}
+
+func (this *Scoped) AllFiles(directory string) []contracts.File {
+	return this.files(this.disk.AllFiles(this.path(directory)))
+}
+
+func (this *Scoped) Directories(directory string) []string {
+	return this.disk.Directories(this.path(directory))
+}
+
+func (this *Scoped) AllDirectories(directory string) []string {
+	return this.disk.AllDirectories(this.path(directory))
+}
+
+func (this *Scoped) MakeDirectory(path string) error {
+	return this.error(this.disk.MakeDirectory(this.path(path)))
+}
+
+func (this *Scoped) DeleteDirectory(directory string) error {
+	return this.error(this.disk.DeleteDirectory(this.path(directory)))
+}
@@ -0,0 +1,169 @@
+package adapters
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem/file"
+	"github.com/goal-web/supports/logs"
+	"mime"
+	"net/http"
+	"net/url"
+	pathpkg "path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	InvalidSignatureErr = errors.New("invalid url signature")
+	UrlExpiredErr       = errors.New("url has expired")
+)
+
+// NewUrlSigner 创建 URL 签名器，base 为文件访问地址的前缀，例如 http://localhost:8000/files
+// secret 为空时只能生成公开地址
+func NewUrlSigner(base string, secret []byte) (*UrlSigner, error) {
+	var parsed, err = url.Parse(strings.TrimSuffix(base, "/"))
+	if err != nil {
+		return nil, err
+	}
+	return &UrlSigner{base: parsed, secret: secret}, nil
+}
+
+// UrlSigner 生成以及校验 HMAC-SHA256 签名的临时地址，签名内容为文件路径和过期时间
+type UrlSigner struct {
+	base   *url.URL
+	secret []byte
+}
+
+func (this *UrlSigner) clean(path string) string {
+	return strings.TrimPrefix(pathpkg.Clean("/"+path), "/")
+}
+
+// sign 签名内容包括路径、过期时间以及响应参数，避免下载文件名和 MIME 类型被篡改
+// 每个字段前加上长度，避免字段中的分隔符让不同的参数组合得到相同的签名
+func (this *UrlSigner) sign(path string, expires int64, options file.UrlOptions) string {
+	var mac = hmac.New(sha256.New, this.secret)
+	for _, field := range []string{path, strconv.FormatInt(expires, 10), options.Download, options.ContentType} {
+		mac.Write([]byte(strconv.Itoa(len(field)) + ":" + field))
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Url 生成不带签名的地址
+func (this *UrlSigner) Url(path string) string {
+	var result = *this.base
+	result.Path = this.base.Path + "/" + this.clean(path)
+	result.RawPath = ""
+	return result.String()
+}
+
+// TemporaryUrl 生成在 expires 之前有效的签名地址
+func (this *UrlSigner) TemporaryUrl(path string, expires time.Time, opts ...file.UrlOption) (string, error) {
+	if len(this.secret) == 0 {
+		return "", file.ErrUnsupported
+	}
+	path = this.clean(path)
+
+	var (
+		options   = file.ApplyUrlOptions(opts...)
+		result, _ = url.Parse(this.Url(path))
+		query     = result.Query()
+	)
+	if options.Download != "" {
+		query.Set("download", options.Download)
+	}
+	if options.ContentType != "" {
+		query.Set("content_type", options.ContentType)
+	}
+	query.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	query.Set("signature", this.sign(path, expires.Unix(), options))
+	result.RawQuery = query.Encode()
+	return result.String(), nil
+}
+
+// Verify 校验请求的签名以及过期时间，返回请求的文件路径以及签名时的响应参数
+func (this *UrlSigner) Verify(r *http.Request) (string, file.UrlOptions, error) {
+	var path = r.URL.Path
+	if !strings.HasPrefix(path, this.base.Path+"/") {
+		return "", file.UrlOptions{}, InvalidSignatureErr
+	}
+	path = this.clean(strings.TrimPrefix(path, this.base.Path+"/"))
+
+	var (
+		query        = r.URL.Query()
+		signature    = query.Get("signature")
+		expires, err = strconv.ParseInt(query.Get("expires"), 10, 64)
+		options      = file.UrlOptions{Download: query.Get("download"), ContentType: query.Get("content_type")}
+	)
+	if len(this.secret) == 0 || err != nil || signature == "" {
+		return path, options, InvalidSignatureErr
+	}
+	if !hmac.Equal([]byte(signature), []byte(this.sign(path, expires, options))) {
+		return path, options, InvalidSignatureErr
+	}
+	if time.Now().Unix() > expires {
+		return path, options, UrlExpiredErr
+	}
+	return path, options, nil
+}
+
+// NewSignedHandler 创建校验签名后输出文件内容的 http.Handler，需要挂载在 signer 的地址前缀下
+// 签名无效或者过期时返回 403，文件不存在时返回 404，支持 Range 以及 If-Modified-Since
+func NewSignedHandler(disk contracts.FileSystem, signer *UrlSigner) http.Handler {
+	return &SignedHandler{disk: disk, signer: signer}
+}
+
+type SignedHandler struct {
+	disk   contracts.FileSystem
+	signer *UrlSigner
+	// public 为 true 时没有签名的请求可以访问 VISIBLE 文件
+	public bool
+}
+
+func (this *SignedHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var (
+		path, options, err = this.signer.Verify(r)
+		signed             = err == nil
+	)
+	// 没有签名参数时按公开地址处理，不存在的文件同样是 INVISIBLE，不会暴露文件是否存在
+	if !signed && this.public && path != "" && !r.URL.Query().Has("signature") && this.disk.GetVisibility(path) == file.VISIBLE {
+		options, err = file.UrlOptions{}, nil
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	handle, err := Open(this.disk, path)
+	if err != nil {
+		if errors.Is(err, file.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		logs.WithError(err).WithField("disk", this.disk.Name()).WithField("path", path).Error("SignedHandler: failed to open file")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer handle.Close()
+
+	var modTime, _ = this.disk.LastModified(path)
+	if signed {
+		w.Header().Set("Cache-Control", "private")
+	}
+	if options.ContentType != "" {
+		w.Header().Set("Content-Type", options.ContentType)
+	}
+	if options.Download != "" {
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": options.Download}))
+	}
+	http.ServeContent(w, r, pathpkg.Base(path), modTime, handle)
+}
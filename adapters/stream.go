@@ -0,0 +1,162 @@
+package adapters
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem/file"
+	"io"
+	"io/ioutil"
+	"time"
+)
+
+// PutStream 流式写入文件，磁盘不支持流式写入时退化为读取全部内容后写入
+func PutStream(disk contracts.FileSystem, path string, r io.Reader, opts ...file.WriteOption) (int64, error) {
+	if writer, isWriter := disk.(file.StreamWriter); isWriter {
+		return writer.PutStream(path, r, opts...)
+	}
+
+	var contents, err = ioutil.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	if err = disk.WriteStream(path, string(contents)); err != nil {
+		return 0, err
+	}
+	if options := file.ApplyWriteOptions(opts...); options.Perm != 0 {
+		if err = disk.SetVisibility(path, options.Perm); err != nil {
+			return int64(len(contents)), err
+		}
+	}
+	return int64(len(contents)), nil
+}
+
+// Open 打开文件读取句柄，磁盘不支持时退化为读取全部内容到内存中
+func Open(disk contracts.FileSystem, path string) (io.ReadSeekCloser, error) {
+	if opener, isOpener := disk.(file.Opener); isOpener {
+		return opener.Open(path)
+	}
+
+	var contents, err = disk.Read(path)
+	if err != nil {
+		return nil, err
+	}
+	return nopSeekCloser{bytes.NewReader(contents)}, nil
+}
+
+// ReadRange 读取文件的部分内容，磁盘不支持时通过 Open 定位读取
+func ReadRange(disk contracts.FileSystem, path string, offset, length int64) (io.ReadCloser, error) {
+	if ranger, isRanger := disk.(file.RangeReader); isRanger {
+		return ranger.ReadRange(path, offset, length)
+	}
+
+	var handle, err = Open(disk, path)
+	if err != nil {
+		return nil, err
+	}
+	size, err := handle.Seek(0, io.SeekEnd)
+	if err == nil {
+		length, err = rangeLength(size, offset, length)
+	}
+	if err == nil {
+		_, err = handle.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		_ = handle.Close()
+		return nil, err
+	}
+	return limitedReadCloser{Reader: io.LimitReader(handle, length), Closer: handle}, nil
+}
+
+// Touch 设置文件的修改时间，磁盘不支持时返回 file.ErrUnsupported
+func Touch(disk contracts.FileSystem, path string, modTime time.Time) error {
+	if toucher, isToucher := disk.(file.Toucher); isToucher {
+		return toucher.Touch(path, modTime)
+	}
+	return file.NewError("touch", disk.Name(), path, file.ErrUnsupported, nil)
+}
+
+// AppendStream 流式追加文件内容，磁盘不支持时返回 file.ErrUnsupported
+func AppendStream(disk contracts.FileSystem, path string, r io.Reader) (int64, error) {
+	if appender, isAppender := disk.(file.StreamAppender); isAppender {
+		return appender.AppendStream(path, r)
+	}
+	return 0, file.NewError("append", disk.Name(), path, file.ErrUnsupported, nil)
+}
+
+// Checksum 获取文件内容的 MD5，磁盘不支持时返回 file.ErrUnsupported
+func Checksum(disk contracts.FileSystem, path string) (string, error) {
+	if checksummer, isChecksummer := disk.(file.Checksummer); isChecksummer {
+		return checksummer.Checksum(path)
+	}
+	return "", file.NewError("checksum", disk.Name(), path, file.ErrUnsupported, nil)
+}
+
+// checksum 计算 r 中内容的 MD5
+func checksum(r io.Reader) (string, error) {
+	var hash = md5.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// ReadStream 基于 Open 创建读取流，读取到末尾或者出错时自动关闭句柄
+func ReadStream(disk file.Opener, path string) (*bufio.Reader, error) {
+	var handle, err = disk.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return bufio.NewReader(&autoCloseReader{ReadCloser: handle}), nil
+}
+
+type nopSeekCloser struct {
+	io.ReadSeeker
+}
+
+func (nopSeekCloser) Close() error {
+	return nil
+}
+
+// autoCloseReader 读取结束（包括出错）后自动关闭底层句柄，避免 *bufio.Reader 泄漏文件描述符或者 HTTP 连接
+type autoCloseReader struct {
+	io.ReadCloser
+	closed bool
+}
+
+func (this *autoCloseReader) Read(p []byte) (int, error) {
+	if this.closed {
+		return 0, io.EOF
+	}
+	var n, err = this.ReadCloser.Read(p)
+	if err != nil {
+		this.closed = true
+		_ = this.ReadCloser.Close()
+	}
+	return n, err
+}
+
+// countingReader 统计读取的字节数
+type countingReader struct {
+	io.Reader
+	count int64
+}
+
+func (this *countingReader) Read(p []byte) (int, error) {
+	var n, err = this.Reader.Read(p)
+	this.count += int64(n)
+	return n, err
+}
+
+// CopyStream 通过流在两个磁盘之间复制文件，不会把整个文件读入内存
+func CopyStream(from contracts.FileSystem, fromPath string, to contracts.FileSystem, toPath string, opts ...file.WriteOption) (int64, error) {
+	var source, err = Open(from, fromPath)
+	if err != nil {
+		return 0, err
+	}
+	defer source.Close()
+
+	return PutStream(to, toPath, source, opts...)
+}
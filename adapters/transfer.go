@@ -0,0 +1,61 @@
+package adapters
+
+import (
+	"errors"
+	"fmt"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem/file"
+	"io/fs"
+)
+
+// TransferVerifyErr 复制后目标文件的大小与源文件不一致
+var TransferVerifyErr = errors.New("transferred size does not match the source")
+
+// Transfer 通过流在两个磁盘之间复制文件，尽可能保留可见性以及修改时间，完成后校验文件大小
+func Transfer(from contracts.FileSystem, fromPath string, to contracts.FileSystem, toPath string) (int64, error) {
+	var size, err = from.Size(fromPath)
+	if err != nil {
+		return 0, err
+	}
+	modTime, err := from.LastModified(fromPath)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		visibility = from.GetVisibility(fromPath)
+		options    = []file.WriteOption{file.WithMetadata("last-modified", modTime.UTC().Format("2006-01-02T15:04:05Z"))}
+	)
+	written, err := CopyStream(from, fromPath, to, toPath, options...)
+	if err != nil {
+		return written, err
+	}
+
+	if copied, sizeErr := to.Size(toPath); sizeErr != nil || written != size || copied != size {
+		var cause = fmt.Errorf("%w: source %d bytes, written %d bytes", TransferVerifyErr, size, written)
+		if sizeErr != nil {
+			cause = sizeErr
+		}
+		return written, file.Wrap("copy", to.Name(), toPath, cause)
+	}
+
+	// 可见性以及修改时间只在目标磁盘支持时保留
+	if to.GetVisibility(toPath) != visibility {
+		var perm = visibilityPerm(visibility)
+		if err = to.SetVisibility(toPath, perm); err != nil && !errors.Is(err, file.ErrUnsupported) {
+			return written, err
+		}
+	}
+	if err = Touch(to, toPath, modTime); err != nil && !errors.Is(err, file.ErrUnsupported) {
+		return written, err
+	}
+	return written, nil
+}
+
+// visibilityPerm 将可见性转换为对应的权限
+func visibilityPerm(visibility contracts.FileVisibility) fs.FileMode {
+	if visibility == file.VISIBLE {
+		return 0644
+	}
+	return 0600
+}
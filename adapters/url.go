@@ -0,0 +1,50 @@
+package adapters
+
+import (
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem/file"
+	"time"
+)
+
+// DefaultUrlTTL 磁盘没有配置 ttl 时临时地址的有效期
+const DefaultUrlTTL = time.Hour
+
+// urlTTL 获取临时地址的有效期，调用时传入的 ttl 优先于磁盘配置的 ttl
+func urlTTL(ttl, diskTTL time.Duration) time.Duration {
+	if ttl > 0 {
+		return ttl
+	}
+	if diskTTL > 0 {
+		return diskTTL
+	}
+	return DefaultUrlTTL
+}
+
+// SupportsUrls 判断磁盘是否可以生成访问地址，包装磁盘实现了 SupportsUrls 方法时取决于被包装的磁盘
+func SupportsUrls(disk contracts.FileSystem) bool {
+	switch value := disk.(type) {
+	case interface{ SupportsUrls() bool }:
+		return value.SupportsUrls()
+	case file.UrlGenerator:
+		return true
+	}
+	return false
+}
+
+// Url 获取文件的访问地址，磁盘不支持时返回 file.ErrUnsupported
+func Url(disk contracts.FileSystem, path string) (string, error) {
+	if generator, isGenerator := disk.(file.UrlGenerator); isGenerator {
+		if url := generator.Url(path); url != "" {
+			return url, nil
+		}
+	}
+	return "", file.NewError("url", disk.Name(), path, file.ErrUnsupported, nil)
+}
+
+// TemporaryUrl 获取在 ttl 之后过期的访问地址，磁盘不支持时返回 file.ErrUnsupported
+func TemporaryUrl(disk contracts.FileSystem, path string, ttl time.Duration, opts ...file.UrlOption) (string, error) {
+	if generator, isGenerator := disk.(file.UrlGenerator); isGenerator {
+		return generator.TemporaryUrl(path, ttl, opts...)
+	}
+	return "", file.NewError("url", disk.Name(), path, file.ErrUnsupported, nil)
+}
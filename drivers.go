@@ -0,0 +1,211 @@
+package filesystem
+
+import (
+	"encoding/base64"
+	"fmt"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem/adapters"
+	"github.com/goal-web/supports/exceptions"
+	"github.com/goal-web/supports/logs"
+	"github.com/goal-web/supports/utils"
+	"strings"
+	"time"
+)
+
+// inner 获取包装驱动引用的磁盘，不能为空也不能直接或者间接地引用自身
+func (this *Factory) inner(name string, config contracts.Fields) contracts.FileSystem {
+	var disk = utils.GetStringField(config, "disk")
+	if disk == "" || disk == name {
+		logs.WithError(InvalidDiskErr).Error(fmt.Sprintf("filesystem.Factory: disk %s references invalid disk [%s]", name, disk))
+		panic(Exception{exceptions.WithError(InvalidDiskErr, config)})
+	}
+
+	// 沿着正在创建的磁盘查找，回到自身时说明存在循环引用，继续等待会导致死锁
+	this.mutex.Lock()
+	var chain = []string{name, disk}
+	for next, waiting := this.waits[disk]; waiting; next, waiting = this.waits[next] {
+		chain = append(chain, next)
+		if next == name {
+			this.mutex.Unlock()
+			var err = fmt.Errorf("%w: disk %s", InvalidDiskErr, strings.Join(chain, " -> "))
+			logs.WithError(err).Error(fmt.Sprintf("filesystem.Factory: disk %s references itself", name))
+			panic(Exception{exceptions.WithError(err, config)})
+		}
+	}
+	this.waits[name] = disk
+	this.mutex.Unlock()
+
+	defer func() {
+		this.mutex.Lock()
+		defer this.mutex.Unlock()
+
+		if this.waits[name] == disk {
+			delete(this.waits, name)
+		}
+	}()
+	return this.Disk(disk)
+}
+
+// scopedDriver 给所有路径加上前缀，配置：{"driver": "scoped", "disk": "qiniu", "prefix": "tenant-42/"}
+func (this *Factory) scopedDriver(name string, config contracts.Fields) contracts.FileSystem {
+	return adapters.NewScoped(name, this.inner(name, config), utils.GetStringField(config, "prefix"))
+}
+
+// Scoped 获取给定磁盘带前缀的视图，所有路径都会加上 prefix，返回的文件路径不包含 prefix
+func (this *Factory) Scoped(disk, prefix string) contracts.FileSystem {
+	return adapters.NewScoped(disk, this.Disk(disk), prefix)
+}
+
+// readOnlyDriver 只读磁盘，配置：{"driver": "readonly", "disk": "assets"}，任意磁盘也可以通过 "read_only": true 开启只读
+func (this *Factory) readOnlyDriver(name string, config contracts.Fields) contracts.FileSystem {
+	return adapters.NewReadOnly(name, this.inner(name, config))
+}
+
+// mountDriver 将多个磁盘挂载到不同的前缀下，配置：{"driver": "mount", "mounts": {"avatars": "qiniu", "tmp": "local"}}
+func (this *Factory) mountDriver(name string, config contracts.Fields) contracts.FileSystem {
+	var mounts = make(map[string]contracts.FileSystem)
+	for prefix, disk := range this.mapField(name, config, "mounts") {
+		mounts[prefix] = this.inner(name, contracts.Fields{"disk": disk})
+	}
+	return adapters.NewMount(name, mounts)
+}
+
+// mapField 获取配置中的字符串映射，支持 map[string]string、contracts.Fields 以及配置文件解析出的 map[string]interface{}
+// 未配置时返回 nil，其他类型视为配置错误
+func (this *Factory) mapField(name string, config contracts.Fields, field string) map[string]string {
+	var fields = make(map[string]string)
+	switch value := config[field].(type) {
+	case nil:
+		return nil
+	case map[string]string:
+		return value
+	case contracts.Fields:
+		for key, item := range value {
+			fields[key] = fmt.Sprint(item)
+		}
+	case map[string]interface{}:
+		for key, item := range value {
+			fields[key] = fmt.Sprint(item)
+		}
+	case map[interface{}]interface{}:
+		for key, item := range value {
+			fields[fmt.Sprint(key)] = fmt.Sprint(item)
+		}
+	default:
+		var err = fmt.Errorf("%w: %s must be a map, got %T", InvalidConfigErr, field, value)
+		logs.WithError(err).Error(fmt.Sprintf("filesystem.Factory: disk %s has invalid %s", name, field))
+		panic(Exception{exceptions.WithError(err, config)})
+	}
+	return fields
+}
+
+// listField 获取配置中的字符串列表，支持 []string 以及配置文件解析出的 []interface{}，未配置时返回 nil，其他类型视为配置错误
+func (this *Factory) listField(name string, config contracts.Fields, field string) []string {
+	switch value := config[field].(type) {
+	case nil:
+		return nil
+	case []string:
+		return value
+	case []interface{}:
+		var items = make([]string, 0, len(value))
+		for _, item := range value {
+			items = append(items, fmt.Sprint(item))
+		}
+		return items
+	default:
+		var err = fmt.Errorf("%w: %s must be a list, got %T", InvalidConfigErr, field, value)
+		logs.WithError(err).Error(fmt.Sprintf("filesystem.Factory: disk %s has invalid %s", name, field))
+		panic(Exception{exceptions.WithError(err, config)})
+	}
+}
+
+// disksField 获取配置中的磁盘列表
+func (this *Factory) disksField(name string, config contracts.Fields) []contracts.FileSystem {
+	var names = this.listField(name, config, "disks")
+	if len(names) == 0 {
+		logs.WithError(InvalidDiskErr).Error(fmt.Sprintf("filesystem.Factory: disk %s requires at least one disk", name))
+		panic(Exception{exceptions.WithError(InvalidDiskErr, config)})
+	}
+
+	var disks = make([]contracts.FileSystem, 0, len(names))
+	for _, disk := range names {
+		disks = append(disks, this.inner(name, contracts.Fields{"disk": disk}))
+	}
+	return disks
+}
+
+// mirrorDriver 将写入操作同时发送到多个磁盘，配置：{"driver": "mirror", "disks": ["local", "qiniu"], "quorum": 1}
+func (this *Factory) mirrorDriver(name string, config contracts.Fields) contracts.FileSystem {
+	return adapters.NewMirror(name, this.disksField(name, config), utils.GetIntField(config, "quorum"))
+}
+
+// failoverDriver 按顺序使用多个磁盘，当前磁盘出现传输错误时切换到下一个
+// 配置：{"driver": "failover", "disks": ["qiniu", "local"], "interval": 30, "probe": ".health"}，interval 单位为秒
+func (this *Factory) failoverDriver(name string, config contracts.Fields) contracts.FileSystem {
+	var disk = adapters.NewFailover(name, this.disksField(name, config), time.Duration(utils.GetIntField(config, "interval"))*time.Second)
+	if probe := utils.GetStringField(config, "probe"); probe != "" {
+		disk.SetProbePath(probe)
+	}
+	return disk
+}
+
+// cachedDriver 缓存远程磁盘的读取结果，配置：
+// {"driver": "cached", "disk": "qiniu", "ttl": 300, "meta_ttl": 60, "max_size": 67108864, "cache_disk": "cache", "store": "redis"}
+// ttl、meta_ttl 单位为秒，cache_disk 为保存内容的磁盘，store 为保存元数据的 goal-web 缓存，需要先调用 UseCache
+func (this *Factory) cachedDriver(name string, config contracts.Fields) contracts.FileSystem {
+	var cacheConfig = adapters.CacheConfig{
+		TTL:     time.Duration(utils.GetIntField(config, "ttl")) * time.Second,
+		MetaTTL: time.Duration(utils.GetIntField(config, "meta_ttl")) * time.Second,
+		MaxSize: utils.GetInt64Field(config, "max_size"),
+	}
+	if disk := utils.GetStringField(config, "cache_disk"); disk != "" {
+		cacheConfig.Disk = this.inner(name, contracts.Fields{"disk": disk})
+	}
+	this.mutex.RLock()
+	var cache = this.cache
+	this.mutex.RUnlock()
+	if store, exists := config["store"]; exists && cache != nil {
+		cacheConfig.Store = cache.Store(fmt.Sprint(store))
+	}
+	return adapters.NewCached(name, this.inner(name, config), cacheConfig)
+}
+
+// encryptedDriver 客户端加密，配置：{"driver": "encrypted", "disk": "qiniu", "keys": {"2024": "base64 编码的密钥"}, "key": "2024"}
+// key 为写入时使用的密钥 ID，轮换密钥时保留旧密钥用于读取
+func (this *Factory) encryptedDriver(name string, config contracts.Fields) contracts.FileSystem {
+	var keys = make(map[string][]byte)
+	for id, key := range this.mapField(name, config, "keys") {
+		var decoded, err = base64.StdEncoding.DecodeString(key)
+		if err != nil {
+			logs.WithError(err).Error(fmt.Sprintf("filesystem.Factory: disk %s has invalid key [%s]", name, id))
+			panic(Exception{exceptions.WithError(err, config)})
+		}
+		keys[id] = decoded
+	}
+
+	var disk, err = adapters.NewEncrypted(name, this.inner(name, config), adapters.EncryptionConfig{
+		Keys:  keys,
+		KeyId: utils.GetStringField(config, "key"),
+	})
+	if err != nil {
+		logs.WithError(err).Error(fmt.Sprintf("filesystem.Factory: disk %s has invalid encryption config", name))
+		panic(Exception{exceptions.WithError(err, config)})
+	}
+	return disk
+}
+
+// compressedDriver 写入时压缩，读取时解压，配置：{"driver": "compressed", "disk": "logs", "algorithm": "gzip", "level": 6, "skip": [".gz", ".jpg"]}
+func (this *Factory) compressedDriver(name string, config contracts.Fields) contracts.FileSystem {
+	var compressionConfig = adapters.CompressionConfig{
+		Algorithm: utils.GetStringField(config, "algorithm"),
+		Level:     utils.GetIntField(config, "level"),
+		Skip:      this.listField(name, config, "skip"),
+	}
+
+	var disk, err = adapters.NewCompressed(name, this.inner(name, config), compressionConfig)
+	if err != nil {
+		logs.WithError(err).Error(fmt.Sprintf("filesystem.Factory: disk %s has invalid compression config", name))
+		panic(Exception{exceptions.WithError(err, config)})
+	}
+	return disk
+}
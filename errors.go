@@ -0,0 +1,18 @@
+package filesystem
+
+import "github.com/goal-web/filesystem/file"
+
+// 所有驱动返回的错误都会转换为 *Error，可以通过 errors.Is 与下面的错误类型或者 io/fs 中对应的错误比较
+var (
+	ErrNotFound      = file.ErrNotFound
+	ErrAlreadyExists = file.ErrAlreadyExists
+	ErrPermission    = file.ErrPermission
+	ErrNotDirectory  = file.ErrNotDirectory
+	ErrUnsupported   = file.ErrUnsupported
+	ErrInvalidRange  = file.ErrInvalidRange
+	ErrOutsideRoot   = file.ErrOutsideRoot
+	ErrReadOnly      = file.ErrReadOnly
+)
+
+// Error 带有磁盘名称以及路径的错误，通过 errors.As 获取
+type Error = file.Error
@@ -6,60 +6,203 @@ import (
 	"fmt"
 	"github.com/goal-web/contracts"
 	"github.com/goal-web/filesystem/adapters"
+	"github.com/goal-web/filesystem/file"
 	"github.com/goal-web/supports/exceptions"
 	"github.com/goal-web/supports/logs"
 	"github.com/goal-web/supports/utils"
+	"io"
 	"io/fs"
+	"sync"
 	"time"
 )
 
 var (
 	UndefinedDefineErr = errors.New("unsupported file system")
+	InvalidDiskErr     = errors.New("invalid disk reference")
+	InvalidConfigErr   = errors.New("invalid disk config")
 )
 
 func New(config Config) contracts.FileSystemFactory {
-	return &Factory{
+	var factory = &Factory{
 		config: config,
-		disks:  make(map[string]contracts.FileSystem),
+		disks:  make(map[string]*diskEntry),
+		waits:  make(map[string]string),
 		drivers: map[string]contracts.FileSystemProvider{
-			"local": adapters.LocalAdapter,
-			"qiniu": adapters.QiniuAdapter,
+			"local":  adapters.LocalAdapter,
+			"memory": adapters.MemoryAdapter,
+			"qiniu":  adapters.QiniuAdapter,
+			"s3":     adapters.S3Adapter,
 		},
 	}
 
+	// 包装其他磁盘的驱动
+	factory.drivers["scoped"] = factory.scopedDriver
+	factory.drivers["readonly"] = factory.readOnlyDriver
+	factory.drivers["mount"] = factory.mountDriver
+	factory.drivers["mirror"] = factory.mirrorDriver
+	factory.drivers["failover"] = factory.failoverDriver
+	factory.drivers["cached"] = factory.cachedDriver
+	factory.drivers["encrypted"] = factory.encryptedDriver
+	factory.drivers["compressed"] = factory.compressedDriver
+
+	return factory
+}
+
+// diskEntry 保证每个磁盘只会被创建一次
+type diskEntry struct {
+	once sync.Once
+	disk contracts.FileSystem
 }
 
 type Factory struct {
 	config  Config
-	disks   map[string]contracts.FileSystem
+	mutex   sync.RWMutex
+	disks   map[string]*diskEntry
 	drivers map[string]contracts.FileSystemProvider
+	cache   contracts.CacheFactory
+
+	// waits 正在创建的包装磁盘以及它正在等待的磁盘，用于检测循环引用
+	waits map[string]string
 }
 
-func (this *Factory) Disk(name string) contracts.FileSystem {
-	if disk, existsStore := this.disks[name]; existsStore {
-		return disk
-	}
+// UseCache 设置 cached 驱动使用的缓存，需要在获取磁盘之前调用
+func (this *Factory) UseCache(cache contracts.CacheFactory) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
 
-	this.disks[name] = this.get(name)
+	this.cache = cache
+}
 
-	return this.disks[name]
+// Disk 获取磁盘，并发调用时同一个磁盘只会被创建一次，创建过程不持有锁，驱动内部可以继续获取其他磁盘
+func (this *Factory) Disk(name string) contracts.FileSystem {
+	this.mutex.Lock()
+	var entry, exists = this.disks[name]
+	if !exists {
+		entry = &diskEntry{}
+		this.disks[name] = entry
+	}
+	this.mutex.Unlock()
+
+	entry.once.Do(func() {
+		defer func() {
+			// 创建失败时移除，下次调用会重新创建
+			if entry.disk == nil {
+				this.forget(name, entry)
+			}
+		}()
+		entry.disk = this.get(name)
+	})
+
+	// 其他调用方创建失败时重新创建，get 不会返回 nil
+	if entry.disk == nil {
+		return this.Disk(name)
+	}
+	return entry.disk
 }
 
 func (this *Factory) Extend(driver string, provider contracts.FileSystemProvider) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
 	this.drivers[driver] = provider
 }
 
+// Fake 使用内存假磁盘替换给定名称的磁盘，用于测试
+func (this *Factory) Fake(name string) *adapters.Fake {
+	var fake = adapters.NewFake(name)
+	this.set(name, fake)
+	return fake
+}
+
+// Purge 移除已经创建的磁盘，下次获取时会根据配置重新创建，实现了 io.Closer 的磁盘会被关闭
+func (this *Factory) Purge(name string) {
+	this.mutex.Lock()
+	var entry = this.disks[name]
+	delete(this.disks, name)
+	this.mutex.Unlock()
+
+	this.release(name, entry)
+}
+
+// Reload 使用新的配置（可选）重新创建磁盘，旧磁盘实现了 io.Closer 时会被关闭
+// 关闭只会停止后台任务（例如 failover 的健康检查），正在使用旧磁盘的调用方不受影响
+func (this *Factory) Reload(name string, config ...contracts.Fields) contracts.FileSystem {
+	this.mutex.Lock()
+	if len(config) > 0 {
+		var disks = make(map[string]contracts.Fields, len(this.config.Disks)+1)
+		for key, value := range this.config.Disks {
+			disks[key] = value
+		}
+		disks[name] = config[0]
+		this.config.Disks = disks
+	}
+	var entry = this.disks[name]
+	delete(this.disks, name)
+	this.mutex.Unlock()
+
+	this.release(name, entry)
+	return this.Disk(name)
+}
+
+// set 使用给定的磁盘替换同名磁盘
+func (this *Factory) set(name string, disk contracts.FileSystem) {
+	var entry = &diskEntry{disk: disk}
+	entry.once.Do(func() {})
+
+	this.mutex.Lock()
+	var replaced = this.disks[name]
+	this.disks[name] = entry
+	this.mutex.Unlock()
+
+	this.release(name, replaced)
+}
+
+// release 关闭被移除的磁盘，磁盘仍在创建时等待创建完成
+func (this *Factory) release(name string, entry *diskEntry) {
+	if entry == nil {
+		return
+	}
+	// 还没有开始创建时标记为完成，等待中的调用方会重新获取磁盘
+	entry.once.Do(func() {})
+	if closer, isCloser := entry.disk.(io.Closer); isCloser {
+		if err := closer.Close(); err != nil {
+			logs.WithError(err).WithField("disk", name).Warn("filesystem.Factory: failed to close disk")
+		}
+	}
+}
+
+// forget 移除创建失败的磁盘，磁盘已经被替换时不做处理
+func (this *Factory) forget(name string, entry *diskEntry) {
+	this.mutex.Lock()
+	defer this.mutex.Unlock()
+
+	if this.disks[name] == entry {
+		delete(this.disks, name)
+	}
+}
+
 func (this *Factory) get(name string) contracts.FileSystem {
+	this.mutex.RLock()
 	var (
 		config = this.config.Disks[name]
 		driver = utils.GetStringField(config, "driver", this.config.Default)
 	)
 	var driveProvider, existsProvider = this.drivers[driver]
+	this.mutex.RUnlock()
+
 	if !existsProvider {
 		logs.WithError(UndefinedDefineErr).Error(fmt.Sprintf("filesystem.Factory: unsupported file system %s", driver))
 		panic(Exception{exceptions.WithError(UndefinedDefineErr, config)})
 	}
-	return driveProvider(name, config)
+	var disk = driveProvider(name, config)
+	if disk == nil {
+		logs.WithError(InvalidDiskErr).Error(fmt.Sprintf("filesystem.Factory: driver %s returned no disk for %s", driver, name))
+		panic(Exception{exceptions.WithError(InvalidDiskErr, config)})
+	}
+	if utils.GetBoolField(config, "read_only") {
+		return adapters.NewReadOnly(name, disk)
+	}
+	return disk
 }
 
 func (this *Factory) Name() string {
@@ -82,6 +225,11 @@ func (this *Factory) ReadStream(path string) (*bufio.Reader, error) {
 	return this.Disk(this.config.Default).ReadStream(path)
 }
 
+// ReadRange 读取默认磁盘中文件的部分内容
+func (this *Factory) ReadRange(path string, offset, length int64) (io.ReadCloser, error) {
+	return adapters.ReadRange(this.Disk(this.config.Default), path, offset, length)
+}
+
 func (this *Factory) Put(path, contents string) error {
 	return this.Disk(this.config.Default).Put(path, contents)
 }
@@ -90,6 +238,31 @@ func (this *Factory) WriteStream(path string, contents string) error {
 	return this.Disk(this.config.Default).WriteStream(path, contents)
 }
 
+// PutStream 流式写入默认磁盘，磁盘不支持流式写入时退化为整体写入
+func (this *Factory) PutStream(path string, r io.Reader, opts ...file.WriteOption) (int64, error) {
+	return adapters.PutStream(this.Disk(this.config.Default), path, r, opts...)
+}
+
+// Url 获取默认磁盘中文件的访问地址，磁盘不支持时返回空字符串
+func (this *Factory) Url(path string) string {
+	var url, _ = adapters.Url(this.Disk(this.config.Default), path)
+	return url
+}
+
+// TemporaryUrl 获取默认磁盘中文件的临时地址，ttl 优先于磁盘配置的 ttl，磁盘不支持时返回 ErrUnsupported
+func (this *Factory) TemporaryUrl(path string, ttl time.Duration, opts ...file.UrlOption) (string, error) {
+	return adapters.TemporaryUrl(this.Disk(this.config.Default), path, ttl, opts...)
+}
+
+// UrlGenerator 获取磁盘的地址生成器，磁盘不支持生成地址时返回 ErrUnsupported，包装磁盘取决于被包装的磁盘
+func (this *Factory) UrlGenerator(name string) (file.UrlGenerator, error) {
+	var disk = this.Disk(name)
+	if generator, isGenerator := disk.(file.UrlGenerator); isGenerator && adapters.SupportsUrls(disk) {
+		return generator, nil
+	}
+	return nil, file.NewError("url", name, "", file.ErrUnsupported, nil)
+}
+
 func (this *Factory) GetVisibility(path string) contracts.FileVisibility {
 	return this.Disk(this.config.Default).GetVisibility(path)
 }
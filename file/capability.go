@@ -0,0 +1,60 @@
+package file
+
+import (
+	"io"
+	"time"
+)
+
+// StreamWriter 支持从 io.Reader 流式写入的磁盘，写入时不需要把整个文件加载到内存中
+type StreamWriter interface {
+	// PutStream 将 r 中的内容写入文件，返回写入的字节数
+	// write the contents of r to a file and return the number of bytes written.
+	PutStream(path string, r io.Reader, opts ...WriteOption) (int64, error)
+}
+
+// Opener 支持打开可关闭、可定位的读取句柄的磁盘，调用方读取完成后需要关闭句柄
+type Opener interface {
+	// Open 打开文件用于读取
+	// open a file for reading.
+	Open(path string) (io.ReadSeekCloser, error)
+}
+
+// RangeReader 支持读取文件部分内容的磁盘
+type RangeReader interface {
+	// ReadRange 读取从 offset 开始的 length 个字节，length 小于 0 时读取到文件末尾
+	// offset 小于 0 或者大于文件大小时返回 ErrInvalidRange
+	// read length bytes starting at offset, read to the end of the file when length is negative.
+	ReadRange(path string, offset, length int64) (io.ReadCloser, error)
+}
+
+// Toucher 支持修改文件修改时间的磁盘
+type Toucher interface {
+	// Touch 设置文件的修改时间
+	// set the modification time of a file.
+	Touch(path string, modTime time.Time) error
+}
+
+// Checksummer 支持获取文件 MD5 校验值的磁盘，无法提供 MD5 时返回 ErrUnsupported
+type Checksummer interface {
+	// Checksum 获取文件内容的 MD5，十六进制小写
+	// get the hex encoded md5 of a file.
+	Checksum(path string) (string, error)
+}
+
+// UrlGenerator 可以生成文件访问地址的磁盘
+type UrlGenerator interface {
+	// Url 获取文件的访问地址，私有空间返回使用磁盘默认有效期签名的地址，无法生成地址时返回空字符串
+	// get the url of a file, returns an empty string when the disk can not serve urls.
+	Url(path string) string
+
+	// TemporaryUrl 获取在 ttl 之后过期的访问地址，ttl 小于等于 0 时使用磁盘配置的有效期，无法生成时返回 ErrUnsupported
+	// get a url that expires after ttl.
+	TemporaryUrl(path string, ttl time.Duration, opts ...UrlOption) (string, error)
+}
+
+// StreamAppender 支持从 io.Reader 流式追加内容的磁盘，追加不需要重写已有内容
+type StreamAppender interface {
+	// AppendStream 将 r 中的内容追加到文件末尾，文件不存在时创建，出错时已经追加的内容会保留，返回追加的字节数
+	// append the contents of r to a file and return the number of bytes appended.
+	AppendStream(path string, r io.Reader) (int64, error)
+}
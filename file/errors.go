@@ -0,0 +1,115 @@
+package file
+
+import (
+	"errors"
+	"io/fs"
+	"syscall"
+)
+
+// kind 错误类型，可以与 io/fs 中对应的错误比较
+type kind struct {
+	msg    string
+	target error
+}
+
+func (this *kind) Error() string {
+	return this.msg
+}
+
+func (this *kind) Unwrap() error {
+	return this.target
+}
+
+var (
+	// ErrNotFound 文件或目录不存在，满足 errors.Is(err, fs.ErrNotExist)
+	ErrNotFound error = &kind{"file not found", fs.ErrNotExist}
+
+	// ErrAlreadyExists 文件或目录已存在，满足 errors.Is(err, fs.ErrExist)
+	ErrAlreadyExists error = &kind{"file already exists", fs.ErrExist}
+
+	// ErrPermission 没有权限，满足 errors.Is(err, fs.ErrPermission)
+	ErrPermission error = &kind{"permission denied", fs.ErrPermission}
+
+	// ErrNotDirectory 路径中的上级不是目录
+	ErrNotDirectory error = &kind{"not a directory", nil}
+
+	// ErrUnsupported 磁盘不支持该操作
+	ErrUnsupported error = &kind{"operation not supported", nil}
+
+	// ErrInvalidRange 读取的范围超出了文件大小
+	ErrInvalidRange error = &kind{"invalid range", fs.ErrInvalid}
+
+	// ErrOutsideRoot 路径超出了磁盘的根目录，满足 errors.Is(err, fs.ErrPermission)
+	ErrOutsideRoot error = &kind{"path is outside of the disk root", fs.ErrPermission}
+
+	// ErrReadOnly 磁盘是只读的，满足 errors.Is(err, fs.ErrPermission)
+	ErrReadOnly error = &kind{"disk is read-only", fs.ErrPermission}
+)
+
+// Error 带有磁盘名称以及路径的错误，Err 是上面定义的错误类型之一，Cause 是适配器的原始错误
+type Error struct {
+	Op    string
+	Disk  string
+	Path  string
+	Err   error
+	Cause error
+}
+
+func (this *Error) Error() string {
+	var msg = "filesystem: " + this.Op + " " + this.Disk + ":" + this.Path + ": " + this.Err.Error()
+	if this.Cause != nil && this.Cause != this.Err {
+		msg += ": " + this.Cause.Error()
+	}
+	return msg
+}
+
+func (this *Error) Unwrap() error {
+	return this.Err
+}
+
+// Is 同时匹配原始错误，例如 errors.Is(err, syscall.ENOENT)
+func (this *Error) Is(target error) bool {
+	return this.Cause != nil && errors.Is(this.Cause, target)
+}
+
+// As 同时匹配原始错误，例如 errors.As(err, &pathErr)
+func (this *Error) As(target interface{}) bool {
+	return this.Cause != nil && errors.As(this.Cause, target)
+}
+
+// NewError 创建指定类型的错误，cause 可以为空
+func NewError(op, disk, path string, err, cause error) error {
+	return &Error{Op: op, Disk: disk, Path: path, Err: err, Cause: cause}
+}
+
+// Wrap 将适配器的原始错误转换为 *Error，根据 io/fs 的错误判断类型，无法识别的错误类型保持原样
+func Wrap(op, disk, path string, err error) error {
+	if err == nil {
+		return nil
+	}
+	var wrapped *Error
+	if errors.As(err, &wrapped) {
+		return err
+	}
+	return NewError(op, disk, path, Kind(err), err)
+}
+
+// Kind 获取错误对应的类型，无法识别时返回 err 本身
+func Kind(err error) error {
+	for _, item := range []error{ErrNotFound, ErrAlreadyExists, ErrPermission, ErrNotDirectory, ErrUnsupported, ErrInvalidRange, ErrOutsideRoot, ErrReadOnly} {
+		if errors.Is(err, item) {
+			return item
+		}
+	}
+	switch {
+	case errors.Is(err, syscall.ENOTDIR):
+		return ErrNotDirectory
+	case errors.Is(err, fs.ErrNotExist):
+		return ErrNotFound
+	case errors.Is(err, fs.ErrExist):
+		return ErrAlreadyExists
+	case errors.Is(err, fs.ErrPermission):
+		return ErrPermission
+	}
+	return err
+}
@@ -0,0 +1,12 @@
+package file
+
+import "github.com/goal-web/contracts"
+
+// File 所有内置适配器返回的文件都实现了该接口
+type File interface {
+	contracts.File
+
+	// Path 获取文件相对于磁盘根目录的路径，不以 / 开头
+	// get the path of the file relative to the disk root.
+	Path() string
+}
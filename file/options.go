@@ -0,0 +1,84 @@
+package file
+
+import "io/fs"
+
+// WriteOptions 写入文件时的可选参数
+type WriteOptions struct {
+	// Perm 写入完成后设置的权限，为 0 时使用磁盘的默认权限
+	Perm fs.FileMode
+
+	// ContentType 文件的 MIME 类型，对象存储会将其保存为元数据
+	ContentType string
+
+	// Metadata 自定义元数据，仅对象存储支持
+	Metadata map[string]string
+}
+
+type WriteOption func(options *WriteOptions)
+
+// WithPerm 写入完成后设置文件权限
+func WithPerm(perm fs.FileMode) WriteOption {
+	return func(options *WriteOptions) {
+		options.Perm = perm
+	}
+}
+
+// WithContentType 设置文件的 MIME 类型
+func WithContentType(contentType string) WriteOption {
+	return func(options *WriteOptions) {
+		options.ContentType = contentType
+	}
+}
+
+// WithMetadata 添加自定义元数据
+func WithMetadata(key, value string) WriteOption {
+	return func(options *WriteOptions) {
+		if options.Metadata == nil {
+			options.Metadata = make(map[string]string)
+		}
+		options.Metadata[key] = value
+	}
+}
+
+// ApplyWriteOptions 合并写入参数
+func ApplyWriteOptions(opts ...WriteOption) WriteOptions {
+	var options WriteOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// UrlOptions 生成访问地址时的可选参数
+type UrlOptions struct {
+	// Download 非空时浏览器会以该文件名下载文件，而不是直接打开
+	Download string
+
+	// ContentType 覆盖响应的 MIME 类型，七牛不支持
+	ContentType string
+}
+
+type UrlOption func(options *UrlOptions)
+
+// WithDownload 以给定的文件名下载文件
+func WithDownload(filename string) UrlOption {
+	return func(options *UrlOptions) {
+		options.Download = filename
+	}
+}
+
+// WithResponseContentType 覆盖响应的 MIME 类型
+func WithResponseContentType(contentType string) UrlOption {
+	return func(options *UrlOptions) {
+		options.ContentType = contentType
+	}
+}
+
+// ApplyUrlOptions 合并生成地址的参数
+func ApplyUrlOptions(opts ...UrlOption) UrlOptions {
+	var options UrlOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
@@ -0,0 +1,459 @@
+// Package filesystemtest 提供文件系统驱动的一致性测试，内置驱动以及通过 Factory.Extend 注册的第三方驱动都可以使用
+package filesystemtest
+
+import (
+	"errors"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem/file"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RunConformance 对 newDisk 创建的磁盘执行一致性测试，每个子测试都会调用 newDisk 获取一个空磁盘
+func RunConformance(t *testing.T, newDisk func() contracts.FileSystem) {
+	var cases = []struct {
+		name string
+		run  func(t *testing.T, disk contracts.FileSystem)
+	}{
+		{"PutAndGet", testPutAndGet},
+		{"NestedPaths", testNestedPaths},
+		{"PathSpellings", testPathSpellings},
+		{"PutStream", testPutStream},
+		{"Open", testOpen},
+		{"ReadRange", testReadRange},
+		{"NotFound", testNotFound},
+		{"AppendAndPrepend", testAppendAndPrepend},
+		{"Delete", testDelete},
+		{"CopyOverwrites", testCopyOverwrites},
+		{"CopyToItself", testCopyToItself},
+		{"MoveOverwrites", testMoveOverwrites},
+		{"SizeAndLastModified", testSizeAndLastModified},
+		{"Visibility", testVisibility},
+		{"Listing", testListing},
+		{"Directories", testDirectories},
+	}
+
+	for _, item := range cases {
+		var run = item.run
+		t.Run(item.name, func(t *testing.T) {
+			run(t, newDisk())
+		})
+	}
+}
+
+func must(t *testing.T, err error, action string) {
+	t.Helper()
+	if err != nil {
+		t.Fatalf("%s: unexpected error: %v", action, err)
+	}
+}
+
+func assertContents(t *testing.T, disk contracts.FileSystem, path, expected string) {
+	t.Helper()
+	var contents, err = disk.Get(path)
+	if err != nil {
+		t.Errorf("Get(%q): unexpected error: %v", path, err)
+		return
+	}
+	if contents != expected {
+		t.Errorf("Get(%q) = %q, want %q", path, contents, expected)
+	}
+	bytes, err := disk.Read(path)
+	if err != nil || string(bytes) != expected {
+		t.Errorf("Read(%q) = %q, %v, want %q", path, bytes, err, expected)
+	}
+}
+
+func assertNotExist(t *testing.T, err error, action string) {
+	t.Helper()
+	if !errors.Is(err, fs.ErrNotExist) || !errors.Is(err, file.ErrNotFound) {
+		t.Errorf("%s: expected an error matching fs.ErrNotExist and file.ErrNotFound, got %v", action, err)
+	}
+	var wrapped *file.Error
+	if err != nil && (!errors.As(err, &wrapped) || wrapped.Disk == "" || wrapped.Path == "") {
+		t.Errorf("%s: expected a *file.Error with disk and path, got %T", action, err)
+	}
+}
+
+func assertStrings(t *testing.T, actual, expected []string, action string) {
+	t.Helper()
+	if len(actual) != len(expected) {
+		t.Errorf("%s = %q, want %q", action, actual, expected)
+		return
+	}
+	for i := range actual {
+		if actual[i] != expected[i] {
+			t.Errorf("%s = %q, want %q", action, actual, expected)
+			return
+		}
+	}
+}
+
+func paths(t *testing.T, files []contracts.File) []string {
+	t.Helper()
+	var results = make([]string, 0, len(files))
+	for _, item := range files {
+		var pathFile, ok = item.(file.File)
+		if !ok {
+			t.Fatalf("%T does not implement file.File", item)
+		}
+		results = append(results, pathFile.Path())
+	}
+	return results
+}
+
+func testPutAndGet(t *testing.T, disk contracts.FileSystem) {
+	must(t, disk.Put("put.txt", "goal"), "Put")
+	assertContents(t, disk, "put.txt", "goal")
+	assertContents(t, disk, "/put.txt", "goal")
+
+	must(t, disk.Put("put.txt", "overwritten"), "Put overwrite")
+	assertContents(t, disk, "put.txt", "overwritten")
+
+	must(t, disk.WriteStream("stream.txt", "stream"), "WriteStream")
+	assertContents(t, disk, "stream.txt", "stream")
+
+	var reader, err = disk.ReadStream("stream.txt")
+	must(t, err, "ReadStream")
+	line, _ := reader.ReadString('\n')
+	if line != "stream" {
+		t.Errorf("ReadStream = %q, want %q", line, "stream")
+	}
+
+	if !disk.Exists("put.txt") {
+		t.Errorf("Exists(%q) = false after Put", "put.txt")
+	}
+}
+
+func testPutStream(t *testing.T, disk contracts.FileSystem) {
+	var writer, ok = disk.(file.StreamWriter)
+	if !ok {
+		t.Skipf("%T does not implement file.StreamWriter", disk)
+	}
+
+	var contents = strings.Repeat("goal-web", 1024)
+	var written, err = writer.PutStream("stream/put.txt", strings.NewReader(contents))
+	must(t, err, "PutStream")
+	if written != int64(len(contents)) {
+		t.Errorf("PutStream wrote %d bytes, want %d", written, len(contents))
+	}
+	assertContents(t, disk, "stream/put.txt", contents)
+
+	written, err = writer.PutStream("stream/put.txt", strings.NewReader(""))
+	must(t, err, "PutStream empty")
+	if written != 0 {
+		t.Errorf("PutStream of an empty reader wrote %d bytes", written)
+	}
+	assertContents(t, disk, "stream/put.txt", "")
+}
+
+func testOpen(t *testing.T, disk contracts.FileSystem) {
+	var opener, ok = disk.(file.Opener)
+	if !ok {
+		t.Skipf("%T does not implement file.Opener", disk)
+	}
+	must(t, disk.Put("open/file.txt", "0123456789"), "Put")
+
+	var handle, err = opener.Open("open/file.txt")
+	must(t, err, "Open")
+	defer handle.Close()
+
+	var buffer = make([]byte, 4)
+	_, err = io.ReadFull(handle, buffer)
+	must(t, err, "Read")
+	if string(buffer) != "0123" {
+		t.Errorf("Read = %q, want %q", buffer, "0123")
+	}
+
+	var steps = []struct {
+		offset   int64
+		whence   int
+		position int64
+		expected string
+	}{
+		{6, io.SeekStart, 6, "6789"},
+		{-7, io.SeekCurrent, 3, "3456"},
+		{-3, io.SeekEnd, 7, "789"},
+	}
+	for _, step := range steps {
+		position, err := handle.Seek(step.offset, step.whence)
+		must(t, err, "Seek")
+		if position != step.position {
+			t.Errorf("Seek(%d, %d) = %d, want %d", step.offset, step.whence, position, step.position)
+		}
+		var buffer = make([]byte, len(step.expected))
+		_, err = io.ReadFull(handle, buffer)
+		must(t, err, "Read after Seek")
+		if string(buffer) != step.expected {
+			t.Errorf("Read after Seek(%d, %d) = %q, want %q", step.offset, step.whence, buffer, step.expected)
+		}
+	}
+	if n, err := handle.Read(buffer); n != 0 || err != io.EOF {
+		t.Errorf("Read at the end = %d, %v, want 0, io.EOF", n, err)
+	}
+	must(t, handle.Close(), "Close")
+
+	_, err = opener.Open("open/missing.txt")
+	assertNotExist(t, err, "Open")
+}
+
+func testReadRange(t *testing.T, disk contracts.FileSystem) {
+	var ranger, ok = disk.(file.RangeReader)
+	if !ok {
+		t.Skipf("%T does not implement file.RangeReader", disk)
+	}
+	must(t, disk.Put("range/file.txt", "0123456789"), "Put")
+
+	var cases = []struct {
+		offset, length int64
+		expected       string
+	}{
+		{0, 4, "0123"},
+		{3, 4, "3456"},
+		{6, -1, "6789"},
+		{8, 100, "89"},
+		{10, 5, ""},
+		{2, 0, ""},
+	}
+	for _, item := range cases {
+		var reader, err = ranger.ReadRange("range/file.txt", item.offset, item.length)
+		must(t, err, "ReadRange")
+		contents, err := ioutil.ReadAll(reader)
+		must(t, err, "ReadRange read")
+		must(t, reader.Close(), "ReadRange close")
+		if string(contents) != item.expected {
+			t.Errorf("ReadRange(%d, %d) = %q, want %q", item.offset, item.length, contents, item.expected)
+		}
+	}
+
+	for _, offset := range []int64{-1, 11, 1000} {
+		if _, err := ranger.ReadRange("range/file.txt", offset, 1); !errors.Is(err, file.ErrInvalidRange) {
+			t.Errorf("ReadRange(%d, 1): expected file.ErrInvalidRange, got %v", offset, err)
+		}
+	}
+
+	var _, err = ranger.ReadRange("range/missing.txt", 0, 1)
+	assertNotExist(t, err, "ReadRange")
+}
+
+func testNestedPaths(t *testing.T, disk contracts.FileSystem) {
+	must(t, disk.Put("a/b/c/deep.txt", "deep"), "Put nested without parents")
+	assertContents(t, disk, "a/b/c/deep.txt", "deep")
+
+	for _, path := range []string{"a", "a/b", "a/b/c", "/a/b/"} {
+		if !disk.Exists(path) {
+			t.Errorf("Exists(%q) = false, parent directories should exist", path)
+		}
+	}
+
+	must(t, disk.WriteStream("x/y/stream.txt", "stream"), "WriteStream nested")
+	must(t, disk.Append("x/y/z/append.txt", "append"), "Append nested")
+	assertContents(t, disk, "x/y/z/append.txt", "append")
+}
+
+// testPathSpellings a.txt 与 /a.txt 是同一个文件，缓存之类的包装驱动也需要一致
+func testPathSpellings(t *testing.T, disk contracts.FileSystem) {
+	must(t, disk.Put("a.txt", "old"), "Put")
+	assertContents(t, disk, "a.txt", "old")
+	if size, err := disk.Size("a.txt"); err != nil || size != 3 {
+		t.Errorf("Size(a.txt) = %d, %v, want 3", size, err)
+	}
+
+	must(t, disk.Put("/a.txt", "new!!"), "Put with leading slash")
+	assertContents(t, disk, "a.txt", "new!!")
+	assertContents(t, disk, "/a.txt", "new!!")
+	if size, err := disk.Size("a.txt"); err != nil || size != 5 {
+		t.Errorf("Size(a.txt) after Put(/a.txt) = %d, %v, want 5", size, err)
+	}
+
+	if disk.Exists("/b.txt") {
+		t.Errorf("Exists(/b.txt) = true before Put")
+	}
+	must(t, disk.Put("b.txt", "b"), "Put")
+	if !disk.Exists("/b.txt") {
+		t.Errorf("Exists(/b.txt) = false after Put(b.txt)")
+	}
+
+	must(t, disk.Delete("/a.txt"), "Delete with leading slash")
+	if disk.Exists("a.txt") {
+		t.Errorf("Exists(a.txt) = true after Delete(/a.txt)")
+	}
+}
+
+func testNotFound(t *testing.T, disk contracts.FileSystem) {
+	var err error
+	_, err = disk.Get("missing.txt")
+	assertNotExist(t, err, "Get")
+	_, err = disk.Read("missing.txt")
+	assertNotExist(t, err, "Read")
+	_, err = disk.ReadStream("missing.txt")
+	assertNotExist(t, err, "ReadStream")
+	_, err = disk.Size("missing.txt")
+	assertNotExist(t, err, "Size")
+	_, err = disk.LastModified("missing.txt")
+	assertNotExist(t, err, "LastModified")
+	assertNotExist(t, disk.Delete("missing.txt"), "Delete")
+	assertNotExist(t, disk.Copy("missing.txt", "copy.txt"), "Copy")
+	assertNotExist(t, disk.Move("missing.txt", "move.txt"), "Move")
+
+	if disk.Exists("missing.txt") {
+		t.Errorf("Exists(%q) = true for a missing file", "missing.txt")
+	}
+	if disk.Exists("copy.txt") || disk.Exists("move.txt") {
+		t.Errorf("failed Copy/Move must not create the destination")
+	}
+	if files := disk.Files("missing"); len(files) != 0 {
+		t.Errorf("Files of a missing directory = %d files, want 0", len(files))
+	}
+	if directories := disk.AllDirectories("missing"); len(directories) != 0 {
+		t.Errorf("AllDirectories of a missing directory = %q, want none", directories)
+	}
+}
+
+func testAppendAndPrepend(t *testing.T, disk contracts.FileSystem) {
+	must(t, disk.Append("append.txt", "goal"), "Append to missing file")
+	must(t, disk.Append("append.txt", "-web"), "Append")
+	assertContents(t, disk, "append.txt", "goal-web")
+
+	must(t, disk.Prepend("prepend.txt", "web"), "Prepend to missing file")
+	must(t, disk.Prepend("prepend.txt", "goal-"), "Prepend")
+	assertContents(t, disk, "prepend.txt", "goal-web")
+}
+
+func testDelete(t *testing.T, disk contracts.FileSystem) {
+	must(t, disk.Put("dir/delete.txt", "goal"), "Put")
+	must(t, disk.Delete("dir/delete.txt"), "Delete")
+	if disk.Exists("dir/delete.txt") {
+		t.Errorf("Exists = true after Delete")
+	}
+
+	must(t, disk.Put("tree/a.txt", "a"), "Put")
+	must(t, disk.Put("tree/sub/b.txt", "b"), "Put")
+	must(t, disk.DeleteDirectory("tree"), "DeleteDirectory")
+	if disk.Exists("tree/sub/b.txt") || disk.Exists("tree") {
+		t.Errorf("DeleteDirectory must remove the directory recursively")
+	}
+	must(t, disk.DeleteDirectory("missing"), "DeleteDirectory of a missing directory")
+}
+
+func testCopyOverwrites(t *testing.T, disk contracts.FileSystem) {
+	must(t, disk.Put("source.txt", "source"), "Put")
+	must(t, disk.Put("nested/target.txt", "target"), "Put")
+
+	must(t, disk.Copy("source.txt", "nested/target.txt"), "Copy over an existing file")
+	assertContents(t, disk, "nested/target.txt", "source")
+	assertContents(t, disk, "source.txt", "source")
+
+	must(t, disk.Copy("source.txt", "new/dir/copy.txt"), "Copy into missing directories")
+	assertContents(t, disk, "new/dir/copy.txt", "source")
+}
+
+func testCopyToItself(t *testing.T, disk contracts.FileSystem) {
+	must(t, disk.Put("nested/self.txt", "self"), "Put")
+
+	must(t, disk.Copy("nested/self.txt", "nested/self.txt"), "Copy to the same path")
+	assertContents(t, disk, "nested/self.txt", "self")
+}
+
+func testMoveOverwrites(t *testing.T, disk contracts.FileSystem) {
+	must(t, disk.Put("source.txt", "source"), "Put")
+	must(t, disk.Put("nested/target.txt", "target"), "Put")
+
+	must(t, disk.Move("source.txt", "nested/target.txt"), "Move over an existing file")
+	assertContents(t, disk, "nested/target.txt", "source")
+	if disk.Exists("source.txt") {
+		t.Errorf("Exists(source) = true after Move")
+	}
+
+	must(t, disk.Move("nested/target.txt", "new/dir/moved.txt"), "Move into missing directories")
+	assertContents(t, disk, "new/dir/moved.txt", "source")
+}
+
+func testSizeAndLastModified(t *testing.T, disk contracts.FileSystem) {
+	var before = time.Now().Add(-time.Minute)
+	must(t, disk.Put("size.txt", "goal-web"), "Put")
+
+	var size, err = disk.Size("size.txt")
+	must(t, err, "Size")
+	if size != 8 {
+		t.Errorf("Size = %d, want 8", size)
+	}
+
+	modified, err := disk.LastModified("size.txt")
+	must(t, err, "LastModified")
+	if modified.Before(before) || modified.After(time.Now().Add(time.Minute)) {
+		t.Errorf("LastModified = %s, want close to now", modified)
+	}
+}
+
+// testVisibility 可见性表示其他人是否可读，不支持修改可见性的驱动需要在 SetVisibility 中返回 file.ErrUnsupported
+func testVisibility(t *testing.T, disk contracts.FileSystem) {
+	must(t, disk.Put("visibility.txt", "goal"), "Put")
+
+	if err := disk.SetVisibility("visibility.txt", 0644); errors.Is(err, file.ErrUnsupported) {
+		t.Skipf("SetVisibility is not supported: %v", err)
+	} else {
+		must(t, err, "SetVisibility(0644)")
+	}
+	if visibility := disk.GetVisibility("visibility.txt"); visibility != file.VISIBLE {
+		t.Errorf("GetVisibility after SetVisibility(0644) = %d, want VISIBLE", visibility)
+	}
+
+	must(t, disk.SetVisibility("visibility.txt", 0600), "SetVisibility(0600)")
+	if visibility := disk.GetVisibility("visibility.txt"); visibility != file.INVISIBLE {
+		t.Errorf("GetVisibility after SetVisibility(0600) = %d, want INVISIBLE", visibility)
+	}
+}
+
+func testListing(t *testing.T, disk contracts.FileSystem) {
+	for _, path := range []string{"list/b.txt", "list/a.txt", "list/c/d.txt", "list/c/e/f.txt", "list-other.txt"} {
+		must(t, disk.Put(path, path), "Put")
+	}
+
+	var files = disk.Files("list")
+	assertStrings(t, paths(t, files), []string{"list/a.txt", "list/b.txt"}, "Files(list)")
+	assertStrings(t, paths(t, disk.Files("/list/")), []string{"list/a.txt", "list/b.txt"}, "Files(/list/)")
+
+	var allFiles = disk.AllFiles("list")
+	var all = paths(t, allFiles)
+	assertStrings(t, all, []string{"list/a.txt", "list/b.txt", "list/c/d.txt", "list/c/e/f.txt"}, "AllFiles(list)")
+	if !sort.StringsAreSorted(all) {
+		t.Errorf("AllFiles must be sorted by path: %q", all)
+	}
+
+	for _, item := range allFiles {
+		var path = item.(file.File).Path()
+		if item.ReadString() != path || string(item.Read()) != path {
+			t.Errorf("File(%q).ReadString() = %q", path, item.ReadString())
+		}
+		if item.Disk() != disk.Name() {
+			t.Errorf("File(%q).Disk() = %q, want %q", path, item.Disk(), disk.Name())
+		}
+		if item.IsDir() || item.Size() != int64(len(path)) {
+			t.Errorf("File(%q) has unexpected info: dir=%v size=%d", path, item.IsDir(), item.Size())
+		}
+	}
+}
+
+func testDirectories(t *testing.T, disk contracts.FileSystem) {
+	must(t, disk.MakeDirectory("dirs/empty/nested"), "MakeDirectory with missing parents")
+	if !disk.Exists("dirs/empty/nested") {
+		t.Errorf("Exists = false after MakeDirectory")
+	}
+	must(t, disk.MakeDirectory("dirs/empty"), "MakeDirectory of an existing directory")
+
+	must(t, disk.Put("dirs/b/file.txt", "b"), "Put")
+	must(t, disk.Put("dirs/a/c/file.txt", "c"), "Put")
+
+	assertStrings(t, disk.Directories("dirs"), []string{"a", "b", "empty"}, "Directories(dirs)")
+	assertStrings(t, disk.AllDirectories("dirs"), []string{"a", "a/c", "b", "empty", "empty/nested"}, "AllDirectories(dirs)")
+
+	if files := disk.AllFiles("dirs/empty"); len(files) != 0 {
+		t.Errorf("AllFiles(dirs/empty) = %q, directory markers must not be listed as files", paths(t, files))
+	}
+}
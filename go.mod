@@ -1,10 +1,11 @@
 module github.com/goal-web/filesystem
 
-go 1.19
+go 1.22
 
 require (
 	github.com/goal-web/contracts v0.1.62
 	github.com/goal-web/supports v0.1.16
+	github.com/klauspost/compress v1.18.0
 	github.com/qiniu/go-sdk/v7 v7.11.1
 	github.com/stretchr/testify v1.7.0
 )
@@ -0,0 +1,139 @@
+package filesystem
+
+import (
+	"errors"
+	"fmt"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem/adapters"
+	"github.com/goal-web/filesystem/file"
+	"github.com/goal-web/supports/logs"
+	"io/fs"
+	"mime"
+	"net/http"
+	pathpkg "path"
+	"strings"
+)
+
+// HandlerOptions 文件服务的可选参数
+type HandlerOptions struct {
+	// Prefix 挂载路径，请求路径去掉该前缀后作为文件路径，例如 /files
+	Prefix string
+
+	// Signer 校验带有 signature 参数的请求，INVISIBLE 文件只能通过签名地址访问
+	// 为空时使用磁盘自身的签名器（配置了 url 的本地磁盘），使用签名地址时 Prefix 需要与签名器地址的路径一致
+	Signer *adapters.UrlSigner
+
+	// CacheControl 公开文件响应的 Cache-Control，签名访问的响应始终为 private
+	CacheControl string
+}
+
+// Handler 创建输出磁盘中文件的 http.Handler，只支持 GET 以及 HEAD
+// 根据 Size 以及 LastModified 生成 ETag，支持 Range、If-Range、If-None-Match 以及 If-Modified-Since
+// 没有签名的请求访问 INVISIBLE 文件时返回 404，签名无效或者过期时返回 403
+func Handler(disk contracts.FileSystem, opts HandlerOptions) http.Handler {
+	opts.Prefix = strings.TrimSuffix(opts.Prefix, "/")
+	if signer, isSigner := disk.(interface{ Signer() *adapters.UrlSigner }); isSigner && opts.Signer == nil {
+		opts.Signer = signer.Signer()
+	}
+	return &fileHandler{disk: disk, options: opts}
+}
+
+type fileHandler struct {
+	disk    contracts.FileSystem
+	options HandlerOptions
+}
+
+func (this *fileHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	var (
+		path    string
+		options file.UrlOptions
+		signed  = r.URL.Query().Has("signature")
+	)
+	if signed {
+		if this.options.Signer == nil {
+			http.Error(w, adapters.InvalidSignatureErr.Error(), http.StatusForbidden)
+			return
+		}
+		var err error
+		if path, options, err = this.options.Signer.Verify(r); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	} else {
+		if r.URL.Path != this.options.Prefix && !strings.HasPrefix(r.URL.Path, this.options.Prefix+"/") {
+			http.NotFound(w, r)
+			return
+		}
+		path = strings.TrimPrefix(pathpkg.Clean("/"+strings.TrimPrefix(r.URL.Path, this.options.Prefix)), "/")
+	}
+	if path == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	var size, err = this.disk.Size(path)
+	if err != nil {
+		this.error(w, r, path, err)
+		return
+	}
+	// 不暴露不可见文件是否存在
+	if !signed && this.disk.GetVisibility(path) == file.INVISIBLE {
+		http.NotFound(w, r)
+		return
+	}
+	modTime, err := this.disk.LastModified(path)
+	if err != nil {
+		this.error(w, r, path, err)
+		return
+	}
+
+	handle, err := adapters.Open(this.disk, path)
+	if err != nil {
+		this.error(w, r, path, err)
+		return
+	}
+	defer handle.Close()
+	if stat, isStat := handle.(interface{ Stat() (fs.FileInfo, error) }); isStat {
+		if info, statErr := stat.Stat(); statErr == nil && info.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+	}
+
+	var header = w.Header()
+	header.Set("ETag", fmt.Sprintf(`"%x-%x"`, modTime.UnixNano(), size))
+	switch {
+	case options.ContentType != "":
+		header.Set("Content-Type", options.ContentType)
+	case mime.TypeByExtension(pathpkg.Ext(path)) != "":
+		header.Set("Content-Type", mime.TypeByExtension(pathpkg.Ext(path)))
+	}
+	if options.Download != "" {
+		header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": options.Download}))
+	}
+	if signed {
+		header.Set("Cache-Control", "private")
+	} else if this.options.CacheControl != "" {
+		header.Set("Cache-Control", this.options.CacheControl)
+	}
+	// Content-Type 为空时 ServeContent 会根据内容检测
+	http.ServeContent(w, r, pathpkg.Base(path), modTime, handle)
+}
+
+func (this *fileHandler) error(w http.ResponseWriter, r *http.Request, path string, err error) {
+	switch {
+	case errors.Is(err, file.ErrNotFound), errors.Is(err, file.ErrOutsideRoot):
+		http.NotFound(w, r)
+	case errors.Is(err, file.ErrPermission):
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+	default:
+		logs.WithError(err).WithField("disk", this.disk.Name()).WithField("path", path).Error("filesystem.Handler: failed to serve file")
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
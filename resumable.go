@@ -0,0 +1,594 @@
+package filesystem
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem/adapters"
+	"github.com/goal-web/filesystem/file"
+	"github.com/goal-web/supports/logs"
+	"io"
+	"io/fs"
+	"net/http"
+	pathpkg "path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	UploadSessionNotFoundErr = errors.New("upload session not found")
+	UploadOffsetMismatchErr  = errors.New("upload offset does not match")
+)
+
+const (
+	// DefaultUploadExpiry 会话在最后一次写入之后的默认有效期
+	DefaultUploadExpiry = 24 * time.Hour
+
+	// DefaultUploadStateDirectory 默认保存会话状态以及分片的目录
+	DefaultUploadStateDirectory = ".uploads"
+
+	// TusVersion Handler 实现的 tus 协议版本
+	TusVersion = "1.0.0"
+)
+
+// ResumableOptions 断点续传的可选参数
+type ResumableOptions struct {
+	// Disk 保存最终文件的磁盘，为空时使用默认磁盘
+	Disk string
+
+	// Directory 保存最终文件的目录，文件名为会话 id 加上原始文件的扩展名
+	Directory string
+
+	// StateDisk 保存会话状态以及分片的磁盘，为空时使用 Disk，多个实例部署时需要使用共享的磁盘
+	StateDisk string
+
+	// StateDirectory 保存会话状态以及分片的目录，默认为 DefaultUploadStateDirectory
+	StateDirectory string
+
+	// MaxSize 单个文件的最大字节数，小于等于 0 时不限制
+	MaxSize int64
+
+	// Expiry 会话在最后一次写入之后的有效期，默认为 DefaultUploadExpiry
+	Expiry time.Duration
+
+	// Prefix Handler 的挂载路径，例如 /uploads
+	Prefix string
+
+	// WriteOptions 合并分片写入最终文件时的参数
+	WriteOptions []file.WriteOption
+
+	// OnComplete 文件上传完成后的回调
+	OnComplete func(session UploadSession)
+}
+
+// UploadSession 断点续传会话，保存在 StateDisk 中
+type UploadSession struct {
+	Id       string            `json:"id"`
+	Disk     string            `json:"disk"`
+	Path     string            `json:"path"`
+	Name     string            `json:"name"`
+	Size     int64             `json:"size"`
+	Offset   int64             `json:"offset"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+
+	// Append 为 true 时分片直接追加到目标磁盘的临时文件，否则分片保存在 StateDisk 中，完成时合并
+	Append bool `json:"append"`
+	// Chunks 已经保存的分片的起始位置
+	Chunks    []int64   `json:"chunks,omitempty"`
+	Completed bool      `json:"completed"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Resumable 断点续传，目标磁盘支持流式追加时分片直接追加到目标磁盘，否则分片先保存在 StateDisk 中
+// 完成后通过 PutStream 合并到目标磁盘，S3 以及七牛会使用各自的分片上传
+// 同一个会话的写入只在当前进程内互斥，客户端需要保证同一个会话不会并发写入
+type Resumable struct {
+	factory *Factory
+	options ResumableOptions
+	locks   sync.Map
+}
+
+// Resumable 创建断点续传
+func (this *Factory) Resumable(opts ResumableOptions) *Resumable {
+	opts.Disk = this.diskName(opts.Disk)
+	if opts.StateDisk == "" {
+		opts.StateDisk = opts.Disk
+	}
+	if opts.StateDirectory == "" {
+		opts.StateDirectory = DefaultUploadStateDirectory
+	}
+	if opts.Expiry <= 0 {
+		opts.Expiry = DefaultUploadExpiry
+	}
+	opts.Prefix = strings.TrimSuffix(opts.Prefix, "/")
+	return &Resumable{factory: this, options: opts}
+}
+
+func (this *Resumable) state() contracts.FileSystem {
+	return this.factory.Disk(this.options.StateDisk)
+}
+
+func (this *Resumable) statePath(id string) string {
+	return pathpkg.Join(this.options.StateDirectory, id+".json")
+}
+
+// chunkPath 分片按照起始位置命名，保存在以会话 id 命名的目录中
+func (this *Resumable) chunkPath(id string, offset int64) string {
+	return pathpkg.Join(this.options.StateDirectory, id, fmt.Sprintf("%020d", offset))
+}
+
+// partPath 追加模式下目标磁盘中的临时文件
+func (this *Resumable) partPath(id string) string {
+	return pathpkg.Join(this.options.StateDirectory, id+".part")
+}
+
+func (this *Resumable) lock(id string) func() {
+	var mutex, _ = this.locks.LoadOrStore(id, &sync.Mutex{})
+	mutex.(*sync.Mutex).Lock()
+	return mutex.(*sync.Mutex).Unlock
+}
+
+// acquire 读取会话并加锁，只为存在的会话创建锁，避免无效的 id 让锁无限增长
+func (this *Resumable) acquire(id string) (*UploadSession, func(), error) {
+	if _, err := this.read(id); err != nil {
+		return nil, nil, err
+	}
+	var unlock = this.lock(id)
+	// 加锁之前会话可能已经被删除
+	var session, err = this.read(id)
+	if err != nil {
+		this.locks.Delete(id)
+		unlock()
+		return nil, nil, err
+	}
+	return session, unlock, nil
+}
+
+// validUploadId 会话 id 来自请求路径，只接受 UUID 避免访问状态目录之外的文件
+func validUploadId(id string) bool {
+	if len(id) != 36 {
+		return false
+	}
+	for i, char := range id {
+		switch {
+		case i == 8 || i == 13 || i == 18 || i == 23:
+			if char != '-' {
+				return false
+			}
+		case !('0' <= char && char <= '9' || 'a' <= char && char <= 'f'):
+			return false
+		}
+	}
+	return true
+}
+
+func (this *Resumable) save(session *UploadSession) error {
+	var contents, err = json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	return this.state().Put(this.statePath(session.Id), string(contents))
+}
+
+// read 读取会话，不检查是否过期
+func (this *Resumable) read(id string) (*UploadSession, error) {
+	if !validUploadId(id) {
+		return nil, UploadSessionNotFoundErr
+	}
+	var contents, err = this.state().Read(this.statePath(id))
+	if errors.Is(err, file.ErrNotFound) {
+		return nil, UploadSessionNotFoundErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	var session UploadSession
+	if err = json.Unmarshal(contents, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// load 读取会话，过期的会话视为不存在
+func (this *Resumable) load(id string) (*UploadSession, error) {
+	var session, err = this.read(id)
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return nil, UploadSessionNotFoundErr
+	}
+	return session, nil
+}
+
+// Create 创建上传会话，size 为文件的总大小，name 为原始文件名
+func (this *Resumable) Create(size int64, name string, metadata map[string]string) (*UploadSession, error) {
+	if size < 0 {
+		return nil, fmt.Errorf("invalid upload length %d: %w", size, fs.ErrInvalid)
+	}
+	if this.options.MaxSize > 0 && size > this.options.MaxSize {
+		return nil, FileTooLargeErr
+	}
+
+	var (
+		id            = newUuid()
+		_, isAppender = this.factory.Disk(this.options.Disk).(file.StreamAppender)
+		now           = time.Now()
+		session       = &UploadSession{
+			Id:        id,
+			Disk:      this.options.Disk,
+			Path:      pathpkg.Join(this.options.Directory, id+strings.ToLower(pathpkg.Ext(name))),
+			Name:      name,
+			Size:      size,
+			Metadata:  metadata,
+			Append:    isAppender,
+			CreatedAt: now,
+			ExpiresAt: now.Add(this.options.Expiry),
+		}
+	)
+	if size == 0 {
+		if err := this.complete(session); err != nil {
+			return nil, err
+		}
+	}
+	if err := this.save(session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// Session 获取未过期的会话
+func (this *Resumable) Session(id string) (*UploadSession, error) {
+	return this.load(id)
+}
+
+// chunkReader 最多读取 remaining 个字节，还有更多内容时返回 FileTooLargeErr
+type chunkReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+func (this *chunkReader) Read(p []byte) (int, error) {
+	if this.remaining <= 0 {
+		var n, err = this.reader.Read(make([]byte, 1))
+		if n > 0 {
+			return 0, FileTooLargeErr
+		}
+		return 0, err
+	}
+	if int64(len(p)) > this.remaining {
+		p = p[:this.remaining]
+	}
+	var n, err = this.reader.Read(p)
+	this.remaining -= int64(n)
+	return n, err
+}
+
+// WriteChunk 写入从 offset 开始的分片，offset 必须等于会话当前的位置，写入全部内容后自动合并文件
+// 追加模式下写入中断时已经写入的内容会保留，会话的位置同样会更新
+func (this *Resumable) WriteChunk(id string, offset int64, r io.Reader) (*UploadSession, error) {
+	var session, unlock, err = this.acquire(id)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if time.Now().After(session.ExpiresAt) {
+		return nil, UploadSessionNotFoundErr
+	}
+	if session.Completed || offset != session.Offset {
+		return session, UploadOffsetMismatchErr
+	}
+
+	var (
+		written int64
+		reader  = &chunkReader{reader: r, remaining: session.Size - session.Offset}
+	)
+	if session.Append {
+		written, err = adapters.AppendStream(this.factory.Disk(session.Disk), this.partPath(id), reader)
+	} else if written, err = adapters.PutStream(this.state(), this.chunkPath(id, offset), reader); err != nil || written == 0 {
+		// 分片写入失败时丢弃，客户端从原来的位置重新上传
+		_ = this.state().Delete(this.chunkPath(id, offset))
+		written = 0
+	} else {
+		session.Chunks = append(session.Chunks, offset)
+	}
+
+	session.Offset += written
+	session.ExpiresAt = time.Now().Add(this.options.Expiry)
+	if err == nil && session.Offset == session.Size {
+		err = this.complete(session)
+	}
+	if saveErr := this.save(session); err == nil {
+		err = saveErr
+	}
+	return session, err
+}
+
+// chunksReader 依次读取所有分片
+type chunksReader struct {
+	disk    contracts.FileSystem
+	paths   []string
+	current io.ReadCloser
+}
+
+func (this *chunksReader) Read(p []byte) (int, error) {
+	for {
+		if this.current == nil {
+			if len(this.paths) == 0 {
+				return 0, io.EOF
+			}
+			var reader, err = adapters.ReadRange(this.disk, this.paths[0], 0, -1)
+			if err != nil {
+				return 0, err
+			}
+			this.current, this.paths = reader, this.paths[1:]
+		}
+		var n, err = this.current.Read(p)
+		if err == io.EOF {
+			_ = this.current.Close()
+			this.current = nil
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (this *chunksReader) Close() error {
+	if this.current != nil {
+		return this.current.Close()
+	}
+	return nil
+}
+
+// complete 将上传的内容保存到最终路径
+func (this *Resumable) complete(session *UploadSession) error {
+	var (
+		target  = this.factory.Disk(session.Disk)
+		options = file.ApplyWriteOptions(this.options.WriteOptions...)
+		err     error
+	)
+	switch {
+	case session.Size == 0:
+		_, err = adapters.PutStream(target, session.Path, strings.NewReader(""), this.options.WriteOptions...)
+	case session.Append:
+		if err = target.Move(this.partPath(session.Id), session.Path); err == nil && options.Perm != 0 {
+			err = target.SetVisibility(session.Path, options.Perm)
+		}
+	default:
+		var paths = make([]string, 0, len(session.Chunks))
+		for _, offset := range session.Chunks {
+			paths = append(paths, this.chunkPath(session.Id, offset))
+		}
+		var (
+			reader  = &chunksReader{disk: this.state(), paths: paths}
+			written int64
+		)
+		written, err = adapters.PutStream(target, session.Path, reader, this.options.WriteOptions...)
+		_ = reader.Close()
+		if err == nil && written != session.Size {
+			err = file.NewError("upload", target.Name(), session.Path, fs.ErrInvalid, fmt.Errorf("assembled %d of %d bytes", written, session.Size))
+		}
+		if err == nil {
+			this.cleanChunks(session)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	session.Completed = true
+	session.Chunks = nil
+	if this.options.OnComplete != nil {
+		this.options.OnComplete(*session)
+	}
+	return nil
+}
+
+// cleanChunks 删除分片目录
+func (this *Resumable) cleanChunks(session *UploadSession) {
+	if len(session.Chunks) == 0 {
+		return
+	}
+	if err := this.state().DeleteDirectory(pathpkg.Join(this.options.StateDirectory, session.Id)); err != nil && !errors.Is(err, file.ErrNotFound) {
+		logs.WithError(err).WithField("disk", this.options.StateDisk).WithField("upload", session.Id).Warn("filesystem.Resumable: failed to delete chunks")
+	}
+}
+
+// remove 删除会话以及没有完成的内容，已经完成的文件不会被删除
+func (this *Resumable) remove(session *UploadSession) error {
+	if session.Append && !session.Completed {
+		if err := this.factory.Disk(session.Disk).Delete(this.partPath(session.Id)); err != nil && !errors.Is(err, file.ErrNotFound) {
+			return err
+		}
+	}
+	this.cleanChunks(session)
+	this.locks.Delete(session.Id)
+	return this.state().Delete(this.statePath(session.Id))
+}
+
+// Abort 取消上传并删除已经上传的内容
+func (this *Resumable) Abort(id string) error {
+	var session, unlock, err = this.acquire(id)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return this.remove(session)
+}
+
+// Expire 删除所有过期的会话，返回删除的数量，需要由调用方定期执行
+func (this *Resumable) Expire() (int, error) {
+	var (
+		now     = time.Now()
+		expired int
+	)
+	for _, stateFile := range this.state().Files(this.options.StateDirectory) {
+		var id = strings.TrimSuffix(stateFile.Name(), ".json")
+		if !validUploadId(id) || !strings.HasSuffix(stateFile.Name(), ".json") {
+			continue
+		}
+
+		var err = func() error {
+			var session, unlock, err = this.acquire(id)
+			if err != nil {
+				return err
+			}
+			defer unlock()
+			if now.Before(session.ExpiresAt) {
+				return nil
+			}
+			if err = this.remove(session); err != nil {
+				return err
+			}
+			expired++
+			return nil
+		}()
+		if err != nil && !errors.Is(err, UploadSessionNotFoundErr) {
+			return expired, err
+		}
+	}
+	return expired, nil
+}
+
+// parseUploadMetadata 解析 tus 的 Upload-Metadata 头，格式为逗号分隔的 key base64(value)
+func parseUploadMetadata(header string) (map[string]string, error) {
+	var metadata = make(map[string]string)
+	for _, pair := range strings.Split(header, ",") {
+		var fields = strings.Fields(pair)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) > 2 {
+			return nil, fmt.Errorf("invalid upload metadata: %w", fs.ErrInvalid)
+		}
+		var value []byte
+		if len(fields) == 2 {
+			var err error
+			if value, err = base64.StdEncoding.DecodeString(fields[1]); err != nil {
+				return nil, fmt.Errorf("invalid upload metadata: %w", fs.ErrInvalid)
+			}
+		}
+		metadata[fields[0]] = string(value)
+	}
+	return metadata, nil
+}
+
+// resumableStatus 获取断点续传错误对应的 HTTP 状态码
+func resumableStatus(err error) int {
+	switch {
+	case errors.Is(err, UploadSessionNotFoundErr):
+		return http.StatusNotFound
+	case errors.Is(err, UploadOffsetMismatchErr):
+		return http.StatusConflict
+	case errors.Is(err, FileTooLargeErr):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, fs.ErrInvalid):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Handler 创建实现 tus 1.0.0 协议的 http.Handler，支持 creation、termination 以及 expiration 扩展
+// POST Prefix 创建会话，HEAD Prefix/{id} 获取位置，PATCH Prefix/{id} 写入分片，DELETE Prefix/{id} 取消上传
+func (this *Resumable) Handler() http.Handler {
+	return http.HandlerFunc(this.serve)
+}
+
+func (this *Resumable) serve(w http.ResponseWriter, r *http.Request) {
+	var header = w.Header()
+	header.Set("Tus-Resumable", TusVersion)
+
+	if r.Method == http.MethodOptions {
+		header.Set("Tus-Version", TusVersion)
+		header.Set("Tus-Extension", "creation,termination,expiration")
+		if this.options.MaxSize > 0 {
+			header.Set("Tus-Max-Size", strconv.FormatInt(this.options.MaxSize, 10))
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Header.Get("Tus-Resumable") != TusVersion {
+		header.Set("Tus-Version", TusVersion)
+		w.WriteHeader(http.StatusPreconditionFailed)
+		return
+	}
+	if r.URL.Path != this.options.Prefix && !strings.HasPrefix(r.URL.Path, this.options.Prefix+"/") {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	var (
+		id      = strings.Trim(strings.TrimPrefix(r.URL.Path, this.options.Prefix), "/")
+		session *UploadSession
+		status  int
+		err     error
+	)
+	switch {
+	case r.Method == http.MethodPost && id == "":
+		session, err = this.create(r)
+		status = http.StatusCreated
+		if err == nil {
+			header.Set("Location", this.options.Prefix+"/"+session.Id)
+		}
+	case r.Method == http.MethodHead && id != "":
+		session, err = this.Session(id)
+		status = http.StatusOK
+		header.Set("Cache-Control", "no-store")
+	case r.Method == http.MethodPatch && id != "":
+		if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		session, err = this.patch(id, r)
+		status = http.StatusNoContent
+	case r.Method == http.MethodDelete && id != "":
+		err = this.Abort(id)
+		status = http.StatusNoContent
+	default:
+		header.Set("Allow", "OPTIONS, POST, HEAD, PATCH, DELETE")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if session != nil {
+		header.Set("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+		header.Set("Upload-Length", strconv.FormatInt(session.Size, 10))
+		header.Set("Upload-Expires", session.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+	if err != nil {
+		status = resumableStatus(err)
+		if status == http.StatusInternalServerError {
+			logs.WithError(err).WithField("disk", this.options.Disk).WithField("upload", id).Error("filesystem.Resumable: request failed")
+		}
+	}
+	w.WriteHeader(status)
+}
+
+func (this *Resumable) create(r *http.Request) (*UploadSession, error) {
+	var size, err = strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upload length: %w", fs.ErrInvalid)
+	}
+	metadata, err := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		return nil, err
+	}
+	return this.Create(size, metadata["filename"], metadata)
+}
+
+func (this *Resumable) patch(id string, r *http.Request) (*UploadSession, error) {
+	var offset, err = strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upload offset: %w", fs.ErrInvalid)
+	}
+	return this.WriteChunk(id, offset, r.Body)
+}
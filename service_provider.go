@@ -18,13 +18,21 @@ func (this ServiceProvider) Start() error {
 
 func (this ServiceProvider) Register(container contracts.Application) {
 	container.Singleton("filesystem", func(config contracts.Config) contracts.FileSystemFactory {
-		return New(config.Get("filesystem").(Config))
+		var factory = New(config.Get("filesystem").(Config))
+		// 注册了缓存服务时，cached 驱动可以将元数据保存到缓存中
+		if container.HasBound("cache") {
+			if cache, ok := container.Get("cache").(contracts.CacheFactory); ok {
+				factory.(*Factory).UseCache(cache)
+			}
+		}
+		return factory
 	})
 
 	container.Singleton("system.default", func(factory contracts.FileSystemFactory) contracts.FileSystem {
 		return factory
 	})
 
+	// Deprecated: 通过 Factory.UrlGenerator 或者 Factory.TemporaryUrl 获取任意磁盘的地址
 	container.Singleton("system.qiniu", func(factory contracts.FileSystemFactory) *adapters.Qiniu {
 		var adapter, _ = factory.Disk("qiniu").(*adapters.Qiniu)
 		return adapter
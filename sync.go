@@ -0,0 +1,265 @@
+package filesystem
+
+import (
+	"fmt"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem/adapters"
+	"github.com/goal-web/filesystem/file"
+	pathpkg "path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// SyncAction 同步时对单个文件执行的操作
+type SyncAction string
+
+const (
+	SyncCopy   SyncAction = "copy"   // 目标中不存在
+	SyncUpdate SyncAction = "update" // 目标中的文件与源文件不一致
+	SyncDelete SyncAction = "delete" // 源中不存在，开启 Delete 时删除
+	SyncSkip   SyncAction = "skip"   // 文件一致
+)
+
+// SyncEvent 同步进度，每处理完一个文件触发一次
+type SyncEvent struct {
+	Action SyncAction
+	Path   string
+	Size   int64
+	Err    error
+	// Done 已处理的文件数，Total 需要处理的文件总数（不包括跳过的文件）
+	Done  int
+	Total int
+}
+
+type SyncOptions struct {
+	// Delete 删除目标中源不存在的文件
+	Delete bool
+	// DryRun 只计算需要执行的操作，不修改目标磁盘
+	DryRun bool
+	// Include 只同步匹配的文件，为空时同步所有文件；不包含 / 的模式匹配文件名，dir/** 匹配目录下的所有文件
+	Include []string
+	// Exclude 忽略匹配的文件，优先于 Include
+	Exclude []string
+	// Parallelism 同时处理的文件数，默认为 1
+	Parallelism int
+	// Progress 进度回调，可能被多个 goroutine 同时调用
+	Progress func(event SyncEvent)
+}
+
+// SyncResult 同步结果，路径相对于磁盘根目录并且已排序
+type SyncResult struct {
+	Copied  []string
+	Updated []string
+	Deleted []string
+	Skipped []string
+	Failed  map[string]error
+	// Bytes 复制的字节数，DryRun 时为需要复制的字节数
+	Bytes int64
+}
+
+type syncTask struct {
+	action SyncAction
+	path   string
+	size   int64
+}
+
+// Sync 将 src 中的文件同步到 dst，只复制新增或者变化的文件
+// 文件一致的判断依据：大小相同，并且两边都支持 Checksum 时校验值相同，否则目标的修改时间不早于源
+// 需要同步子目录时可以配合 Factory.Scoped 使用
+func Sync(src, dst contracts.FileSystem, opts SyncOptions) (*SyncResult, error) {
+	var (
+		result      = &SyncResult{Failed: map[string]error{}}
+		tasks       []syncTask
+		sources     = make(map[string]bool)
+		parallelism = opts.Parallelism
+	)
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	for _, item := range src.AllFiles("") {
+		var path = filePath(item)
+		if !opts.matches(path) {
+			continue
+		}
+		sources[path] = true
+
+		var action, err = syncCompare(src, dst, path, item.Size())
+		if err != nil {
+			result.Failed[path] = err
+			continue
+		}
+		if action == SyncSkip {
+			result.Skipped = append(result.Skipped, path)
+			continue
+		}
+		tasks = append(tasks, syncTask{action: action, path: path, size: item.Size()})
+	}
+
+	if opts.Delete {
+		for _, item := range dst.AllFiles("") {
+			if path := filePath(item); !sources[path] && opts.matches(path) {
+				tasks = append(tasks, syncTask{action: SyncDelete, path: path})
+			}
+		}
+	}
+
+	var (
+		mutex sync.Mutex
+		wg    sync.WaitGroup
+		queue = make(chan syncTask)
+		done  = 0
+	)
+	for i := 0; i < parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range queue {
+				var written, err = task.run(src, dst, opts.DryRun)
+
+				mutex.Lock()
+				done++
+				result.record(task, written, err)
+				var event = SyncEvent{Action: task.action, Path: task.path, Size: task.size, Err: err, Done: done, Total: len(tasks)}
+				mutex.Unlock()
+
+				if opts.Progress != nil {
+					opts.Progress(event)
+				}
+			}
+		}()
+	}
+	for _, task := range tasks {
+		queue <- task
+	}
+	close(queue)
+	wg.Wait()
+
+	for _, paths := range [][]string{result.Copied, result.Updated, result.Deleted, result.Skipped} {
+		sort.Strings(paths)
+	}
+	if len(result.Failed) > 0 {
+		return result, result.error()
+	}
+	return result, nil
+}
+
+// syncCompare 比较源文件与目标文件，判断需要执行的操作
+func syncCompare(src, dst contracts.FileSystem, path string, size int64) (SyncAction, error) {
+	if !dst.Exists(path) {
+		return SyncCopy, nil
+	}
+	var dstSize, err = dst.Size(path)
+	if err != nil {
+		return "", err
+	}
+	if dstSize != size {
+		return SyncUpdate, nil
+	}
+
+	// 本地磁盘计算校验值需要读取整个文件，只有两边都能比较时才计算，并且先计算目标的校验值
+	srcChecksummer, srcOk := src.(file.Checksummer)
+	dstChecksummer, dstOk := dst.(file.Checksummer)
+	if srcOk && dstOk {
+		if dstSum, dstErr := dstChecksummer.Checksum(path); dstErr == nil {
+			if srcSum, srcErr := srcChecksummer.Checksum(path); srcErr == nil {
+				if srcSum == dstSum {
+					return SyncSkip, nil
+				}
+				return SyncUpdate, nil
+			}
+		}
+	}
+
+	srcModified, err := src.LastModified(path)
+	if err != nil {
+		return "", err
+	}
+	dstModified, err := dst.LastModified(path)
+	if err != nil {
+		return "", err
+	}
+	if dstModified.Before(srcModified) {
+		return SyncUpdate, nil
+	}
+	return SyncSkip, nil
+}
+
+func (this syncTask) run(src, dst contracts.FileSystem, dryRun bool) (int64, error) {
+	if dryRun {
+		return this.size, nil
+	}
+	if this.action == SyncDelete {
+		return 0, dst.Delete(this.path)
+	}
+	return adapters.Transfer(src, this.path, dst, this.path)
+}
+
+func (this *SyncResult) record(task syncTask, written int64, err error) {
+	if err != nil {
+		this.Failed[task.path] = err
+		return
+	}
+	switch task.action {
+	case SyncCopy:
+		this.Copied = append(this.Copied, task.path)
+	case SyncUpdate:
+		this.Updated = append(this.Updated, task.path)
+	case SyncDelete:
+		this.Deleted = append(this.Deleted, task.path)
+	}
+	this.Bytes += written
+}
+
+func (this *SyncResult) error() error {
+	var paths = make([]string, 0, len(this.Failed))
+	for path := range this.Failed {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return fmt.Errorf("filesystem: sync failed for %d files, first %s: %w", len(paths), paths[0], this.Failed[paths[0]])
+}
+
+func (this SyncOptions) matches(path string) bool {
+	for _, pattern := range this.Exclude {
+		if matchGlob(pattern, path) {
+			return false
+		}
+	}
+	if len(this.Include) == 0 {
+		return true
+	}
+	for _, pattern := range this.Include {
+		if matchGlob(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob 不包含 / 的模式只匹配文件名，以 /** 结尾的模式匹配目录下的所有文件
+func matchGlob(pattern, path string) bool {
+	pattern = strings.TrimPrefix(pattern, "/")
+	if directory := strings.TrimSuffix(pattern, "/**"); directory != pattern {
+		for dir := pathpkg.Dir(path); dir != "."; dir = pathpkg.Dir(dir) {
+			if matched, _ := pathpkg.Match(directory, dir); matched {
+				return true
+			}
+		}
+		return false
+	}
+	if !strings.Contains(pattern, "/") {
+		path = pathpkg.Base(path)
+	}
+	var matched, err = pathpkg.Match(pattern, path)
+	return err == nil && matched
+}
+
+// filePath 获取文件相对于磁盘根目录的路径
+func filePath(item contracts.File) string {
+	if withPath, ok := item.(file.File); ok {
+		return withPath.Path()
+	}
+	return item.Name()
+}
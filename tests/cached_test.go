@@ -0,0 +1,225 @@
+package tests
+
+import (
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem"
+	"github.com/goal-web/filesystem/adapters"
+	"github.com/goal-web/filesystem/file"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// countingDisk 记录远程调用次数的磁盘
+type countingDisk struct {
+	contracts.FileSystem
+	reads, stats int
+}
+
+func (this *countingDisk) Read(path string) ([]byte, error) {
+	this.reads++
+	return this.FileSystem.Read(path)
+}
+
+func (this *countingDisk) Exists(path string) bool {
+	this.stats++
+	return this.FileSystem.Exists(path)
+}
+
+func (this *countingDisk) Size(path string) (int64, error) {
+	this.stats++
+	return this.FileSystem.Size(path)
+}
+
+// mapCacheStore 只实现 cached 驱动用到的方法
+type mapCacheStore struct {
+	contracts.CacheStore
+	values map[string]interface{}
+}
+
+func (this *mapCacheStore) Get(key string) interface{} {
+	return this.values[key]
+}
+
+func (this *mapCacheStore) Put(key string, value interface{}, ttl time.Duration) error {
+	this.values[key] = value
+	return nil
+}
+
+func (this *mapCacheStore) Forget(key string) error {
+	delete(this.values, key)
+	return nil
+}
+
+func TestCached(t *testing.T) {
+	var (
+		remote = &countingDisk{FileSystem: adapters.NewMemoryFileSystem("qiniu", os.ModePerm)}
+		cached = adapters.NewCached("cdn", remote, adapters.CacheConfig{MaxSize: 8})
+	)
+	assert.Nil(t, remote.FileSystem.Put("a.txt", "aaaa"))
+	assert.Nil(t, remote.FileSystem.Put("b.txt", "bbbb"))
+	assert.Nil(t, remote.FileSystem.Put("d.txt", "dddd"))
+	assert.Nil(t, remote.FileSystem.Put("big.txt", "0123456789"))
+
+	for i := 0; i < 3; i++ {
+		var contents, err = cached.Get("a.txt")
+		assert.Nil(t, err)
+		assert.Equal(t, "aaaa", contents)
+		assert.True(t, cached.Exists("a.txt"))
+		size, _ := cached.Size("a.txt")
+		assert.Equal(t, int64(4), size)
+	}
+	assert.Equal(t, 1, remote.reads)
+	assert.Equal(t, 2, remote.stats)
+
+	// 超出容量的文件不缓存
+	_, _ = cached.Get("big.txt")
+	_, _ = cached.Get("big.txt")
+	assert.Equal(t, 3, remote.reads)
+
+	// 淘汰最久未使用的文件
+	_, _ = cached.Get("b.txt")
+	_, _ = cached.Get("a.txt")
+	_, _ = cached.Get("d.txt")
+	_, _ = cached.Get("b.txt")
+	_, _ = cached.Get("d.txt")
+	assert.Equal(t, 6, remote.reads)
+
+	// 写入时清除缓存
+	assert.Nil(t, cached.Put("a.txt", "changed"))
+	var contents, _ = cached.Get("a.txt")
+	assert.Equal(t, "changed", contents)
+	var size, _ = cached.Size("a.txt")
+	assert.Equal(t, int64(7), size)
+
+	assert.False(t, cached.Exists("docs"))
+	assert.Nil(t, cached.Put("docs/readme.md", "#"))
+	assert.True(t, cached.Exists("docs"))
+	assert.Nil(t, cached.DeleteDirectory("docs"))
+	assert.False(t, cached.Exists("docs/readme.md"))
+
+	// 缓存过期
+	var short = adapters.NewCached("short", remote, adapters.CacheConfig{TTL: time.Millisecond})
+	_, _ = short.Get("b.txt")
+	time.Sleep(5 * time.Millisecond)
+	_, _ = short.Get("b.txt")
+	assert.Equal(t, 9, remote.reads)
+
+	_, err := cached.Get("missing.txt")
+	assert.ErrorIs(t, err, file.ErrNotFound)
+}
+
+func TestCachedDriver(t *testing.T) {
+	var (
+		store   = &mapCacheStore{values: map[string]interface{}{}}
+		factory = filesystem.New(filesystem.Config{
+			Default: "cdn",
+			Disks: map[string]contracts.Fields{
+				"cdn":   {"driver": "cached", "disk": "qiniu", "cache_disk": "cache", "store": "redis", "ttl": 60},
+				"qiniu": {"driver": "memory"},
+				"cache": {"driver": "memory"},
+			},
+		}).(*filesystem.Factory)
+	)
+	factory.UseCache(fakeCacheFactory{store})
+
+	assert.Nil(t, factory.Disk("qiniu").Put("a.txt", "remote"))
+	var contents, err = factory.Disk("cdn").Get("a.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "remote", contents)
+	assert.Len(t, factory.Disk("cache").AllFiles(""), 1)
+
+	assert.True(t, factory.Disk("cdn").Exists("a.txt"))
+	var keys []string
+	for key := range store.values {
+		keys = append(keys, key)
+	}
+	assert.Len(t, keys, 1)
+	assert.True(t, strings.Contains(keys[0], "exists"))
+
+	assert.Nil(t, factory.Disk("cdn").Delete("a.txt"))
+	assert.Len(t, store.values, 0)
+	assert.Len(t, factory.Disk("cache").AllFiles(""), 0)
+	assert.False(t, factory.Disk("cdn").Exists("a.txt"))
+}
+
+type fakeCacheFactory struct {
+	store contracts.CacheStore
+}
+
+func (this fakeCacheFactory) Store(name ...string) contracts.CacheStore {
+	return this.store
+}
+
+func (this fakeCacheFactory) Extend(drive string, cacheStoreProvider contracts.CacheStoreProvider) {
+}
+
+// blockingDisk 写入时等待 release 的缓存磁盘
+type blockingDisk struct {
+	contracts.FileSystem
+	writing chan struct{}
+	release chan struct{}
+}
+
+func (this *blockingDisk) Put(path, contents string) error {
+	this.writing <- struct{}{}
+	<-this.release
+	return this.FileSystem.Put(path, contents)
+}
+
+func TestCachedDiskIOWithoutLock(t *testing.T) {
+	var (
+		origin = adapters.NewMemoryFileSystem("origin", os.ModePerm)
+		store  = &blockingDisk{FileSystem: adapters.NewMemoryFileSystem("cache", os.ModePerm), writing: make(chan struct{}), release: make(chan struct{})}
+		disk   = adapters.NewCached("cached", origin, adapters.CacheConfig{Disk: store, MaxSize: 10})
+	)
+	assert.Nil(t, origin.Put("a.txt", "a"))
+	assert.Nil(t, origin.Put("b.txt", "b"))
+
+	var done = make(chan string)
+	go func() {
+		var contents, _ = disk.Get("a.txt")
+		done <- contents
+	}()
+	<-store.writing
+
+	// 缓存磁盘写入期间其他操作不会被阻塞
+	var finished = make(chan bool)
+	go func() {
+		finished <- disk.Exists("b.txt")
+		var size, _ = disk.Size("b.txt")
+		assert.Equal(t, int64(1), size)
+		close(finished)
+	}()
+	select {
+	case exists := <-finished:
+		assert.True(t, exists)
+		<-finished
+	case <-time.After(5 * time.Second):
+		t.Fatal("cached reads blocked while the cache disk was writing")
+	}
+
+	close(store.release)
+	assert.Equal(t, "a", <-done)
+	assert.Len(t, store.FileSystem.AllFiles(""), 1)
+}
+
+func TestCachedMoveDirectory(t *testing.T) {
+	var (
+		origin = &countingDisk{FileSystem: adapters.NewMemoryFileSystem("origin", os.ModePerm)}
+		disk   = adapters.NewCached("cached", origin, adapters.CacheConfig{})
+	)
+	assert.Nil(t, disk.Put("reports/2026/a.txt", "a"))
+	var contents, _ = disk.Get("reports/2026/a.txt")
+	assert.Equal(t, "a", contents)
+	assert.True(t, disk.Exists("reports/2026/a.txt"))
+
+	assert.Nil(t, disk.Move("reports", "archive"))
+	assert.False(t, disk.Exists("reports/2026/a.txt"))
+	var _, err = disk.Get("reports/2026/a.txt")
+	assert.ErrorIs(t, err, file.ErrNotFound)
+	contents, _ = disk.Get("archive/2026/a.txt")
+	assert.Equal(t, "a", contents)
+}
@@ -0,0 +1,143 @@
+package tests
+
+import (
+	"compress/gzip"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem"
+	"github.com/goal-web/filesystem/adapters"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCompressed(t *testing.T) {
+	var logs = adapters.NewMemoryFileSystem("logs", os.ModePerm)
+	var disk, err = adapters.NewCompressed("archive", logs, adapters.CompressionConfig{})
+	assert.Nil(t, err)
+
+	var line = "2026-10-18 10:00:00 INFO request handled in 3ms\n"
+	var contents = strings.Repeat(line, 5000)
+	assert.Nil(t, disk.Put("2026/10/18.log", contents))
+
+	var read, _ = disk.Get("2026/10/18.log")
+	assert.Equal(t, contents, read)
+	var size, _ = disk.Size("2026/10/18.log")
+	assert.Equal(t, int64(len(contents)), size)
+	stored, _ := disk.StoredSize("2026/10/18.log")
+	assert.Less(t, stored, size/10)
+	assert.Equal(t, int64(len(contents)), disk.AllFiles("2026")[0].Size())
+
+	reader, err := disk.ReadRange("2026/10/18.log", int64(len(line))*100, int64(len(line)))
+	assert.Nil(t, err)
+	part, _ := ioutil.ReadAll(reader)
+	_ = reader.Close()
+	assert.Equal(t, line, string(part))
+
+	handle, _ := disk.Open("2026/10/18.log")
+	_, err = handle.Seek(0, 3)
+	assert.ErrorIs(t, err, adapters.InvalidSeekErr)
+	_, _ = handle.Seek(-int64(len(line)), io.SeekEnd)
+	part, _ = ioutil.ReadAll(handle)
+	_ = handle.Close()
+	assert.Equal(t, line, string(part))
+
+	// 已经压缩过的格式直接保存
+	assert.Nil(t, disk.Put("2026/10/17.log.gz", "already compressed"))
+	raw, _ := logs.Get("2026/10/17.log.gz")
+	assert.Equal(t, "already compressed", raw)
+	read, _ = disk.Get("2026/10/17.log.gz")
+	assert.Equal(t, "already compressed", read)
+
+	// 磁盘中已有的未压缩文件
+	assert.Nil(t, logs.Put("legacy.log", "plain"))
+	read, _ = disk.Get("legacy.log")
+	assert.Equal(t, "plain", read)
+	size, _ = disk.Size("legacy.log")
+	assert.Equal(t, int64(5), size)
+
+	// 未压缩的文件恰好以 magic 结尾时不能把最后 12 个字节当作原始大小
+	var tail = strings.Repeat("x", 20) + "\x00\x00\x00\x00\x00\x00\x00\x07GFZ\x01"
+	assert.Nil(t, logs.Put("tail.zip", tail))
+	size, err = disk.Size("tail.zip")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(tail)), size)
+
+	assert.Nil(t, disk.Append("legacy.log", " text"))
+	read, _ = disk.Get("legacy.log")
+	assert.Equal(t, "plain text", read)
+
+	// 损坏的文件
+	compressed, _ := logs.Read("2026/10/18.log")
+	assert.Nil(t, logs.Put("broken.log", string(compressed[:len(compressed)/2])))
+	_, err = disk.Read("broken.log")
+	assert.ErrorIs(t, err, adapters.CompressionCorruptErr)
+
+	assert.Nil(t, disk.Put("empty.log", ""))
+	read, err = disk.Get("empty.log")
+	assert.Nil(t, err)
+	assert.Equal(t, "", read)
+}
+
+func TestCompressedAlgorithms(t *testing.T) {
+	var logs = adapters.NewMemoryFileSystem("logs", os.ModePerm)
+	adapters.RegisterCompressor("gzip-fast", adapters.Compressor{
+		NewWriter: func(w io.Writer, level int) (io.WriteCloser, error) {
+			return gzip.NewWriterLevel(w, gzip.BestSpeed)
+		},
+		NewReader: func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		},
+	})
+
+	var flate, _ = adapters.NewCompressed("archive", logs, adapters.CompressionConfig{Algorithm: "flate"})
+	assert.Nil(t, flate.Put("a.log", "flate"))
+	var fast, _ = adapters.NewCompressed("archive", logs, adapters.CompressionConfig{Algorithm: "gzip-fast"})
+	assert.Nil(t, fast.Put("b.log", "fast"))
+
+	// 读取时根据文件头选择算法
+	var contents, _ = fast.Get("a.log")
+	assert.Equal(t, "flate", contents)
+	contents, _ = flate.Get("b.log")
+	assert.Equal(t, "fast", contents)
+
+	// 内置 zstd
+	var zstd, _ = adapters.NewCompressed("archive", logs, adapters.CompressionConfig{Algorithm: "zstd", Level: 3})
+	var text = strings.Repeat("zstd compressed line\n", 1000)
+	assert.Nil(t, zstd.Put("c.log", text))
+	contents, _ = flate.Get("c.log")
+	assert.Equal(t, text, contents)
+	var size, _ = zstd.Size("c.log")
+	assert.Equal(t, int64(len(text)), size)
+	stored, _ := logs.Size("c.log")
+	assert.Less(t, stored, size/10)
+	raw, _ := logs.Read("c.log")
+	assert.Equal(t, "GFZ\x01\x04zstd", string(raw[:9]))
+
+	var _, err = adapters.NewCompressed("archive", logs, adapters.CompressionConfig{Algorithm: "lzma"})
+	assert.ErrorIs(t, err, adapters.UnknownCompressorErr)
+}
+
+func TestCompressedDriver(t *testing.T) {
+	var factory = filesystem.New(filesystem.Config{
+		Default: "archive",
+		Disks: map[string]contracts.Fields{
+			"archive": {"driver": "compressed", "disk": "logs", "algorithm": "gzip", "level": 9, "skip": []interface{}{"bin"}},
+			"logs":    {"driver": "memory"},
+			"invalid": {"driver": "compressed", "disk": "logs", "skip": "bin"},
+		},
+	})
+
+	assert.Nil(t, factory.Put("a.log", strings.Repeat("a", 1000)))
+	assert.Nil(t, factory.Put("a.bin", strings.Repeat("a", 1000)))
+	var stored, _ = factory.Disk("logs").Size("a.log")
+	assert.Less(t, stored, int64(100))
+	stored, _ = factory.Disk("logs").Size("a.bin")
+	assert.Equal(t, int64(1000), stored)
+
+	assert.PanicsWithError(t, "invalid disk config: skip must be a list, got string", func() {
+		factory.Disk("invalid")
+	})
+}
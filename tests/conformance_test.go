@@ -0,0 +1,68 @@
+package tests
+
+import (
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem"
+	"github.com/goal-web/filesystem/filesystemtest"
+	"os"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	var drivers = map[string]func(t *testing.T) contracts.Fields{
+		"local": func(t *testing.T) contracts.Fields {
+			return contracts.Fields{"driver": "local", "root": t.TempDir(), "perm": os.FileMode(0755)}
+		},
+		"memory": func(t *testing.T) contracts.Fields {
+			return contracts.Fields{"driver": "memory"}
+		},
+		"s3": func(t *testing.T) contracts.Fields {
+			var server = newFakeS3("goal")
+			t.Cleanup(server.Close)
+			return contracts.Fields{
+				"driver":     "s3",
+				"endpoint":   server.URL,
+				"bucket":     "goal",
+				"path_style": true,
+			}
+		},
+		"mount": func(t *testing.T) contracts.Fields {
+			return contracts.Fields{"driver": "mount", "mounts": map[string]string{"": "inner"}}
+		},
+		"mirror": func(t *testing.T) contracts.Fields {
+			return contracts.Fields{"driver": "mirror", "disks": []string{"inner", "replica"}}
+		},
+		"failover": func(t *testing.T) contracts.Fields {
+			return contracts.Fields{"driver": "failover", "disks": []string{"inner", "replica"}}
+		},
+		"cached": func(t *testing.T) contracts.Fields {
+			return contracts.Fields{"driver": "cached", "disk": "inner"}
+		},
+		"encrypted": func(t *testing.T) contracts.Fields {
+			return contracts.Fields{"driver": "encrypted", "disk": "inner", "keys": map[string]string{"k1": "MDEyMzQ1Njc4OWFiY2RlZg=="}, "key": "k1"}
+		},
+		"compressed": func(t *testing.T) contracts.Fields {
+			return contracts.Fields{"driver": "compressed", "disk": "inner"}
+		},
+		"scoped": func(t *testing.T) contracts.Fields {
+			return contracts.Fields{"driver": "scoped", "disk": "inner", "prefix": "tenant-42/"}
+		},
+	}
+
+	for driver, config := range drivers {
+		var config = config
+		t.Run(driver, func(t *testing.T) {
+			filesystemtest.RunConformance(t, func() contracts.FileSystem {
+				return filesystem.New(filesystem.Config{
+					Default: "disk",
+					Disks: map[string]contracts.Fields{
+						"disk": config(t),
+						// 包装驱动引用的磁盘
+						"inner":   {"driver": "memory"},
+						"replica": {"driver": "memory"},
+					},
+				}).Disk("disk")
+			})
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/base64"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem"
+	"github.com/goal-web/filesystem/adapters"
+	"github.com/goal-web/filesystem/file"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+var (
+	oldKey = bytes.Repeat([]byte{1}, 32)
+	newKey = bytes.Repeat([]byte{2}, 16)
+)
+
+func TestEncrypted(t *testing.T) {
+	var qiniu = adapters.NewMemoryFileSystem("qiniu", os.ModePerm)
+	var disk, err = adapters.NewEncrypted("pii", qiniu, adapters.EncryptionConfig{
+		Keys:  map[string][]byte{"old": oldKey},
+		KeyId: "old",
+	})
+	assert.Nil(t, err)
+
+	assert.Nil(t, disk.Put("users/1.json", `{"id_card":"110101"}`))
+	var raw, _ = qiniu.Get("users/1.json")
+	assert.NotContains(t, raw, "110101")
+	var contents, _ = disk.Get("users/1.json")
+	assert.Equal(t, `{"id_card":"110101"}`, contents)
+	size, _ := disk.Size("users/1.json")
+	assert.Equal(t, int64(20), size)
+	assert.Equal(t, int64(20), disk.AllFiles("users")[0].Size())
+
+	// 跨越多个块的文件以及部分读取
+	var large = make([]byte, 200<<10+17)
+	for i := range large {
+		large[i] = byte(i % 251)
+	}
+	written, err := disk.PutStream("scans/large.bin", bytes.NewReader(large))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(len(large)), written)
+	read, _ := disk.Read("scans/large.bin")
+	assert.Equal(t, large, read)
+	size, _ = disk.Size("scans/large.bin")
+	assert.Equal(t, int64(len(large)), size)
+
+	reader, err := disk.ReadRange("scans/large.bin", 65530, 70000)
+	assert.Nil(t, err)
+	part, _ := ioutil.ReadAll(reader)
+	_ = reader.Close()
+	assert.Equal(t, large[65530:65530+70000], part)
+
+	handle, _ := disk.Open("scans/large.bin")
+	_, _ = handle.Seek(-10, io.SeekEnd)
+	part, _ = ioutil.ReadAll(handle)
+	_ = handle.Close()
+	assert.Equal(t, large[len(large)-10:], part)
+
+	_, err = disk.ReadRange("scans/large.bin", int64(len(large))+1, 1)
+	assert.ErrorIs(t, err, file.ErrInvalidRange)
+
+	_, err = handle.Seek(0, 3)
+	assert.ErrorIs(t, err, adapters.InvalidSeekErr)
+
+	// 篡改、截断以及移动到其他路径
+	ciphertext, _ := qiniu.Read("scans/large.bin")
+	ciphertext[200] ^= 1
+	assert.Nil(t, qiniu.Put("scans/large.bin", string(ciphertext)))
+	_, err = disk.Read("scans/large.bin")
+	assert.ErrorIs(t, err, adapters.EncryptionCorruptErr)
+
+	ciphertext[200] ^= 1
+	assert.Nil(t, qiniu.Put("scans/large.bin", string(ciphertext[:len(ciphertext)-17-16])))
+	_, err = disk.Read("scans/large.bin")
+	assert.ErrorIs(t, err, adapters.EncryptionCorruptErr)
+
+	assert.Nil(t, qiniu.Put("scans/large.bin", string(ciphertext)))
+	assert.Nil(t, qiniu.Copy("scans/large.bin", "scans/moved.bin"))
+	_, err = disk.Read("scans/moved.bin")
+	assert.ErrorIs(t, err, adapters.EncryptionCorruptErr)
+	read, _ = disk.Read("/scans/large.bin")
+	assert.Equal(t, large, read)
+
+	// 通过加密磁盘复制以及移动时重新加密
+	assert.Nil(t, disk.Copy("scans/large.bin", "scans/copy.bin"))
+	read, _ = disk.Read("scans/copy.bin")
+	assert.Equal(t, large, read)
+	assert.Nil(t, disk.Move("scans/copy.bin", "archive/large.bin"))
+	read, _ = disk.Read("archive/large.bin")
+	assert.Equal(t, large, read)
+	assert.False(t, disk.Exists("scans/copy.bin"))
+
+	// 相同的内容每次使用不同的随机盐以及 nonce 前缀
+	assert.Nil(t, disk.Put("a.txt", "same"))
+	assert.Nil(t, disk.Put("b.txt", "same"))
+	first, _ := qiniu.Read("a.txt")
+	second, _ := qiniu.Read("b.txt")
+	assert.NotEqual(t, first[37:76], second[37:76])
+
+	assert.Nil(t, disk.Append("users/1.json", "\n"))
+	contents, _ = disk.Get("users/1.json")
+	assert.Equal(t, "{\"id_card\":\"110101\"}\n", contents)
+
+	// 空文件
+	assert.Nil(t, disk.Put("empty.txt", ""))
+	contents, err = disk.Get("empty.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "", contents)
+}
+
+func TestEncryptedRekey(t *testing.T) {
+	var qiniu = adapters.NewMemoryFileSystem("qiniu", os.ModePerm)
+	var before, _ = adapters.NewEncrypted("pii", qiniu, adapters.EncryptionConfig{
+		Keys:  map[string][]byte{"old": oldKey},
+		KeyId: "old",
+	})
+	assert.Nil(t, before.Put("users/1.json", "one"))
+	assert.Nil(t, qiniu.Put("users/legacy.json", "plaintext"))
+
+	var after, _ = adapters.NewEncrypted("pii", qiniu, adapters.EncryptionConfig{
+		Keys:  map[string][]byte{"old": oldKey, "new": newKey},
+		KeyId: "new",
+	})
+	var count, err = after.Rekey("users")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, count)
+	count, _ = after.Rekey("users")
+	assert.Equal(t, 0, count)
+	assert.Len(t, qiniu.AllFiles("users"), 2)
+
+	var contents, _ = after.Get("users/1.json")
+	assert.Equal(t, "one", contents)
+	contents, _ = after.Get("users/legacy.json")
+	assert.Equal(t, "plaintext", contents)
+
+	// 旧密钥已经无法读取
+	_, err = before.Get("users/1.json")
+	assert.ErrorIs(t, err, adapters.EncryptionKeyErr)
+}
+
+func TestEncryptedDriver(t *testing.T) {
+	var factory = filesystem.New(filesystem.Config{
+		Default: "pii",
+		Disks: map[string]contracts.Fields{
+			"pii": {
+				"driver": "encrypted",
+				"disk":   "qiniu",
+				"keys":   contracts.Fields{"2024": base64.StdEncoding.EncodeToString(oldKey)},
+				"key":    "2024",
+			},
+			"qiniu":   {"driver": "memory"},
+			"invalid": {"driver": "encrypted", "disk": "qiniu", "keys": map[string]string{"k": "c2hvcnQ="}, "key": "k"},
+			"loaded": {
+				"driver": "encrypted",
+				"disk":   "qiniu",
+				"keys":   map[string]interface{}{"2024": base64.StdEncoding.EncodeToString(oldKey)},
+				"key":    "2024",
+			},
+			"typo": {"driver": "encrypted", "disk": "qiniu", "keys": base64.StdEncoding.EncodeToString(oldKey), "key": "2024"},
+		},
+	})
+
+	assert.Nil(t, factory.Put("a.txt", "secret"))
+	var contents, _ = factory.Get("a.txt")
+	assert.Equal(t, "secret", contents)
+	raw, _ := factory.Disk("qiniu").Get("a.txt")
+	assert.NotContains(t, raw, "secret")
+
+	assert.Panics(t, func() {
+		factory.Disk("invalid")
+	})
+
+	// 配置文件解析出的 map[string]interface{} 与 contracts.Fields 效果相同
+	contents, _ = factory.Disk("loaded").Get("a.txt")
+	assert.Equal(t, "secret", contents)
+	assert.PanicsWithError(t, "invalid disk config: keys must be a map, got string", func() {
+		factory.Disk("typo")
+	})
+}
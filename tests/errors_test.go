@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"errors"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem"
+	"github.com/goal-web/filesystem/adapters"
+	"github.com/stretchr/testify/assert"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestErrors(t *testing.T) {
+	var local = adapters.NewLocalFileSystem("local", t.TempDir(), os.ModePerm)
+
+	var _, err = local.Get("missing.txt")
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+	assert.True(t, errors.Is(err, filesystem.ErrNotFound))
+	assert.False(t, errors.Is(err, filesystem.ErrPermission))
+
+	var wrapped *filesystem.Error
+	assert.True(t, errors.As(err, &wrapped))
+	assert.Equal(t, "local", wrapped.Disk)
+	assert.Equal(t, "missing.txt", wrapped.Path)
+	assert.Equal(t, "read", wrapped.Op)
+
+	// 原始错误依然可以获取
+	var pathErr *fs.PathError
+	assert.True(t, errors.As(err, &pathErr))
+
+	assert.Nil(t, local.Put("file.txt", "goal"))
+	err = local.Put("file.txt/nested.txt", "goal")
+	assert.True(t, errors.Is(err, filesystem.ErrNotDirectory))
+
+	var memory = adapters.NewMemoryFileSystem("memory", os.ModePerm)
+	_, err = memory.Size("missing.txt")
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+	assert.True(t, errors.As(err, &wrapped))
+	assert.Equal(t, "memory", wrapped.Disk)
+
+	_, err = memory.ReadRange("missing.txt", 0, 1)
+	assert.True(t, errors.Is(err, filesystem.ErrNotFound))
+	assert.Nil(t, memory.Put("file.txt", "goal"))
+	_, err = memory.ReadRange("file.txt", 5, 1)
+	assert.True(t, errors.Is(err, filesystem.ErrInvalidRange))
+}
+
+func TestS3Errors(t *testing.T) {
+	var server = newFakeS3("goal")
+	defer server.Close()
+
+	var disk = adapters.NewS3FileSystem("s3", adapters.S3Config{
+		Endpoint:  server.URL,
+		Bucket:    "goal",
+		PathStyle: true,
+		AccessKey: "minio",
+		SecretKey: "minio123",
+	})
+
+	var _, err = disk.Get("missing.txt")
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+
+	var wrapped *filesystem.Error
+	assert.True(t, errors.As(err, &wrapped))
+	assert.Equal(t, "s3", wrapped.Disk)
+
+	var s3Err *adapters.S3Error
+	assert.True(t, errors.As(err, &s3Err))
+	assert.Equal(t, http.StatusNotFound, s3Err.StatusCode)
+
+	assert.True(t, errors.Is(&adapters.S3Error{StatusCode: http.StatusForbidden, Code: "AccessDenied"}, fs.ErrPermission))
+}
+
+func TestQiniuChecksStatusCode(t *testing.T) {
+	var server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/forbidden.txt" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	var disk = adapters.QiniuAdapter("qiniu", contracts.Fields{
+		"domain":     server.URL,
+		"bucket":     "goal",
+		"access_key": "access",
+		"secret_key": "secret",
+	})
+
+	// 404 页面不能被当作文件内容
+	var contents, err = disk.Get("missing.txt")
+	assert.Equal(t, "", contents)
+	assert.True(t, errors.Is(err, fs.ErrNotExist))
+
+	_, err = disk.Read("forbidden.txt")
+	assert.True(t, errors.Is(err, filesystem.ErrPermission))
+
+	err = disk.SetVisibility("missing.txt", 0644)
+	assert.True(t, errors.Is(err, filesystem.ErrUnsupported))
+}
@@ -0,0 +1,161 @@
+package tests
+
+import (
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem"
+	"github.com/goal-web/filesystem/adapters"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFactoryConcurrency(t *testing.T) {
+	var (
+		built   int32
+		factory = filesystem.New(filesystem.Config{
+			Default: "counted",
+			Disks: map[string]contracts.Fields{
+				"counted": {"driver": "counted"},
+			},
+		}).(*filesystem.Factory)
+	)
+	factory.Extend("counted", func(name string, config contracts.Fields) contracts.FileSystem {
+		atomic.AddInt32(&built, 1)
+		time.Sleep(10 * time.Millisecond)
+		return adapters.NewMemoryFileSystem(name, os.ModePerm)
+	})
+
+	var (
+		wg    sync.WaitGroup
+		disks = make([]contracts.FileSystem, 50)
+	)
+	for i := range disks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// 同时注册驱动不能影响正在创建的磁盘
+			factory.Extend("other", adapters.MemoryAdapter)
+			disks[i] = factory.Disk("counted")
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&built))
+	for _, disk := range disks {
+		assert.Same(t, disks[0], disk)
+	}
+}
+
+func TestFactoryPurgeAndReload(t *testing.T) {
+	var factory = filesystem.New(filesystem.Config{
+		Default: "memory",
+		Disks: map[string]contracts.Fields{
+			"memory": {"driver": "memory"},
+		},
+	}).(*filesystem.Factory)
+
+	var disk = factory.Disk("memory")
+	assert.Nil(t, disk.Put("a.txt", "goal"))
+	assert.Same(t, disk, factory.Disk("memory"))
+
+	factory.Purge("memory")
+	var purged = factory.Disk("memory")
+	assert.NotSame(t, disk, purged)
+	assert.False(t, purged.Exists("a.txt"))
+
+	var root = t.TempDir()
+	var reloaded = factory.Reload("memory", contracts.Fields{"driver": "local", "root": root, "perm": os.ModePerm})
+	assert.Nil(t, reloaded.Put("b.txt", "goal"))
+	assert.FileExists(t, root+"/b.txt")
+	assert.Same(t, reloaded, factory.Disk("memory"))
+
+	// 创建失败的磁盘不会被缓存
+	assert.Panics(t, func() {
+		factory.Reload("memory", contracts.Fields{"driver": "missing"})
+	})
+	factory.Extend("missing", adapters.MemoryAdapter)
+	assert.NotNil(t, factory.Disk("memory"))
+}
+
+// closableDisk 记录 Close 调用次数的磁盘
+type closableDisk struct {
+	contracts.FileSystem
+	closed int32
+}
+
+func (this *closableDisk) Close() error {
+	atomic.AddInt32(&this.closed, 1)
+	return nil
+}
+
+func TestFactoryClosesForgottenDisks(t *testing.T) {
+	var factory = filesystem.New(filesystem.Config{
+		Default: "closable",
+		Disks: map[string]contracts.Fields{
+			"closable": {"driver": "closable"},
+		},
+	}).(*filesystem.Factory)
+	factory.Extend("closable", func(name string, config contracts.Fields) contracts.FileSystem {
+		return &closableDisk{FileSystem: adapters.NewMemoryFileSystem(name, os.ModePerm)}
+	})
+
+	var disk = factory.Disk("closable").(*closableDisk)
+	factory.Purge("closable")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&disk.closed))
+
+	disk = factory.Disk("closable").(*closableDisk)
+	var reloaded = factory.Reload("closable").(*closableDisk)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&disk.closed))
+	assert.Equal(t, int32(0), atomic.LoadInt32(&reloaded.closed))
+
+	factory.Fake("closable")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&reloaded.closed))
+
+	// 没有创建过的磁盘不需要关闭
+	factory.Purge("missing")
+}
+
+func TestFactoryInvalidDisks(t *testing.T) {
+	var factory = filesystem.New(filesystem.Config{
+		Default: "a",
+		Disks: map[string]contracts.Fields{
+			"a":     {"driver": "scoped", "disk": "b"},
+			"b":     {"driver": "readonly", "disk": "c"},
+			"c":     {"driver": "mirror", "disks": []interface{}{"store", "a"}},
+			"store": {"driver": "memory"},
+			"nil":   {"driver": "nil"},
+		},
+	}).(*filesystem.Factory)
+	factory.Extend("nil", func(name string, config contracts.Fields) contracts.FileSystem {
+		return nil
+	})
+
+	var done = make(chan struct{})
+	go func() {
+		defer close(done)
+
+		// 驱动没有返回磁盘时不能无限重试
+		assert.PanicsWithError(t, "invalid disk reference", func() {
+			factory.Disk("nil")
+		})
+		// 循环引用不能导致死锁
+		assert.PanicsWithError(t, "invalid disk reference: disk c -> a -> b -> c", func() {
+			factory.Disk("a")
+		})
+		assert.PanicsWithError(t, "invalid disk reference: disk a -> b -> c -> a", func() {
+			factory.Disk("b")
+		})
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("factory deadlocked on a disk cycle")
+	}
+
+	// 修复配置后可以正常创建
+	assert.NotNil(t, factory.Reload("c", contracts.Fields{"driver": "memory"}))
+	assert.NotNil(t, factory.Disk("a"))
+}
@@ -10,14 +10,20 @@ import (
 )
 
 func TestFactory(t *testing.T) {
+	var root = t.TempDir()
+	assert.Nil(t, os.Mkdir(root+"/test", os.ModePerm))
+
 	var factory = filesystem.New(filesystem.Config{
 		Default: "qiniu",
 		Disks: map[string]contracts.Fields{
 			"local": {
 				"driver": "local",
-				"root":   "/Users/qbhy/project/go/goal-web/filesystem/tests",
+				"root":   root,
 				"perm":   os.ModePerm,
 			},
+			"memory": {
+				"driver": "memory",
+			},
 			"qiniu": {
 				"driver":     "qiniu",
 				"ttl":        3600, // 私有 url 有效期，单位秒
@@ -33,6 +39,7 @@ func TestFactory(t *testing.T) {
 	disks := []string{
 		//"qiniu",
 		"local",
+		"memory",
 	}
 
 	for _, name := range disks {
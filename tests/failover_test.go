@@ -0,0 +1,162 @@
+package tests
+
+import (
+	"errors"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem"
+	"github.com/goal-web/filesystem/adapters"
+	"github.com/goal-web/filesystem/file"
+	"github.com/qiniu/go-sdk/v7/storage"
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+)
+
+// unreachableDisk 可以模拟网络故障的磁盘
+type unreachableDisk struct {
+	contracts.FileSystem
+	down bool
+}
+
+func (this *unreachableDisk) err(path string) error {
+	return &url.Error{Op: "Get", URL: "http://cdn.example.com/" + path, Err: errors.New("connection refused")}
+}
+
+func (this *unreachableDisk) Get(path string) (string, error) {
+	if this.down {
+		return "", this.err(path)
+	}
+	return this.FileSystem.Get(path)
+}
+
+func (this *unreachableDisk) Put(path, contents string) error {
+	if this.down {
+		return this.err(path)
+	}
+	return this.FileSystem.Put(path, contents)
+}
+
+func (this *unreachableDisk) Size(path string) (int64, error) {
+	if this.down {
+		return 0, this.err(path)
+	}
+	return this.FileSystem.Size(path)
+}
+
+func TestFailover(t *testing.T) {
+	var (
+		primary  = &unreachableDisk{FileSystem: adapters.NewMemoryFileSystem("primary", os.ModePerm)}
+		backup   = adapters.NewMemoryFileSystem("backup", os.ModePerm)
+		failover = adapters.NewFailover("failover", []contracts.FileSystem{primary, backup}, time.Hour)
+		events   []adapters.FailoverEvent
+	)
+	defer failover.Close()
+	failover.OnFailover(func(event adapters.FailoverEvent) {
+		events = append(events, event)
+	})
+
+	assert.Nil(t, failover.Put("a.txt", "primary"))
+	assert.Nil(t, backup.Put("a.txt", "backup"))
+
+	// 文件不存在不会触发切换
+	var _, err = failover.Get("missing.txt")
+	assert.ErrorIs(t, err, file.ErrNotFound)
+	assert.Equal(t, "primary", failover.Active().Name())
+
+	primary.down = true
+	contents, err := failover.Get("a.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "backup", contents)
+	assert.Equal(t, "backup", failover.Active().Name())
+	assert.Len(t, events, 1)
+	assert.Equal(t, "primary", events[0].From)
+	assert.Equal(t, "backup", events[0].To)
+	assert.False(t, events[0].Recovered)
+	assert.True(t, adapters.IsTransportError(events[0].Err))
+
+	// 主磁盘仍然不可用
+	assert.False(t, failover.Check())
+	assert.Equal(t, "backup", failover.Active().Name())
+
+	primary.down = false
+	assert.True(t, failover.Check())
+	assert.Equal(t, "primary", failover.Active().Name())
+	assert.Len(t, events, 2)
+	assert.True(t, events[1].Recovered)
+
+	// 所有磁盘都不可用时返回最后一个错误
+	var all = adapters.NewFailover("all", []contracts.FileSystem{&unreachableDisk{FileSystem: backup, down: true}}, 0)
+	_, err = all.Get("a.txt")
+	assert.True(t, adapters.IsTransportError(err))
+}
+
+func TestFailoverDriver(t *testing.T) {
+	var factory = filesystem.New(filesystem.Config{
+		Default: "cdn",
+		Disks: map[string]contracts.Fields{
+			"cdn":     {"driver": "failover", "disks": []interface{}{"primary", "backup"}, "interval": 1, "probe": "health"},
+			"primary": {"driver": "memory"},
+			"backup":  {"driver": "memory"},
+		},
+	})
+
+	var disk, ok = factory.Disk("cdn").(*adapters.Failover)
+	assert.True(t, ok)
+	assert.Equal(t, "primary", disk.Active().Name())
+	assert.True(t, disk.Check())
+	assert.Nil(t, disk.Close())
+
+	assert.Panics(t, func() {
+		filesystem.New(filesystem.Config{
+			Default: "cdn",
+			Disks:   map[string]contracts.Fields{"cdn": {"driver": "failover"}},
+		}).Disk("cdn")
+	})
+}
+
+// qiniuDisk 像七牛一样使用 612 表示文件不存在的磁盘
+type qiniuDisk struct {
+	unreachableDisk
+}
+
+func (this *qiniuDisk) Get(path string) (string, error) {
+	if !this.down && !this.FileSystem.Exists(path) {
+		return "", &storage.ErrorInfo{Code: 612, Err: "no such file or directory"}
+	}
+	return this.unreachableDisk.Get(path)
+}
+
+func (this *qiniuDisk) Size(path string) (int64, error) {
+	if !this.down && !this.FileSystem.Exists(path) {
+		return 0, &storage.ErrorInfo{Code: 612, Err: "no such file or directory"}
+	}
+	return this.unreachableDisk.Size(path)
+}
+
+func TestFailoverQiniuNotFound(t *testing.T) {
+	var (
+		primary  = &qiniuDisk{unreachableDisk{FileSystem: adapters.NewMemoryFileSystem("qiniu", os.ModePerm)}}
+		backup   = adapters.NewMemoryFileSystem("backup", os.ModePerm)
+		failover = adapters.NewFailover("failover", []contracts.FileSystem{primary, backup}, time.Hour)
+	)
+	defer failover.Close()
+
+	assert.False(t, adapters.IsTransportError(&storage.ErrorInfo{Code: 612}))
+	assert.True(t, adapters.IsTransportError(&storage.ErrorInfo{Code: 503}))
+
+	// 文件不存在不会触发切换
+	var _, err = failover.Get("missing.txt")
+	assert.NotNil(t, err)
+	assert.Equal(t, "qiniu", failover.Active().Name())
+
+	primary.down = true
+	_, _ = failover.Get("missing.txt")
+	assert.Equal(t, "backup", failover.Active().Name())
+
+	// 健康检查的文件不存在时返回 612，主磁盘恢复后仍然可以切换回去
+	primary.down = false
+	assert.True(t, failover.Check())
+	assert.Equal(t, "qiniu", failover.Active().Name())
+}
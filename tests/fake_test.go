@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"fmt"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem"
+	"github.com/goal-web/filesystem/adapters"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+type recorder struct {
+	errors []string
+}
+
+func (this *recorder) Errorf(format string, args ...interface{}) {
+	this.errors = append(this.errors, fmt.Sprintf(format, args...))
+}
+
+func uploadAvatar(factory contracts.FileSystemFactory, user, contents string) error {
+	return factory.Disk("qiniu").Put("avatars/"+user+".png", contents)
+}
+
+func TestFake(t *testing.T) {
+	var factory = filesystem.New(filesystem.Config{
+		Default: "qiniu",
+		Disks: map[string]contracts.Fields{
+			"qiniu": {
+				"driver":     "qiniu",
+				"bucket":     "your bucket",
+				"access_key": "your access key",
+				"secret_key": "your secret key",
+			},
+		},
+	})
+
+	var fake = factory.(*filesystem.Factory).Fake("qiniu")
+	assert.Same(t, fake, factory.Disk("qiniu"))
+
+	assert.Nil(t, uploadAvatar(factory, "goal", "png"))
+	assert.Nil(t, factory.Copy("avatars/goal.png", "avatars/backup.png"))
+
+	fake.AssertExists(t, "avatars/goal.png", "avatars/backup.png")
+	fake.AssertMissing(t, "avatars/other.png")
+	fake.AssertContent(t, "avatars/goal.png", "png")
+	fake.AssertWritten(t, 2)
+	fake.AssertNothingDeleted(t)
+
+	var failures = &recorder{}
+	assert.False(t, fake.AssertExists(failures, "avatars/other.png"))
+	assert.False(t, fake.AssertContent(failures, "avatars/goal.png", "jpg"))
+	assert.False(t, fake.AssertWritten(failures, 1))
+
+	assert.Nil(t, factory.Delete("avatars/backup.png"))
+	assert.False(t, fake.AssertNothingDeleted(failures))
+	assert.Len(t, failures.errors, 4)
+
+	assert.Equal(t, "Delete", fake.Operations()[len(fake.Operations())-1].Method)
+}
+
+func TestFakeRecordsStreamingAppends(t *testing.T) {
+	var factory = filesystem.New(filesystem.Config{
+		Default: "uploads",
+		Disks: map[string]contracts.Fields{
+			"uploads": {"driver": "memory"},
+		},
+	}).(*filesystem.Factory)
+	var fake = factory.Fake("uploads")
+
+	// 断点续传通过 AppendStream 写入假磁盘
+	var resumable = factory.Resumable(filesystem.ResumableOptions{})
+	var session, err = resumable.Create(4, "a.txt", nil)
+	assert.Nil(t, err)
+	_, err = resumable.WriteChunk(session.Id, 0, strings.NewReader("goal"))
+	assert.Nil(t, err)
+
+	var methods = map[string]int{}
+	for _, operation := range fake.Operations() {
+		methods[operation.Method]++
+	}
+	assert.Equal(t, 1, methods["AppendStream"])
+	fake.AssertContent(t, session.Path, "goal")
+
+	var sum, _ = adapters.Checksum(fake, session.Path)
+	assert.Equal(t, "a38985738a48f96903f23de0e5e8111d", sum)
+	assert.Equal(t, "Checksum", fake.Operations()[len(fake.Operations())-1].Method)
+}
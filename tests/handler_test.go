@@ -0,0 +1,118 @@
+package tests
+
+import (
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem"
+	"github.com/goal-web/filesystem/adapters"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestHandler(t *testing.T) {
+	var disk = adapters.NewMemoryFileSystem("memory", os.ModePerm)
+	assert.Nil(t, disk.Put("docs/report.json", `{"ok":true}`))
+	assert.Nil(t, disk.Put("private/secret.txt", "secret"))
+	assert.Nil(t, disk.SetVisibility("private/secret.txt", 0600))
+
+	var handler = filesystem.Handler(disk, filesystem.HandlerOptions{Prefix: "/files/", CacheControl: "public, max-age=60"})
+
+	var response = serve(handler, http.MethodGet, "/files/docs/report.json")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, `{"ok":true}`, response.Body.String())
+	assert.Equal(t, "application/json", response.Header().Get("Content-Type"))
+	assert.Equal(t, "public, max-age=60", response.Header().Get("Cache-Control"))
+	var etag = response.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	response = serve(handler, http.MethodHead, "/files/docs/report.json")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "11", response.Header().Get("Content-Length"))
+	assert.Equal(t, 0, response.Body.Len())
+
+	var request = func(headers map[string]string) *httptest.ResponseRecorder {
+		var req = httptest.NewRequest(http.MethodGet, "/files/docs/report.json", nil)
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+		var recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	// 条件请求
+	assert.Equal(t, http.StatusNotModified, request(map[string]string{"If-None-Match": etag}).Code)
+	assert.Equal(t, http.StatusNotModified, request(map[string]string{"If-Modified-Since": time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)}).Code)
+	assert.Equal(t, http.StatusOK, request(map[string]string{"If-None-Match": `"other"`}).Code)
+
+	// Range 以及 If-Range
+	response = request(map[string]string{"Range": "bytes=1-4"})
+	assert.Equal(t, http.StatusPartialContent, response.Code)
+	assert.Equal(t, `"ok"`, response.Body.String())
+	response = request(map[string]string{"Range": "bytes=1-4", "If-Range": etag})
+	assert.Equal(t, http.StatusPartialContent, response.Code)
+	response = request(map[string]string{"Range": "bytes=1-4", "If-Range": `"stale"`})
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, `{"ok":true}`, response.Body.String())
+
+	// 修改文件后 ETag 变化
+	time.Sleep(time.Millisecond)
+	assert.Nil(t, disk.Put("docs/report.json", `{"ok":false}`))
+	assert.Equal(t, http.StatusOK, request(map[string]string{"If-None-Match": etag}).Code)
+
+	// 不可见文件、不存在的文件以及前缀之外的路径
+	assert.Equal(t, http.StatusNotFound, serve(handler, http.MethodGet, "/files/private/secret.txt").Code)
+	assert.Equal(t, http.StatusNotFound, serve(handler, http.MethodGet, "/files/missing.txt").Code)
+	assert.Equal(t, http.StatusNotFound, serve(handler, http.MethodGet, "/other/docs/report.json").Code)
+	assert.Equal(t, http.StatusNotFound, serve(handler, http.MethodGet, "/files/").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(handler, http.MethodPost, "/files/docs/report.json").Code)
+
+	// 没有签名器时签名请求无效
+	assert.Equal(t, http.StatusForbidden, serve(handler, http.MethodGet, "/files/private/secret.txt?signature=x&expires=1").Code)
+}
+
+func TestHandlerSigned(t *testing.T) {
+	var factory = filesystem.New(filesystem.Config{
+		Default: "local",
+		Disks: map[string]contracts.Fields{
+			"local": {
+				"driver": "local",
+				"root":   t.TempDir(),
+				"perm":   os.FileMode(0755),
+				"url":    "http://localhost:8000/files",
+				"secret": "app-key",
+			},
+		},
+	})
+	var disk = factory.Disk("local")
+	assert.Nil(t, disk.Put("private/secret.txt", "secret"))
+	assert.Nil(t, disk.SetVisibility("private/secret.txt", 0600))
+	assert.Nil(t, disk.Put("public/page.html", "<p>hi</p>"))
+	assert.Nil(t, disk.SetVisibility("public/page.html", 0644))
+	assert.Nil(t, disk.MakeDirectory("public/nested"))
+
+	// 使用本地磁盘自身的签名器
+	var handler = filesystem.Handler(disk, filesystem.HandlerOptions{Prefix: "/files"})
+
+	assert.Equal(t, http.StatusNotFound, serve(handler, http.MethodGet, "/files/private/secret.txt").Code)
+	assert.Equal(t, http.StatusNotFound, serve(handler, http.MethodGet, "/files/public/nested").Code)
+	var response = serve(handler, http.MethodGet, "/files/public/page.html")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "text/html; charset=utf-8", response.Header().Get("Content-Type"))
+
+	var temporary, err = disk.(urlDisk).TemporaryUrl("private/secret.txt", time.Minute)
+	assert.Nil(t, err)
+	response = serve(handler, http.MethodGet, temporary)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "secret", response.Body.String())
+	assert.Equal(t, "private", response.Header().Get("Cache-Control"))
+
+	var signer, _ = adapters.NewUrlSigner("http://localhost:8000/files", []byte("app-key"))
+	expired, _ := signer.TemporaryUrl("private/secret.txt", time.Now().Add(-time.Minute))
+	assert.Equal(t, http.StatusForbidden, serve(handler, http.MethodGet, expired).Code)
+	forged, _ := signer.TemporaryUrl("public/page.html", time.Now().Add(time.Minute))
+	assert.Equal(t, http.StatusForbidden, serve(handler, http.MethodGet, forged+"x").Code)
+}
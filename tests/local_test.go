@@ -0,0 +1,106 @@
+package tests
+
+import (
+	"errors"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem"
+	"github.com/goal-web/filesystem/adapters"
+	"github.com/goal-web/filesystem/file"
+	"github.com/stretchr/testify/assert"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalSandbox(t *testing.T) {
+	var (
+		parent = t.TempDir()
+		root   = filepath.Join(parent, "root")
+		disk   = adapters.NewLocalFileSystem("local", root, os.ModePerm)
+	)
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(parent, "secret.txt"), []byte("secret"), 0644))
+	assert.Nil(t, disk.Put("a.txt", "goal"))
+
+	for _, path := range []string{"../secret.txt", "/../secret.txt", "a/../../secret.txt", "..", "a\x00b"} {
+		var _, err = disk.Get(path)
+		assert.True(t, errors.Is(err, filesystem.ErrOutsideRoot), path)
+		assert.True(t, errors.Is(err, fs.ErrPermission), path)
+		assert.True(t, errors.Is(disk.Put(path, "hacked"), filesystem.ErrOutsideRoot), path)
+		assert.True(t, errors.Is(disk.Delete(path), filesystem.ErrOutsideRoot), path)
+		assert.True(t, errors.Is(disk.Copy("a.txt", path), filesystem.ErrOutsideRoot), path)
+		assert.True(t, errors.Is(disk.Move(path, "a.txt"), filesystem.ErrOutsideRoot), path)
+		assert.False(t, disk.Exists(path), path)
+	}
+	assert.Len(t, disk.Files(".."), 0)
+	assert.Len(t, disk.AllDirectories("../"), 0)
+
+	var contents, _ = ioutil.ReadFile(filepath.Join(parent, "secret.txt"))
+	assert.Equal(t, "secret", string(contents))
+
+	// 没有超出根目录的路径会被规范化
+	assert.Nil(t, disk.Put("a/./b/../c.txt", "goal"))
+	assert.True(t, disk.Exists("/a/c.txt"))
+	assert.Equal(t, "a/c.txt", disk.AllFiles("a")[0].(file.File).Path())
+
+	// 读取失败时不能当作空文件覆盖，文件不存在时创建
+	var err = disk.Prepend("a", "head")
+	assert.NotNil(t, err)
+	assert.False(t, errors.Is(err, file.ErrNotFound))
+	assert.True(t, disk.Exists("a/c.txt"))
+	assert.Nil(t, disk.Prepend("new.txt", "head"))
+	contents, _ = ioutil.ReadFile(filepath.Join(root, "new.txt"))
+	assert.Equal(t, "head", string(contents))
+}
+
+func TestLocalRestrictSymlinks(t *testing.T) {
+	var (
+		parent  = t.TempDir()
+		root    = filepath.Join(parent, "root")
+		outside = filepath.Join(parent, "outside")
+	)
+	assert.Nil(t, os.MkdirAll(filepath.Join(root, "inside"), os.ModePerm))
+	assert.Nil(t, os.Mkdir(outside, os.ModePerm))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(outside, "secret.txt"), []byte("secret"), 0644))
+	assert.Nil(t, os.Symlink(outside, filepath.Join(root, "escape")))
+	assert.Nil(t, os.Symlink(filepath.Join(root, "inside"), filepath.Join(root, "alias")))
+	assert.Nil(t, os.Symlink(filepath.Join(outside, "secret.txt"), filepath.Join(root, "link.txt")))
+
+	var unrestricted = adapters.NewLocalFileSystem("local", root, os.ModePerm)
+	var contents, err = unrestricted.Get("escape/secret.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "secret", contents)
+
+	var disk = filesystem.New(filesystem.Config{
+		Default: "local",
+		Disks: map[string]contracts.Fields{
+			"local": {"driver": "local", "root": root, "perm": os.ModePerm, "restrict_symlinks": true},
+		},
+	}).Disk("local")
+
+	_, err = disk.Get("escape/secret.txt")
+	assert.True(t, errors.Is(err, filesystem.ErrOutsideRoot))
+	assert.True(t, errors.Is(disk.Put("escape/new.txt", "hacked"), filesystem.ErrOutsideRoot))
+	assert.False(t, unrestricted.Exists("escape/new.txt"))
+
+	// 列表中不包含指向根目录之外的符号链接，也无法通过 File 读取
+	_, err = disk.Get("link.txt")
+	assert.True(t, errors.Is(err, filesystem.ErrOutsideRoot))
+	for _, listed := range append(disk.Files(""), disk.AllFiles("")...) {
+		assert.NotEqual(t, "link.txt", listed.Name())
+		assert.NotEqual(t, "escape", listed.Name())
+		assert.NotEqual(t, "secret", listed.ReadString())
+	}
+	var names []string
+	for _, listed := range unrestricted.Files("") {
+		names = append(names, listed.Name())
+	}
+	assert.Contains(t, names, "link.txt")
+
+	// 指向根目录内部的符号链接依然可以使用
+	assert.Nil(t, disk.Put("alias/a.txt", "goal"))
+	contents, err = disk.Get("inside/a.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "goal", contents)
+}
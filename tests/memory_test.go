@@ -0,0 +1,83 @@
+package tests
+
+import (
+	"fmt"
+	"github.com/goal-web/filesystem/adapters"
+	"github.com/goal-web/filesystem/file"
+	"github.com/stretchr/testify/assert"
+	"io/fs"
+	"os"
+	"sync"
+	"testing"
+)
+
+func TestMemory(t *testing.T) {
+	var disk = adapters.NewMemoryFileSystem("memory", os.ModePerm)
+
+	assert.Nil(t, disk.Put("/a/b/c.txt", "goal"))
+	assert.True(t, disk.Exists("/a/b"))
+	assert.Equal(t, []string{"a"}, disk.Directories("/"))
+	assert.Equal(t, []string{"b"}, disk.Directories("/a"))
+	assert.Equal(t, []string{"a", "a/b"}, disk.AllDirectories("/"))
+
+	assert.Nil(t, disk.MakeDirectory("/a/empty"))
+	assert.Equal(t, []string{"b", "empty"}, disk.Directories("/a"))
+
+	var files = disk.AllFiles("/")
+	assert.Len(t, files, 1)
+	assert.Equal(t, "c.txt", files[0].Name())
+	assert.Equal(t, "goal", files[0].ReadString())
+
+	// 文件对象读取的是内存中的最新内容
+	assert.Nil(t, disk.Append("/a/b/c.txt", "-web"))
+	assert.Equal(t, "goal-web", files[0].ReadString())
+	assert.Nil(t, disk.Prepend("/a/b/c.txt", "hello "))
+	assert.Equal(t, "hello goal-web", string(files[0].Read()))
+
+	var before, _ = disk.LastModified("/a/b/c.txt")
+	assert.Nil(t, disk.Put("/a/b/c.txt", "goal"))
+	var after, _ = disk.LastModified("/a/b/c.txt")
+	assert.False(t, after.Before(before))
+
+	assert.Equal(t, file.VISIBLE, disk.GetVisibility("/a/b/c.txt"))
+	assert.Nil(t, disk.SetVisibility("/a/b/c.txt", 0400))
+	assert.Equal(t, file.INVISIBLE, disk.GetVisibility("/a/b/c.txt"))
+
+	assert.Nil(t, disk.Copy("/a/b/c.txt", "/d/e.txt"))
+	assert.Nil(t, disk.Move("/a", "/f"))
+	assert.False(t, disk.Exists("/a/b/c.txt"))
+	var contents, err = disk.Get("/f/b/c.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "goal", contents)
+
+	_, err = disk.Get("/a/b/c.txt")
+	assert.ErrorIs(t, err, fs.ErrNotExist)
+
+	assert.NotNil(t, disk.Delete("/f"))
+	assert.Nil(t, disk.DeleteDirectory("/f"))
+	assert.False(t, disk.Exists("/f/b"))
+	assert.Len(t, disk.AllFiles("/"), 1)
+}
+
+func TestMemoryConcurrency(t *testing.T) {
+	var (
+		disk = adapters.NewMemoryFileSystem("memory", os.ModePerm)
+		wg   sync.WaitGroup
+	)
+
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			var path = fmt.Sprintf("/concurrency/%d/file.txt", i%5)
+			assert.Nil(t, disk.Append(path, "x"))
+			_, _ = disk.Get(path)
+			_ = disk.AllFiles("/concurrency")
+		}(i)
+	}
+	wg.Wait()
+
+	for _, item := range disk.AllFiles("/concurrency") {
+		assert.Equal(t, "xxxxxxxxxx", item.ReadString())
+	}
+}
@@ -0,0 +1,160 @@
+package tests
+
+import (
+	"errors"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem"
+	"github.com/goal-web/filesystem/adapters"
+	"github.com/stretchr/testify/assert"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+)
+
+var diskDownErr = errors.New("disk is down")
+
+// flakyDisk 可以模拟故障的磁盘
+type flakyDisk struct {
+	contracts.FileSystem
+	down bool
+}
+
+func (this *flakyDisk) Get(path string) (string, error) {
+	if this.down {
+		return "", diskDownErr
+	}
+	return this.FileSystem.Get(path)
+}
+
+func (this *flakyDisk) Put(path, contents string) error {
+	if this.down {
+		return diskDownErr
+	}
+	return this.FileSystem.Put(path, contents)
+}
+
+func (this *flakyDisk) Delete(path string) error {
+	if this.down {
+		return diskDownErr
+	}
+	return this.FileSystem.Delete(path)
+}
+
+func (this *flakyDisk) Append(path, contents string) error {
+	if this.down {
+		return diskDownErr
+	}
+	return this.FileSystem.Append(path, contents)
+}
+
+func TestMirror(t *testing.T) {
+	var (
+		primary = adapters.NewMemoryFileSystem("primary", os.ModePerm)
+		flaky   = &flakyDisk{FileSystem: adapters.NewMemoryFileSystem("secondary", os.ModePerm)}
+		mirror  = adapters.NewMirror("mirror", []contracts.FileSystem{primary, flaky}, 1)
+	)
+
+	var written, err = mirror.PutStream("contracts/a.pdf", strings.NewReader("signed"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(6), written)
+	assert.True(t, primary.Exists("contracts/a.pdf"))
+	assert.True(t, flaky.Exists("contracts/a.pdf"))
+	assert.Len(t, mirror.Divergences(), 0)
+
+	flaky.down = true
+	assert.Nil(t, mirror.Put("contracts/b.pdf", "b"))
+	assert.Nil(t, mirror.Delete("contracts/a.pdf"))
+	var divergences = mirror.Divergences()
+	assert.Len(t, divergences, 2)
+	assert.Equal(t, "contracts/a.pdf", divergences[0].Path)
+	assert.Equal(t, []string{"secondary"}, divergences[1].Missed)
+
+	// 主副本缺失时从其他副本读取
+	assert.Nil(t, primary.Put("contracts/c.pdf", "c"))
+	flaky.down = false
+	assert.Nil(t, flaky.FileSystem.Put("contracts/d.pdf", "d"))
+	var contents, _ = mirror.Get("contracts/d.pdf")
+	assert.Equal(t, "d", contents)
+
+	assert.Nil(t, mirror.Repair())
+	assert.Len(t, mirror.Divergences(), 0)
+	assert.False(t, flaky.Exists("contracts/a.pdf"))
+	contents, _ = flaky.Get("contracts/b.pdf")
+	assert.Equal(t, "b", contents)
+
+	// 未达到 quorum
+	var strict = filesystem.New(filesystem.Config{
+		Default: "mirror",
+		Disks: map[string]contracts.Fields{
+			"mirror": {"driver": "mirror", "disks": []interface{}{"a", "b"}},
+			"a":      {"driver": "memory"},
+			"b":      {"driver": "memory", "read_only": true},
+		},
+	}).Disk("mirror")
+	err = strict.Put("a.txt", "a")
+	var mirrorErr *adapters.MirrorError
+	assert.True(t, errors.As(err, &mirrorErr))
+	assert.Equal(t, 1, mirrorErr.Succeeded)
+	assert.True(t, errors.Is(err, filesystem.ErrReadOnly))
+	assert.True(t, errors.Is(strict.Delete("missing.txt"), fs.ErrNotExist))
+}
+
+func TestMirrorSkipsDivergedReplicas(t *testing.T) {
+	var (
+		flaky  = &flakyDisk{FileSystem: adapters.NewMemoryFileSystem("primary", os.ModePerm)}
+		good   = adapters.NewMemoryFileSystem("secondary", os.ModePerm)
+		mirror = adapters.NewMirror("mirror", []contracts.FileSystem{flaky, good}, 1)
+	)
+	assert.Nil(t, mirror.Put("a.txt", "v1"))
+	assert.Nil(t, mirror.Put("b.txt", "b"))
+
+	flaky.down = true
+	assert.Nil(t, mirror.Put("a.txt", "v2"))
+	assert.Nil(t, mirror.Delete("b.txt"))
+	flaky.down = false
+
+	// 第一个副本仍然保存着旧的内容，读取时应该跳过
+	var contents, err = mirror.Get("a.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", contents)
+	size, err := mirror.Size("a.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), size)
+	assert.False(t, mirror.Exists("b.txt"))
+
+	assert.Nil(t, mirror.Repair())
+	contents, _ = flaky.Get("a.txt")
+	assert.Equal(t, "v2", contents)
+	assert.False(t, flaky.Exists("b.txt"))
+}
+
+func TestMirrorKeepsAppendDivergences(t *testing.T) {
+	var (
+		flaky  = &flakyDisk{FileSystem: adapters.NewMemoryFileSystem("primary", os.ModePerm)}
+		good   = adapters.NewMemoryFileSystem("secondary", os.ModePerm)
+		mirror = adapters.NewMirror("mirror", []contracts.FileSystem{flaky, good}, 1)
+	)
+	assert.Nil(t, mirror.Put("logs/a.log", "a"))
+
+	flaky.down = true
+	assert.Nil(t, mirror.Append("/logs/a.log", "b"))
+	flaky.down = false
+
+	// 不同的写法是同一个路径
+	var contents, _ = mirror.Get("logs/a.log")
+	assert.Equal(t, "ab", contents)
+
+	// 之后的追加全部成功也不能修复缺失的那一次追加
+	assert.Nil(t, mirror.Append("logs/a.log", "c"))
+	assert.Len(t, mirror.Divergences(), 1)
+	contents, _ = mirror.Get("./logs/a.log")
+	assert.Equal(t, "abc", contents)
+	contents, _ = flaky.Get("logs/a.log")
+	assert.Equal(t, "ac", contents)
+
+	assert.Nil(t, mirror.Repair())
+	assert.Len(t, mirror.Divergences(), 0)
+	contents, _ = flaky.Get("logs/a.log")
+	assert.Equal(t, "abc", contents)
+}
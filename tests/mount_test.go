@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"errors"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem"
+	"github.com/goal-web/filesystem/file"
+	"github.com/stretchr/testify/assert"
+	"io/fs"
+	"os"
+	"testing"
+)
+
+func filePaths(files []contracts.File) (results []string) {
+	for _, item := range files {
+		results = append(results, item.(file.File).Path())
+	}
+	return
+}
+
+func TestMount(t *testing.T) {
+	var factory = filesystem.New(filesystem.Config{
+		Default: "app",
+		Disks: map[string]contracts.Fields{
+			"app": {"driver": "mount", "mounts": contracts.Fields{
+				"avatars":     "memory",
+				"tmp":         "local",
+				"reports/old": "archive",
+			}},
+			"memory":  {"driver": "memory"},
+			"archive": {"driver": "memory"},
+			"local":   {"driver": "local", "root": t.TempDir(), "perm": os.ModePerm},
+		},
+	})
+
+	var (
+		app   = factory.Disk("app")
+		local = factory.Disk("local")
+	)
+
+	assert.Nil(t, app.Put("avatars/a.png", "a"))
+	assert.Nil(t, app.Put("tmp/upload/b.png", "b"))
+	assert.Nil(t, app.Put("reports/old/2021.csv", "csv"))
+	assert.True(t, factory.Disk("memory").Exists("a.png"))
+	assert.True(t, local.Exists("upload/b.png"))
+	assert.True(t, factory.Disk("archive").Exists("2021.csv"))
+
+	assert.Equal(t, []string{"avatars", "reports", "tmp"}, app.Directories(""))
+	assert.Equal(t, []string{"old"}, app.Directories("reports"))
+	assert.True(t, app.Exists("reports"))
+	assert.Equal(t, []string{"avatars", "reports", "reports/old", "tmp", "tmp/upload"}, app.AllDirectories(""))
+	assert.Equal(t, []string{"avatars/a.png", "reports/old/2021.csv", "tmp/upload/b.png"}, filePaths(app.AllFiles("")))
+	assert.Equal(t, "app", app.Files("avatars")[0].Disk())
+
+	// 不同挂载点之间的复制和移动
+	assert.Nil(t, app.Copy("avatars/a.png", "tmp/a.png"))
+	assert.Nil(t, app.Move("tmp/upload/b.png", "avatars/b.png"))
+	var contents, _ = local.Get("a.png")
+	assert.Equal(t, "a", contents)
+	assert.False(t, local.Exists("upload/b.png"))
+	contents, _ = app.Get("avatars/b.png")
+	assert.Equal(t, "b", contents)
+
+	var _, err = app.Get("avatars/missing.png")
+	var wrapped *filesystem.Error
+	assert.True(t, errors.As(err, &wrapped))
+	assert.Equal(t, "app", wrapped.Disk)
+	assert.Equal(t, "avatars/missing.png", wrapped.Path)
+
+	// 没有挂载的路径
+	assert.True(t, errors.Is(app.Put("unknown/a.txt", "a"), fs.ErrNotExist))
+	_, err = app.Get("reports/2022.csv")
+	assert.True(t, errors.Is(err, filesystem.ErrNotFound))
+}
+
+func TestMountDriverConfig(t *testing.T) {
+	// 配置文件解析出的映射是 map[string]interface{}
+	var factory = filesystem.New(filesystem.Config{
+		Default: "app",
+		Disks: map[string]contracts.Fields{
+			"app":     {"driver": "mount", "mounts": map[string]interface{}{"avatars": "memory"}},
+			"memory":  {"driver": "memory"},
+			"invalid": {"driver": "mount", "mounts": []interface{}{"memory"}},
+		},
+	})
+
+	assert.Nil(t, factory.Put("avatars/a.png", "a"))
+	assert.True(t, factory.Disk("memory").Exists("a.png"))
+
+	assert.PanicsWithError(t, "invalid disk config: mounts must be a map, got []interface {}", func() {
+		factory.Disk("invalid")
+	})
+}
@@ -0,0 +1,101 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem"
+	"github.com/qiniu/go-sdk/v7/storage"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeQiniu 只实现列举以及批量删除的七牛接口
+type fakeQiniu struct {
+	sync.Mutex
+	keys    map[string]bool
+	batches []int
+}
+
+func (this *fakeQiniu) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	this.Lock()
+	defer this.Unlock()
+
+	_ = r.ParseForm()
+	switch r.URL.Path {
+	case "/list":
+		var (
+			prefix    = r.Form.Get("prefix")
+			offset, _ = strconv.Atoi(r.Form.Get("marker"))
+			limit, _  = strconv.Atoi(r.Form.Get("limit"))
+			keys      []string
+		)
+		for key := range this.keys {
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+
+		var result = map[string]interface{}{"items": []storage.ListItem{}}
+		var end = offset + limit
+		if end < len(keys) {
+			result["marker"] = strconv.Itoa(end)
+		} else {
+			end = len(keys)
+		}
+		var items = make([]storage.ListItem, 0, end-offset)
+		for _, key := range keys[offset:end] {
+			items = append(items, storage.ListItem{Key: key, Fsize: 1})
+		}
+		result["items"] = items
+		_ = json.NewEncoder(w).Encode(result)
+	case "/batch":
+		var ops = r.Form["op"]
+		this.batches = append(this.batches, len(ops))
+		if len(ops) > 1000 {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": "too many operations"})
+			return
+		}
+		var rets = make([]storage.BatchOpRet, 0, len(ops))
+		for range ops {
+			rets = append(rets, storage.BatchOpRet{Code: http.StatusOK})
+		}
+		_ = json.NewEncoder(w).Encode(rets)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestQiniuDeleteLargeDirectory(t *testing.T) {
+	var fake = &fakeQiniu{keys: map[string]bool{"other/a.log": true}}
+	for i := 0; i < 2500; i++ {
+		fake.keys[fmt.Sprintf("logs/%04d.log", i)] = true
+	}
+	var server = httptest.NewServer(fake)
+	defer server.Close()
+
+	var host = strings.TrimPrefix(server.URL, "http://")
+	var disk = filesystem.New(filesystem.Config{
+		Default: "qiniu",
+		Disks: map[string]contracts.Fields{
+			"qiniu": {
+				"driver":     "qiniu",
+				"bucket":     "goal",
+				"access_key": "access",
+				"secret_key": "secret",
+				"config":     &storage.Config{RsfHost: host, CentralRsHost: host},
+			},
+		},
+	}).Disk("qiniu")
+
+	assert.Nil(t, disk.DeleteDirectory("logs"))
+	assert.Equal(t, []int{1000, 1000, 500}, fake.batches)
+}
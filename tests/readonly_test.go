@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"errors"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem"
+	"github.com/stretchr/testify/assert"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReadOnly(t *testing.T) {
+	var root = t.TempDir()
+	assert.Nil(t, ioutil.WriteFile(root+"/asset.txt", []byte("goal"), 0644))
+
+	var factory = filesystem.New(filesystem.Config{
+		Default: "assets",
+		Disks: map[string]contracts.Fields{
+			"assets":  {"driver": "local", "root": root, "perm": os.ModePerm, "read_only": true},
+			"memory":  {"driver": "memory"},
+			"staging": {"driver": "readonly", "disk": "memory"},
+		},
+	})
+
+	for _, disk := range []contracts.FileSystem{factory.Disk("assets"), factory.Disk("staging")} {
+		var writes = map[string]error{
+			"Put":             disk.Put("asset.txt", "hacked"),
+			"WriteStream":     disk.WriteStream("asset.txt", "hacked"),
+			"Append":          disk.Append("asset.txt", "hacked"),
+			"Prepend":         disk.Prepend("asset.txt", "hacked"),
+			"Delete":          disk.Delete("asset.txt"),
+			"Copy":            disk.Copy("asset.txt", "copy.txt"),
+			"Move":            disk.Move("asset.txt", "move.txt"),
+			"SetVisibility":   disk.SetVisibility("asset.txt", 0600),
+			"MakeDirectory":   disk.MakeDirectory("dir"),
+			"DeleteDirectory": disk.DeleteDirectory(""),
+		}
+		for method, err := range writes {
+			assert.True(t, errors.Is(err, filesystem.ErrReadOnly), method)
+			assert.True(t, errors.Is(err, fs.ErrPermission), method)
+		}
+	}
+
+	var _, err = factory.(*filesystem.Factory).PutStream("stream.txt", strings.NewReader("hacked"))
+	assert.True(t, errors.Is(err, filesystem.ErrReadOnly))
+
+	// 读取操作不受影响
+	contents, err := factory.Get("asset.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "goal", contents)
+	assert.Equal(t, "assets", factory.Disk("assets").Name())
+	assert.Len(t, factory.Files(""), 1)
+
+	reader, err := factory.(*filesystem.Factory).ReadRange("asset.txt", 1, 2)
+	assert.Nil(t, err)
+	partial, _ := ioutil.ReadAll(reader)
+	assert.Equal(t, "oa", string(partial))
+}
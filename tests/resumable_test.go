@@ -0,0 +1,225 @@
+package tests
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func tus(handler http.Handler, method, target string, headers map[string]string, body string) *httptest.ResponseRecorder {
+	var request = httptest.NewRequest(method, target, strings.NewReader(body))
+	request.Header.Set("Tus-Resumable", filesystem.TusVersion)
+	for key, value := range headers {
+		request.Header.Set(key, value)
+	}
+	var recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestResumableHandler(t *testing.T) {
+	var factory = filesystem.New(filesystem.Config{
+		Default: "memory",
+		Disks: map[string]contracts.Fields{
+			"memory": {"driver": "memory"},
+		},
+	}).(*filesystem.Factory)
+
+	var completed []filesystem.UploadSession
+	var handler = factory.Resumable(filesystem.ResumableOptions{
+		Directory: "videos",
+		MaxSize:   64,
+		Prefix:    "/uploads/",
+		OnComplete: func(session filesystem.UploadSession) {
+			completed = append(completed, session)
+		},
+	}).Handler()
+
+	var response = tus(handler, http.MethodOptions, "/uploads", nil, "")
+	assert.Equal(t, http.StatusNoContent, response.Code)
+	assert.Equal(t, "64", response.Header().Get("Tus-Max-Size"))
+	assert.Equal(t, "creation,termination,expiration", response.Header().Get("Tus-Extension"))
+
+	var request = httptest.NewRequest(http.MethodPost, "/uploads", nil)
+	var recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusPreconditionFailed, recorder.Code)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, tus(handler, http.MethodPost, "/uploads", map[string]string{"Upload-Length": "65"}, "").Code)
+	assert.Equal(t, http.StatusBadRequest, tus(handler, http.MethodPost, "/uploads", map[string]string{"Upload-Length": "x"}, "").Code)
+
+	response = tus(handler, http.MethodPost, "/uploads", map[string]string{
+		"Upload-Length":   "10",
+		"Upload-Metadata": "filename " + base64.StdEncoding.EncodeToString([]byte("clip.MP4")) + ",private",
+	}, "")
+	assert.Equal(t, http.StatusCreated, response.Code)
+	var location = response.Header().Get("Location")
+	assert.True(t, strings.HasPrefix(location, "/uploads/"))
+	assert.NotEmpty(t, response.Header().Get("Upload-Expires"))
+
+	response = tus(handler, http.MethodHead, location, nil, "")
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "0", response.Header().Get("Upload-Offset"))
+	assert.Equal(t, "10", response.Header().Get("Upload-Length"))
+	assert.Equal(t, "no-store", response.Header().Get("Cache-Control"))
+
+	var patch = func(offset, body string) *httptest.ResponseRecorder {
+		return tus(handler, http.MethodPatch, location, map[string]string{
+			"Content-Type":  "application/offset+octet-stream",
+			"Upload-Offset": offset,
+		}, body)
+	}
+	response = patch("0", "goal")
+	assert.Equal(t, http.StatusNoContent, response.Code)
+	assert.Equal(t, "4", response.Header().Get("Upload-Offset"))
+
+	// 位置不匹配以及内容类型错误
+	response = patch("0", "goal")
+	assert.Equal(t, http.StatusConflict, response.Code)
+	assert.Equal(t, "4", response.Header().Get("Upload-Offset"))
+	assert.Equal(t, http.StatusUnsupportedMediaType, tus(handler, http.MethodPatch, location, map[string]string{"Upload-Offset": "4"}, "-web-").Code)
+	assert.Len(t, completed, 0)
+
+	response = patch("4", "-files")
+	assert.Equal(t, http.StatusNoContent, response.Code)
+	assert.Equal(t, "10", response.Header().Get("Upload-Offset"))
+	assert.Len(t, completed, 1)
+	assert.Equal(t, "clip.MP4", completed[0].Name)
+	assert.Equal(t, "", completed[0].Metadata["private"])
+	assert.True(t, strings.HasPrefix(completed[0].Path, "videos/"))
+	assert.True(t, strings.HasSuffix(completed[0].Path, ".mp4"))
+	var contents, _ = factory.Get(completed[0].Path)
+	assert.Equal(t, "goal-files", contents)
+	assert.Len(t, factory.AllFiles(filesystem.DefaultUploadStateDirectory), 1)
+
+	// 完成后仍然可以查询位置
+	response = tus(handler, http.MethodHead, location, nil, "")
+	assert.Equal(t, "10", response.Header().Get("Upload-Offset"))
+
+	// 取消之后会话不存在，已经完成的文件保留
+	assert.Equal(t, http.StatusNoContent, tus(handler, http.MethodDelete, location, nil, "").Code)
+	assert.Equal(t, http.StatusNotFound, tus(handler, http.MethodHead, location, nil, "").Code)
+	assert.True(t, factory.Exists(completed[0].Path))
+	assert.Equal(t, http.StatusNotFound, tus(handler, http.MethodHead, "/uploads/../memory", nil, "").Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, tus(handler, http.MethodGet, location, nil, "").Code)
+}
+
+func TestResumableAssemble(t *testing.T) {
+	var server = newFakeS3("goal")
+	defer server.Close()
+
+	var factory = filesystem.New(filesystem.Config{
+		Default: "s3",
+		Disks: map[string]contracts.Fields{
+			"s3": {
+				"driver":     "s3",
+				"endpoint":   server.URL,
+				"bucket":     "goal",
+				"path_style": true,
+				"part_size":  4,
+			},
+			"state": {"driver": "memory"},
+		},
+	}).(*filesystem.Factory)
+
+	var resumable = factory.Resumable(filesystem.ResumableOptions{StateDisk: "state"})
+	var session, err = resumable.Create(19, "readme.txt", nil)
+	assert.Nil(t, err)
+	assert.False(t, session.Append)
+
+	session, err = resumable.WriteChunk(session.Id, 0, strings.NewReader("goal-web/"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(9), session.Offset)
+
+	// 超过文件大小的分片会被丢弃
+	_, err = resumable.WriteChunk(session.Id, 9, strings.NewReader("filesystem!"))
+	assert.True(t, errors.Is(err, filesystem.FileTooLargeErr))
+	session, _ = resumable.Session(session.Id)
+	assert.Equal(t, int64(9), session.Offset)
+	assert.Len(t, factory.Disk("state").AllFiles(filesystem.DefaultUploadStateDirectory+"/"+session.Id), 1)
+
+	// 空分片不会改变位置
+	session, err = resumable.WriteChunk(session.Id, 9, strings.NewReader(""))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(9), session.Offset)
+
+	session, err = resumable.WriteChunk(session.Id, 9, strings.NewReader("filesystem"))
+	assert.Nil(t, err)
+	assert.True(t, session.Completed)
+	var contents, _ = factory.Disk("s3").Get(session.Path)
+	assert.Equal(t, "goal-web/filesystem", contents)
+	assert.Len(t, factory.Disk("state").AllFiles(filesystem.DefaultUploadStateDirectory+"/"+session.Id), 0)
+
+	// 空文件创建时直接完成
+	empty, err := resumable.Create(0, "empty.txt", nil)
+	assert.Nil(t, err)
+	assert.True(t, empty.Completed)
+	assert.True(t, factory.Disk("s3").Exists(empty.Path))
+}
+
+func TestResumableExpire(t *testing.T) {
+	var factory = filesystem.New(filesystem.Config{
+		Default: "memory",
+		Disks: map[string]contracts.Fields{
+			"memory": {"driver": "memory"},
+		},
+	}).(*filesystem.Factory)
+
+	var resumable = factory.Resumable(filesystem.ResumableOptions{Expiry: 50 * time.Millisecond})
+	var abandoned, _ = resumable.Create(8, "a.bin", nil)
+	_, err := resumable.WriteChunk(abandoned.Id, 0, strings.NewReader("half"))
+	assert.Nil(t, err)
+	assert.Len(t, factory.AllFiles(filesystem.DefaultUploadStateDirectory), 2)
+
+	time.Sleep(100 * time.Millisecond)
+	var active, _ = resumable.Create(8, "b.bin", nil)
+
+	_, err = resumable.Session(abandoned.Id)
+	assert.True(t, errors.Is(err, filesystem.UploadSessionNotFoundErr))
+	_, err = resumable.WriteChunk(abandoned.Id, 4, strings.NewReader("more"))
+	assert.True(t, errors.Is(err, filesystem.UploadSessionNotFoundErr))
+
+	var expired, expireErr = resumable.Expire()
+	assert.Nil(t, expireErr)
+	assert.Equal(t, 1, expired)
+	assert.Len(t, factory.AllFiles(filesystem.DefaultUploadStateDirectory), 1)
+	_, err = resumable.Session(active.Id)
+	assert.Nil(t, err)
+
+	// 取消上传删除临时文件
+	_, err = resumable.WriteChunk(active.Id, 0, strings.NewReader("data"))
+	assert.Nil(t, err)
+	assert.Nil(t, resumable.Abort(active.Id))
+	assert.Len(t, factory.AllFiles(filesystem.DefaultUploadStateDirectory), 0)
+	assert.True(t, errors.Is(resumable.Abort(active.Id), filesystem.UploadSessionNotFoundErr))
+}
+
+func TestResumableLocal(t *testing.T) {
+	var factory = filesystem.New(filesystem.Config{
+		Default: "local",
+		Disks: map[string]contracts.Fields{
+			"local": {"driver": "local", "root": t.TempDir(), "perm": os.FileMode(0755)},
+		},
+	}).(*filesystem.Factory)
+
+	var resumable = factory.Resumable(filesystem.ResumableOptions{Directory: "uploads"})
+	var session, err = resumable.Create(8, "notes.txt", nil)
+	assert.Nil(t, err)
+	assert.True(t, session.Append)
+
+	for _, chunk := range []string{"go", "al", "-web"} {
+		session, err = resumable.WriteChunk(session.Id, session.Offset, strings.NewReader(chunk))
+		assert.Nil(t, err)
+	}
+	assert.True(t, session.Completed)
+	var contents, _ = factory.Get(session.Path)
+	assert.Equal(t, "goal-web", contents)
+	assert.False(t, factory.Exists(filesystem.DefaultUploadStateDirectory+"/"+session.Id+".part"))
+}
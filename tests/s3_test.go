@@ -0,0 +1,331 @@
+package tests
+
+import (
+	"crypto/md5"
+	"encoding/xml"
+	"fmt"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem"
+	"github.com/goal-web/filesystem/file"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeS3 一个简单的 S3 协议内存实现，只支持 path style
+type fakeS3 struct {
+	sync.Mutex
+	bucket  string
+	objects map[string][]byte
+	acl     map[string]string
+	uploads map[string]map[int][]byte
+	pageMax int
+	// failGets 不为 0 时读取对象返回该状态码
+	failGets int
+}
+
+func newFakeS3(bucket string) *httptest.Server {
+	return httptest.NewServer(&fakeS3{bucket: bucket, objects: map[string][]byte{}, acl: map[string]string{}, uploads: map[string]map[int][]byte{}, pageMax: 2})
+}
+
+func (this *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	this.Lock()
+	defer this.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=") {
+		this.error(w, http.StatusForbidden, "AccessDenied")
+		return
+	}
+
+	var (
+		path  = strings.TrimPrefix(r.URL.Path, "/"+this.bucket)
+		key   = strings.TrimPrefix(path, "/")
+		query = r.URL.Query()
+	)
+
+	if this.failGets != 0 && r.Method == http.MethodGet && key != "" {
+		this.error(w, this.failGets, "ServiceUnavailable")
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && key == "" && query.Get("list-type") == "2":
+		this.list(w, query)
+	case r.Method == http.MethodPost && key == "" && query.Has("delete"):
+		var request struct {
+			Objects []struct {
+				Key string `xml:"Key"`
+			} `xml:"Object"`
+		}
+		var body, _ = ioutil.ReadAll(r.Body)
+		_ = xml.Unmarshal(body, &request)
+		for _, object := range request.Objects {
+			delete(this.objects, object.Key)
+		}
+		_, _ = w.Write([]byte("<DeleteResult></DeleteResult>"))
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		var id = fmt.Sprintf("upload-%d", len(this.uploads)+1)
+		this.uploads[id] = map[int][]byte{}
+		this.acl[key] = r.Header.Get("X-Amz-Acl")
+		_, _ = fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		var number, _ = strconv.Atoi(query.Get("partNumber"))
+		this.uploads[query.Get("uploadId")][number], _ = ioutil.ReadAll(r.Body)
+		w.Header().Set("ETag", fmt.Sprintf("\"etag-%d\"", number))
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		var request struct {
+			Parts []struct {
+				PartNumber int `xml:"PartNumber"`
+			} `xml:"Part"`
+		}
+		var body, _ = ioutil.ReadAll(r.Body)
+		_ = xml.Unmarshal(body, &request)
+		var contents []byte
+		for _, part := range request.Parts {
+			contents = append(contents, this.uploads[query.Get("uploadId")][part.PartNumber]...)
+		}
+		this.objects[key] = contents
+		delete(this.uploads, query.Get("uploadId"))
+		_, _ = w.Write([]byte("<CompleteMultipartUploadResult></CompleteMultipartUploadResult>"))
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(this.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case query.Has("acl") && r.Method == http.MethodPut:
+		this.acl[key] = r.Header.Get("X-Amz-Acl")
+	case query.Has("acl"):
+		var grants = ""
+		if this.acl[key] == "public-read" {
+			grants = "<Grant><Grantee><URI>http://acs.amazonaws.com/groups/global/AllUsers</URI></Grantee><Permission>READ</Permission></Grant>"
+		}
+		_, _ = fmt.Fprintf(w, "<AccessControlPolicy><AccessControlList>%s</AccessControlList></AccessControlPolicy>", grants)
+	case r.Method == http.MethodPut && r.Header.Get("X-Amz-Copy-Source") != "":
+		var source, _ = url.PathUnescape(strings.TrimPrefix(r.Header.Get("X-Amz-Copy-Source"), "/"+this.bucket+"/"))
+		var contents, exists = this.objects[source]
+		if !exists {
+			this.error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		this.objects[key] = contents
+		_, _ = w.Write([]byte("<CopyObjectResult></CopyObjectResult>"))
+	case r.Method == http.MethodPut:
+		this.objects[key], _ = ioutil.ReadAll(r.Body)
+		this.acl[key] = r.Header.Get("X-Amz-Acl")
+	case r.Method == http.MethodDelete:
+		delete(this.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		var contents, exists = this.objects[key]
+		if !exists {
+			this.error(w, http.StatusNotFound, "NoSuchKey")
+			return
+		}
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		w.Header().Set("ETag", fmt.Sprintf("\"%x\"", md5.Sum(contents)))
+		var status = http.StatusOK
+		if rangeHeader := r.Header.Get("Range"); strings.HasPrefix(rangeHeader, "bytes=") {
+			var bounds = strings.SplitN(strings.TrimPrefix(rangeHeader, "bytes="), "-", 2)
+			var start, _ = strconv.Atoi(bounds[0])
+			var end, endErr = strconv.Atoi(bounds[1])
+			if endErr != nil || end >= len(contents) {
+				end = len(contents) - 1
+			}
+			if start >= len(contents) {
+				this.error(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange")
+				return
+			}
+			contents, status = contents[start:end+1], http.StatusPartialContent
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(contents)))
+		w.WriteHeader(status)
+		if r.Method == http.MethodGet {
+			_, _ = w.Write(contents)
+		}
+	default:
+		this.error(w, http.StatusMethodNotAllowed, "MethodNotAllowed")
+	}
+}
+
+func (this *fakeS3) error(w http.ResponseWriter, status int, code string) {
+	w.WriteHeader(status)
+	_, _ = fmt.Fprintf(w, "<Error><Code>%s</Code><Message>%s</Message></Error>", code, code)
+}
+
+func (this *fakeS3) list(w http.ResponseWriter, query url.Values) {
+	var (
+		prefix    = query.Get("prefix")
+		delimiter = query.Get("delimiter")
+		token     = query.Get("continuation-token")
+		keys      []string
+		prefixes  = map[string]bool{}
+		builder   strings.Builder
+	)
+	for key := range this.objects {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		var rest = strings.TrimPrefix(key, prefix)
+		if index := strings.Index(rest, delimiter); delimiter != "" && index >= 0 {
+			prefixes[prefix+rest[:index+1]] = true
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var start = 0
+	for start < len(keys) && token != "" && keys[start] <= token {
+		start++
+	}
+	var end = start + this.pageMax
+	if end > len(keys) {
+		end = len(keys)
+	}
+
+	builder.WriteString("<ListBucketResult>")
+	for _, key := range keys[start:end] {
+		_, _ = fmt.Fprintf(&builder, "<Contents><Key>%s</Key><Size>%d</Size><LastModified>%s</LastModified></Contents>",
+			key, len(this.objects[key]), time.Now().UTC().Format(time.RFC3339))
+	}
+	if token == "" {
+		for commonPrefix := range prefixes {
+			_, _ = fmt.Fprintf(&builder, "<CommonPrefixes><Prefix>%s</Prefix></CommonPrefixes>", commonPrefix)
+		}
+	}
+	if end < len(keys) {
+		_, _ = fmt.Fprintf(&builder, "<IsTruncated>true</IsTruncated><NextContinuationToken>%s</NextContinuationToken>", keys[end-1])
+	}
+	builder.WriteString("</ListBucketResult>")
+	_, _ = w.Write([]byte(builder.String()))
+}
+
+func TestS3(t *testing.T) {
+	var server = newFakeS3("goal")
+	defer server.Close()
+
+	var disk = filesystem.New(filesystem.Config{
+		Default: "s3",
+		Disks: map[string]contracts.Fields{
+			"s3": {
+				"driver":     "s3",
+				"endpoint":   server.URL,
+				"bucket":     "goal",
+				"path_style": true,
+				"access_key": "minio",
+				"secret_key": "minio123",
+			},
+		},
+	}).Disk("s3")
+
+	assert.Nil(t, disk.Put("/test/demo.txt", "goal"))
+	assert.True(t, disk.Exists("/test/demo.txt"))
+	assert.True(t, disk.Exists("/test"))
+	assert.False(t, disk.Exists("/test/missing.txt"))
+
+	var contents, err = disk.Get("/test/demo.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "goal", contents)
+
+	size, err := disk.Size("/test/demo.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), size)
+
+	assert.Nil(t, disk.Append("/test/demo.txt", "-web"))
+	assert.Nil(t, disk.Copy("/test/demo.txt", "/test/nested/copy.txt"))
+	assert.Nil(t, disk.Move("/test/nested/copy.txt", "/test/nested/moved.txt"))
+	assert.False(t, disk.Exists("/test/nested/copy.txt"))
+
+	for i := 0; i < 5; i++ {
+		assert.Nil(t, disk.Put(fmt.Sprintf("/test/page/%d.txt", i), "page"))
+	}
+
+	assert.Len(t, disk.Files("/test"), 1)
+	assert.Len(t, disk.AllFiles("/test"), 7)
+	assert.ElementsMatch(t, []string{"nested", "page"}, disk.Directories("/test"))
+	assert.Equal(t, []string{"nested", "page"}, disk.AllDirectories("/test"))
+	assert.Equal(t, "goal-web", disk.AllFiles("/test/nested")[0].ReadString())
+
+	_, err = disk.Get("/test/missing.txt")
+	assert.NotNil(t, err)
+
+	assert.Nil(t, disk.SetVisibility("/test/demo.txt", 0644))
+	assert.Equal(t, file.VISIBLE, disk.GetVisibility("/test/demo.txt"))
+	assert.Nil(t, disk.SetVisibility("/test/demo.txt", 0600))
+	assert.Equal(t, file.INVISIBLE, disk.GetVisibility("/test/demo.txt"))
+
+	assert.Nil(t, disk.DeleteDirectory("/test"))
+	assert.Len(t, disk.AllFiles("/test"), 0)
+}
+
+func TestS3PutStream(t *testing.T) {
+	var server = newFakeS3("goal")
+	defer server.Close()
+
+	var factory = filesystem.New(filesystem.Config{
+		Default: "s3",
+		Disks: map[string]contracts.Fields{
+			"s3": {
+				"driver":     "s3",
+				"endpoint":   server.URL,
+				"bucket":     "goal",
+				"path_style": true,
+				"part_size":  4,
+			},
+		},
+	}).(*filesystem.Factory)
+
+	// 超过一个分片，使用分片上传
+	var written, err = factory.PutStream("multipart.txt", strings.NewReader("goal-web/filesystem"), file.WithPerm(0644))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(19), written)
+	var contents, _ = factory.Get("multipart.txt")
+	assert.Equal(t, "goal-web/filesystem", contents)
+	assert.Equal(t, file.VISIBLE, factory.GetVisibility("multipart.txt"))
+
+	// 不超过一个分片，直接上传
+	written, err = factory.PutStream("single.txt", strings.NewReader("goal"))
+	assert.Nil(t, err)
+	assert.Equal(t, int64(4), written)
+	contents, _ = factory.Get("single.txt")
+	assert.Equal(t, "goal", contents)
+	assert.Equal(t, file.INVISIBLE, factory.GetVisibility("single.txt"))
+}
+
+func TestS3AppendKeepsObjectOnReadError(t *testing.T) {
+	var server = newFakeS3("goal")
+	defer server.Close()
+
+	var disk = filesystem.New(filesystem.Config{
+		Default: "s3",
+		Disks: map[string]contracts.Fields{
+			"s3": {"driver": "s3", "endpoint": server.URL, "bucket": "goal", "path_style": true},
+		},
+	}).Disk("s3")
+	assert.Nil(t, disk.Put("log.txt", "existing"))
+
+	// 读取失败时不能用追加的内容覆盖原有对象
+	var fake = server.Config.Handler.(*fakeS3)
+	fake.Lock()
+	fake.failGets = http.StatusServiceUnavailable
+	fake.Unlock()
+	assert.NotNil(t, disk.Append("log.txt", "-more"))
+	assert.NotNil(t, disk.Prepend("log.txt", "more-"))
+
+	fake.Lock()
+	fake.failGets = 0
+	fake.Unlock()
+	var contents, _ = disk.Get("log.txt")
+	assert.Equal(t, "existing", contents)
+
+	// 对象不存在时直接创建
+	assert.Nil(t, disk.Append("new.txt", "created"))
+	contents, _ = disk.Get("new.txt")
+	assert.Equal(t, "created", contents)
+}
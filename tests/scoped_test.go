@@ -0,0 +1,73 @@
+package tests
+
+import (
+	"errors"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem"
+	"github.com/goal-web/filesystem/file"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestScoped(t *testing.T) {
+	var factory = filesystem.New(filesystem.Config{
+		Default: "memory",
+		Disks: map[string]contracts.Fields{
+			"memory": {"driver": "memory"},
+			"tenant": {"driver": "scoped", "disk": "memory", "prefix": "/tenant-42/"},
+		},
+	}).(*filesystem.Factory)
+
+	var (
+		disk   = factory.Disk("memory")
+		tenant = factory.Disk("tenant")
+		other  = factory.Scoped("memory", "tenant-43")
+	)
+
+	assert.Nil(t, tenant.Put("avatars/a.png", "a"))
+	assert.Nil(t, other.Put("avatars/b.png", "b"))
+	assert.True(t, disk.Exists("tenant-42/avatars/a.png"))
+	assert.True(t, disk.Exists("tenant-43/avatars/b.png"))
+
+	// 无法通过 .. 访问其他租户的文件
+	assert.False(t, tenant.Exists("../tenant-43/avatars/b.png"))
+	assert.Nil(t, tenant.Put("../../escape.txt", "goal"))
+	assert.True(t, disk.Exists("tenant-42/escape.txt"))
+
+	var files = tenant.AllFiles("")
+	assert.Len(t, files, 2)
+	assert.Equal(t, "avatars/a.png", files[0].(file.File).Path())
+	assert.Equal(t, "tenant", files[0].Disk())
+	assert.Equal(t, "a", files[0].ReadString())
+	assert.Equal(t, []string{"avatars"}, tenant.Directories(""))
+
+	var _, err = tenant.Get("missing.png")
+	var wrapped *filesystem.Error
+	assert.True(t, errors.As(err, &wrapped))
+	assert.Equal(t, "tenant", wrapped.Disk)
+	assert.Equal(t, "missing.png", wrapped.Path)
+
+	assert.Panics(t, func() {
+		factory.Reload("tenant", contracts.Fields{"driver": "scoped", "disk": "tenant"})
+	})
+}
+
+func TestScopedFileNameOverS3(t *testing.T) {
+	var server = newFakeS3("goal")
+	defer server.Close()
+
+	var disk = filesystem.New(filesystem.Config{
+		Default: "tenant",
+		Disks: map[string]contracts.Fields{
+			"s3":     {"driver": "s3", "endpoint": server.URL, "bucket": "goal", "path_style": true},
+			"tenant": {"driver": "scoped", "disk": "s3", "prefix": "tenant-42/"},
+		},
+	}).Disk("tenant")
+	assert.Nil(t, disk.Put("a/b.txt", "goal"))
+
+	// 文件名以及路径都不包含前缀
+	var files = disk.AllFiles("a")
+	assert.Len(t, files, 1)
+	assert.Equal(t, "b.txt", files[0].Name())
+	assert.Equal(t, "a/b.txt", files[0].(file.File).Path())
+}
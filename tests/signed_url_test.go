@@ -0,0 +1,118 @@
+package tests
+
+import (
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem"
+	"github.com/goal-web/filesystem/adapters"
+	"github.com/goal-web/filesystem/file"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// urlDisk 支持生成地址的本地磁盘
+type urlDisk interface {
+	file.UrlGenerator
+	Handler() http.Handler
+}
+
+func serve(handler http.Handler, method, target string) *httptest.ResponseRecorder {
+	var recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(method, target, nil))
+	return recorder
+}
+
+func TestLocalTemporaryUrl(t *testing.T) {
+	var factory = filesystem.New(filesystem.Config{
+		Default: "local",
+		Disks: map[string]contracts.Fields{
+			"local": {
+				"driver": "local",
+				"root":   t.TempDir(),
+				"perm":   os.FileMode(0755),
+				"url":    "http://localhost:8000/files/",
+				"secret": "app-key",
+			},
+		},
+	})
+	assert.Nil(t, factory.Put("contracts/合同 1.pdf", "signed"))
+
+	var disk = factory.Disk("local").(urlDisk)
+	assert.Equal(t, "http://localhost:8000/files/contracts/%E5%90%88%E5%90%8C%201.pdf", disk.Url("contracts/合同 1.pdf"))
+
+	var temporary, err = disk.TemporaryUrl("contracts/合同 1.pdf", time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(temporary, "signature="))
+
+	var handler = disk.Handler()
+	var response = serve(handler, http.MethodGet, temporary)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "signed", response.Body.String())
+	assert.Equal(t, "application/pdf", response.Header().Get("Content-Type"))
+
+	// Range 请求
+	var request = httptest.NewRequest(http.MethodGet, temporary, nil)
+	request.Header.Set("Range", "bytes=1-3")
+	var recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	assert.Equal(t, http.StatusPartialContent, recorder.Code)
+	assert.Equal(t, "ign", recorder.Body.String())
+
+	// 未签名的地址只能访问 VISIBLE 文件
+	assert.Nil(t, factory.SetVisibility("contracts/合同 1.pdf", 0644))
+	response = serve(handler, http.MethodGet, disk.Url("contracts/合同 1.pdf"))
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "signed", response.Body.String())
+	assert.Equal(t, "", response.Header().Get("Cache-Control"))
+	assert.Equal(t, "", serve(handler, http.MethodGet, disk.Url("contracts/合同 1.pdf")+"?download=x.pdf").Header().Get("Content-Disposition"))
+	assert.Equal(t, http.StatusForbidden, serve(handler, http.MethodGet, disk.Url("missing.pdf")).Code)
+	assert.Nil(t, factory.SetVisibility("contracts/合同 1.pdf", 0600))
+
+	// 未签名的 INVISIBLE 文件、篡改以及过期的地址
+	assert.Equal(t, http.StatusForbidden, serve(handler, http.MethodGet, disk.Url("contracts/合同 1.pdf")).Code)
+	assert.Equal(t, http.StatusForbidden, serve(handler, http.MethodGet, strings.Replace(temporary, "contracts", "other", 1)).Code)
+	var signer, _ = adapters.NewUrlSigner("http://localhost:8000/files", []byte("app-key"))
+	expired, _ := signer.TemporaryUrl("contracts/合同 1.pdf", time.Now().Add(-time.Minute))
+	assert.Equal(t, http.StatusForbidden, serve(handler, http.MethodGet, expired).Code)
+
+	// 下载文件名参与签名
+	download, _ := disk.TemporaryUrl("contracts/合同 1.pdf", time.Minute, file.WithDownload("合同.pdf"))
+	response = serve(handler, http.MethodGet, download)
+	assert.Equal(t, http.StatusOK, response.Code)
+	assert.Equal(t, "attachment; filename*=utf-8''%E5%90%88%E5%90%8C.pdf", response.Header().Get("Content-Disposition"))
+	assert.Equal(t, http.StatusForbidden, serve(handler, http.MethodGet, strings.Replace(download, "download=", "download=x", 1)).Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, serve(handler, http.MethodPost, temporary).Code)
+
+	missing, _ := disk.TemporaryUrl("missing.pdf", time.Minute)
+	assert.Equal(t, http.StatusNotFound, serve(handler, http.MethodGet, missing).Code)
+
+	// 没有配置 url
+	var plain = adapters.NewLocalFileSystem("plain", t.TempDir(), os.ModePerm).(urlDisk)
+	assert.Equal(t, "", plain.Url("a.txt"))
+	_, err = plain.TemporaryUrl("a.txt", time.Minute)
+	assert.ErrorIs(t, err, file.ErrUnsupported)
+}
+
+func TestUrlSignerFieldBoundaries(t *testing.T) {
+	var signer, _ = adapters.NewUrlSigner("http://localhost:8000/files", []byte("app-key"))
+	var signed, err = signer.TemporaryUrl("a.pdf", time.Now().Add(time.Minute),
+		file.WithDownload("a.pdf\ntext/html"), file.WithResponseContentType("application/pdf"))
+	assert.Nil(t, err)
+
+	var request = httptest.NewRequest(http.MethodGet, signed, nil)
+	_, options, err := signer.Verify(request)
+	assert.Nil(t, err)
+	assert.Equal(t, "a.pdf\ntext/html", options.Download)
+
+	// 下载文件名中的换行不能被拆分到 content_type 中
+	var query = request.URL.Query()
+	query.Set("download", "a.pdf")
+	query.Set("content_type", "text/html\napplication/pdf")
+	request.URL.RawQuery = query.Encode()
+	_, _, err = signer.Verify(request)
+	assert.ErrorIs(t, err, adapters.InvalidSignatureErr)
+}
@@ -0,0 +1,43 @@
+package tests
+
+import (
+	"github.com/goal-web/filesystem/adapters"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+type trackedHandle struct {
+	io.ReadSeeker
+	closed bool
+}
+
+func (this *trackedHandle) Close() error {
+	this.closed = true
+	return nil
+}
+
+type trackedOpener struct {
+	handles []*trackedHandle
+}
+
+func (this *trackedOpener) Open(path string) (io.ReadSeekCloser, error) {
+	var handle = &trackedHandle{ReadSeeker: strings.NewReader(path)}
+	this.handles = append(this.handles, handle)
+	return handle, nil
+}
+
+func TestReadStreamClosesHandle(t *testing.T) {
+	var opener = &trackedOpener{}
+
+	var reader, err = adapters.ReadStream(opener, "goal-web")
+	assert.Nil(t, err)
+	assert.False(t, opener.handles[0].closed)
+
+	contents, err := ioutil.ReadAll(reader)
+	assert.Nil(t, err)
+	assert.Equal(t, "goal-web", string(contents))
+	assert.True(t, opener.handles[0].closed)
+}
@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem"
+	"github.com/goal-web/filesystem/adapters"
+	"github.com/goal-web/filesystem/file"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"sync/atomic"
+	"testing"
+)
+
+// checksumDisk 记录 Checksum 调用次数的磁盘
+type checksumDisk struct {
+	contracts.FileSystem
+	checksums int32
+}
+
+func (this *checksumDisk) Checksum(path string) (string, error) {
+	atomic.AddInt32(&this.checksums, 1)
+	return this.FileSystem.(file.Checksummer).Checksum(path)
+}
+
+// plainDisk 不支持 Checksum 的磁盘
+type plainDisk struct {
+	contracts.FileSystem
+}
+
+func TestSync(t *testing.T) {
+	var (
+		src = adapters.NewLocalFileSystem("local", t.TempDir(), os.ModePerm)
+		dst = adapters.NewMemoryFileSystem("backup", os.ModePerm)
+	)
+	for path, contents := range map[string]string{
+		"a.txt":          "a",
+		"docs/b.txt":     "b",
+		"docs/c/d.txt":   "d",
+		"cache/tmp.bin":  "tmp",
+		"docs/notes.log": "log",
+	} {
+		assert.Nil(t, src.Put(path, contents))
+	}
+	assert.Nil(t, dst.Put("stale.txt", "stale"))
+	assert.Nil(t, dst.Put("docs/b.txt", "old"))
+
+	var options = filesystem.SyncOptions{
+		Delete:      true,
+		DryRun:      true,
+		Exclude:     []string{"cache/**", "*.log"},
+		Parallelism: 4,
+	}
+
+	var result, err = filesystem.Sync(src, dst, options)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a.txt", "docs/c/d.txt"}, result.Copied)
+	assert.Equal(t, []string{"docs/b.txt"}, result.Updated)
+	assert.Equal(t, []string{"stale.txt"}, result.Deleted)
+	assert.False(t, dst.Exists("a.txt"))
+	assert.True(t, dst.Exists("stale.txt"))
+
+	var events int32
+	options.DryRun = false
+	options.Progress = func(event filesystem.SyncEvent) {
+		assert.Nil(t, event.Err)
+		assert.Equal(t, 4, event.Total)
+		atomic.AddInt32(&events, 1)
+	}
+	result, err = filesystem.Sync(src, dst, options)
+	assert.Nil(t, err)
+	assert.Equal(t, int32(4), atomic.LoadInt32(&events))
+	assert.Equal(t, int64(3), result.Bytes)
+	assert.False(t, dst.Exists("stale.txt"))
+	assert.False(t, dst.Exists("cache/tmp.bin"))
+	var contents, _ = dst.Get("docs/b.txt")
+	assert.Equal(t, "b", contents)
+
+	// 再次同步时只处理变化的文件，内容变化但大小不变时通过校验值发现
+	assert.Nil(t, src.Put("a.txt", "A"))
+	result, err = filesystem.Sync(src, dst, filesystem.SyncOptions{Include: []string{"*.txt"}})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a.txt"}, result.Updated)
+	assert.Equal(t, []string{"docs/b.txt", "docs/c/d.txt"}, result.Skipped)
+	assert.Len(t, result.Copied, 0)
+	contents, _ = dst.Get("a.txt")
+	assert.Equal(t, "A", contents)
+}
+
+func TestSyncWithoutChecksum(t *testing.T) {
+	var (
+		src = &checksumDisk{FileSystem: adapters.NewLocalFileSystem("local", t.TempDir(), os.ModePerm)}
+		dst = plainDisk{adapters.NewMemoryFileSystem("backup", os.ModePerm)}
+	)
+	assert.Nil(t, src.Put("a.txt", "a"))
+	assert.Nil(t, dst.Put("a.txt", "a"))
+
+	// 目标不支持 Checksum 时按修改时间比较，不需要读取源文件
+	var result, err = filesystem.Sync(src, dst, filesystem.SyncOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a.txt"}, result.Skipped)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&src.checksums))
+}
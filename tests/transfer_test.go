@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"errors"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem"
+	"github.com/goal-web/filesystem/adapters"
+	"github.com/goal-web/filesystem/file"
+	"github.com/stretchr/testify/assert"
+	"io/fs"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestTransfer(t *testing.T) {
+	var server = newFakeS3("goal")
+	defer server.Close()
+
+	var factory = filesystem.New(filesystem.Config{
+		Default: "local",
+		Disks: map[string]contracts.Fields{
+			"local":  {"driver": "local", "root": t.TempDir(), "perm": os.FileMode(0755)},
+			"memory": {"driver": "memory", "perm": os.FileMode(0600)},
+			"s3":     {"driver": "s3", "endpoint": server.URL, "bucket": "goal", "path_style": true},
+		},
+	}).(*filesystem.Factory)
+
+	var (
+		local   = factory.Disk("local")
+		memory  = factory.Disk("memory")
+		modTime = time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC)
+	)
+	assert.Nil(t, local.Put("uploads/a.txt", "goal"))
+	assert.Nil(t, local.(file.Toucher).Touch("uploads/a.txt", modTime))
+
+	assert.Nil(t, factory.CopyBetween("local", "uploads/a.txt", "memory", "a.txt"))
+	var contents, _ = memory.Get("a.txt")
+	assert.Equal(t, "goal", contents)
+	assert.Equal(t, file.VISIBLE, memory.GetVisibility("a.txt"))
+	lastModified, _ := memory.LastModified("a.txt")
+	assert.True(t, modTime.Equal(lastModified))
+	assert.True(t, local.Exists("uploads/a.txt"))
+
+	assert.Nil(t, factory.MoveUri("local://uploads/a.txt", "s3://uploads/a.txt"))
+	assert.False(t, local.Exists("uploads/a.txt"))
+	contents, _ = factory.Disk("s3").Get("uploads/a.txt")
+	assert.Equal(t, "goal", contents)
+	assert.Equal(t, file.VISIBLE, factory.Disk("s3").GetVisibility("uploads/a.txt"))
+	sum, err := adapters.Checksum(factory.Disk("s3"), "uploads/a.txt")
+	assert.Nil(t, err)
+	assert.Equal(t, "a38985738a48f96903f23de0e5e8111d", sum)
+
+	// 同一个磁盘内直接移动
+	assert.Nil(t, factory.MoveUri("memory://a.txt", "memory://b.txt"))
+	assert.True(t, memory.Exists("b.txt"))
+
+	assert.True(t, errors.Is(factory.CopyBetween("local", "missing.txt", "memory", "c.txt"), fs.ErrNotExist))
+	assert.False(t, memory.Exists("c.txt"))
+	assert.True(t, errors.Is(factory.CopyUri("a.txt", "memory://a.txt"), filesystem.InvalidUriErr))
+}
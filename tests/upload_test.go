@@ -0,0 +1,210 @@
+package tests
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem"
+	"github.com/goal-web/filesystem/adapters"
+	"github.com/stretchr/testify/assert"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// png 文件头，用于 MIME 检测
+var pngHeader = "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 24)
+
+type uploadPart struct {
+	field, name, contents string
+}
+
+// racingDisk 在 Move 之前模拟另一个请求写入了相同内容的文件
+type racingDisk struct {
+	contracts.FileSystem
+	// refuse 目标已经存在时 Move 返回错误，否则覆盖
+	refuse bool
+}
+
+func (this *racingDisk) Move(from, to string) error {
+	var contents, _ = this.FileSystem.Get(from)
+	_ = this.FileSystem.Put(to, contents)
+	if this.refuse {
+		return errors.New("destination already exists")
+	}
+	return this.FileSystem.Move(from, to)
+}
+
+func uploadRequest(t *testing.T, handler http.Handler, parts ...uploadPart) (*httptest.ResponseRecorder, []filesystem.UploadedFile) {
+	var (
+		body   bytes.Buffer
+		writer = multipart.NewWriter(&body)
+	)
+	for _, part := range parts {
+		if part.name == "" {
+			assert.Nil(t, writer.WriteField(part.field, part.contents))
+			continue
+		}
+		var w, err = writer.CreateFormFile(part.field, part.name)
+		assert.Nil(t, err)
+		_, _ = w.Write([]byte(part.contents))
+	}
+	assert.Nil(t, writer.Close())
+
+	var request = httptest.NewRequest(http.MethodPost, "/upload", &body)
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+	var recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	var result struct {
+		Files []filesystem.UploadedFile `json:"files"`
+	}
+	_ = json.Unmarshal(recorder.Body.Bytes(), &result)
+	return recorder, result.Files
+}
+
+func TestUploadHandler(t *testing.T) {
+	var factory = filesystem.New(filesystem.Config{
+		Default: "memory",
+		Disks: map[string]contracts.Fields{
+			"memory":  {"driver": "memory"},
+			"uploads": {"driver": "memory"},
+		},
+	}).(*filesystem.Factory)
+
+	var handler = factory.UploadHandler(filesystem.UploadOptions{
+		Disk:              "uploads",
+		Directory:         "avatars",
+		MaxFileSize:       64,
+		MaxTotalSize:      1024,
+		AllowedTypes:      []string{"image/*", "text/plain"},
+		AllowedExtensions: []string{".png", ".txt"},
+	})
+	var disk = factory.Disk("uploads")
+
+	var response, files = uploadRequest(t, handler,
+		uploadPart{field: "title", contents: "hello"},
+		uploadPart{field: "avatar", name: "me.PNG", contents: pngHeader},
+		uploadPart{field: "notes", name: "notes.txt", contents: "plain text"},
+	)
+	assert.Equal(t, http.StatusCreated, response.Code, response.Body.String())
+	assert.Equal(t, "application/json", response.Header().Get("Content-Type"))
+	assert.Len(t, files, 2)
+	assert.Equal(t, "avatar", files[0].Field)
+	assert.Equal(t, "me.PNG", files[0].Name)
+	assert.Equal(t, "uploads", files[0].Disk)
+	assert.Equal(t, "image/png", files[0].ContentType)
+	assert.Equal(t, int64(len(pngHeader)), files[0].Size)
+	assert.True(t, strings.HasPrefix(files[0].Path, "avatars/"))
+	assert.True(t, strings.HasSuffix(files[0].Path, ".png"))
+	assert.Equal(t, "text/plain", files[1].ContentType)
+	var contents, _ = disk.Get(files[0].Path)
+	assert.Equal(t, pngHeader, contents)
+	contents, _ = disk.Get(files[1].Path)
+	assert.Equal(t, "plain text", contents)
+	assert.False(t, factory.Disk("memory").Exists(files[0].Path))
+
+	// 超过单个文件大小，已经保存的文件会被删除
+	var before = len(disk.AllFiles("avatars"))
+	response, _ = uploadRequest(t, handler,
+		uploadPart{field: "avatar", name: "ok.png", contents: pngHeader},
+		uploadPart{field: "avatar", name: "big.png", contents: pngHeader + strings.Repeat("x", 64)},
+	)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, response.Code)
+	assert.True(t, strings.Contains(response.Body.String(), "too large"))
+	assert.Len(t, disk.AllFiles("avatars"), before)
+
+	// 扩展名以及内容类型
+	response, _ = uploadRequest(t, handler, uploadPart{field: "avatar", name: "me.gif", contents: pngHeader})
+	assert.Equal(t, http.StatusUnsupportedMediaType, response.Code)
+	response, _ = uploadRequest(t, handler, uploadPart{field: "avatar", name: "fake.png", contents: "%PDF-1.4 not an image"})
+	assert.Equal(t, http.StatusUnsupportedMediaType, response.Code)
+
+	// 没有文件以及请求方法
+	response, _ = uploadRequest(t, handler, uploadPart{field: "title", contents: "hello"})
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	var recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/upload", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader("{}")))
+	assert.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestUploadTotalSizeAndHashNaming(t *testing.T) {
+	var factory = filesystem.New(filesystem.Config{
+		Default: "memory",
+		Disks: map[string]contracts.Fields{
+			"memory": {"driver": "memory"},
+		},
+	}).(*filesystem.Factory)
+	var disk = factory.Disk("memory")
+
+	var limited = factory.UploadHandler(filesystem.UploadOptions{MaxFileSize: 64, MaxTotalSize: 80})
+	var response, _ = uploadRequest(t, limited,
+		uploadPart{field: "a", name: "a.txt", contents: strings.Repeat("a", 60)},
+		uploadPart{field: "b", name: "b.txt", contents: strings.Repeat("b", 60)},
+	)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, response.Code)
+	assert.Len(t, disk.AllFiles(""), 0)
+
+	var handler = factory.UploadHandler(filesystem.UploadOptions{Directory: "blobs", Naming: filesystem.UploadNameHash, Field: "file"})
+	var sum = sha256.Sum256([]byte("same contents"))
+	response, files := uploadRequest(t, handler,
+		uploadPart{field: "file", name: "one.txt", contents: "same contents"},
+		uploadPart{field: "file", name: "two.TXT", contents: "same contents"},
+		uploadPart{field: "ignored", name: "other.txt", contents: "other"},
+	)
+	assert.Equal(t, http.StatusCreated, response.Code, response.Body.String())
+	assert.Len(t, files, 2)
+	assert.Equal(t, "blobs/"+hex.EncodeToString(sum[:])+".txt", files[0].Path)
+	assert.Equal(t, files[0].Path, files[1].Path)
+	assert.Equal(t, hex.EncodeToString(sum[:]), files[0].Hash)
+	assert.Len(t, disk.AllFiles("blobs"), 1)
+
+	// 失败时不会删除之前已经存在的同内容文件
+	response, _ = uploadRequest(t, handler,
+		uploadPart{field: "file", name: "one.txt", contents: "same contents"},
+		uploadPart{field: "file", name: "big.txt", contents: strings.Repeat("x", filesystem.DefaultMaxUploadFileSize+1)},
+	)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, response.Code)
+	assert.True(t, disk.Exists(files[0].Path))
+	assert.Len(t, disk.AllFiles("blobs"), 1)
+}
+
+func TestUploadHashNamingRace(t *testing.T) {
+	for _, refuse := range []bool{false, true} {
+		var factory = filesystem.New(filesystem.Config{
+			Default: "racing",
+			Disks: map[string]contracts.Fields{
+				"racing": {"driver": "racing"},
+			},
+		}).(*filesystem.Factory)
+		factory.Extend("racing", func(name string, config contracts.Fields) contracts.FileSystem {
+			return &racingDisk{FileSystem: adapters.MemoryAdapter(name, config), refuse: refuse}
+		})
+		var disk = factory.Disk("racing")
+		var handler = factory.UploadHandler(filesystem.UploadOptions{Directory: "blobs", Naming: filesystem.UploadNameHash})
+		var sum = sha256.Sum256([]byte("same contents"))
+		var path = "blobs/" + hex.EncodeToString(sum[:]) + ".txt"
+
+		var response, files = uploadRequest(t, handler, uploadPart{field: "file", name: "one.txt", contents: "same contents"})
+		assert.Equal(t, http.StatusCreated, response.Code, response.Body.String())
+		assert.Equal(t, path, files[0].Path)
+		assert.Equal(t, []string{path}, filePaths(disk.AllFiles("blobs")))
+
+		// 另一个请求已经返回了同一个文件，本次请求失败时不能删除
+		assert.Nil(t, disk.Delete(path))
+		response, _ = uploadRequest(t, handler,
+			uploadPart{field: "file", name: "one.txt", contents: "same contents"},
+			uploadPart{field: "file", name: "big.txt", contents: strings.Repeat("x", filesystem.DefaultMaxUploadFileSize+1)},
+		)
+		assert.Equal(t, http.StatusRequestEntityTooLarge, response.Code)
+		assert.Equal(t, []string{path}, filePaths(disk.AllFiles("blobs")))
+	}
+}
@@ -0,0 +1,119 @@
+package tests
+
+import (
+	"errors"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem"
+	"github.com/goal-web/filesystem/file"
+	"github.com/stretchr/testify/assert"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestS3TemporaryUrl(t *testing.T) {
+	var factory = filesystem.New(filesystem.Config{
+		Default: "s3",
+		Disks: map[string]contracts.Fields{
+			"s3": {
+				"driver":     "s3",
+				"endpoint":   "https://s3.example.com",
+				"bucket":     "goal",
+				"path_style": true,
+				"access_key": "access",
+				"secret_key": "secret",
+				"ttl":        600,
+			},
+			"scoped": {
+				"driver": "scoped",
+				"disk":   "s3",
+				"prefix": "tenants/1",
+			},
+		},
+	}).(*filesystem.Factory)
+
+	assert.Equal(t, "https://s3.example.com/goal/docs/a%20b.txt", factory.Url("docs/a b.txt"))
+
+	// 未指定 ttl 时使用磁盘配置
+	var temporary, err = factory.TemporaryUrl("docs/a b.txt", 0)
+	assert.Nil(t, err)
+	var parsed, _ = url.Parse(temporary)
+	assert.Equal(t, "/goal/docs/a b.txt", parsed.Path)
+	assert.Equal(t, "600", parsed.Query().Get("X-Amz-Expires"))
+	assert.Equal(t, "host", parsed.Query().Get("X-Amz-SignedHeaders"))
+	assert.Len(t, parsed.Query().Get("X-Amz-Signature"), 64)
+
+	temporary, err = factory.TemporaryUrl("docs/a b.txt", time.Minute, file.WithDownload("report.pdf"), file.WithResponseContentType("application/pdf"))
+	assert.Nil(t, err)
+	parsed, _ = url.Parse(temporary)
+	assert.Equal(t, "60", parsed.Query().Get("X-Amz-Expires"))
+	assert.Equal(t, "application/pdf", parsed.Query().Get("response-content-type"))
+	assert.True(t, strings.Contains(parsed.Query().Get("response-content-disposition"), "report.pdf"))
+
+	// 超过 7 天的签名地址 S3 不会接受
+	_, err = factory.TemporaryUrl("docs/a b.txt", 8*24*time.Hour)
+	assert.NotNil(t, err)
+
+	// scoped 磁盘生成的地址包含前缀
+	var generator, genErr = factory.UrlGenerator("scoped")
+	assert.Nil(t, genErr)
+	assert.Equal(t, "https://s3.example.com/goal/tenants/1/a.txt", generator.Url("a.txt"))
+	temporary, err = generator.TemporaryUrl("a.txt", time.Minute)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(temporary, "https://s3.example.com/goal/tenants/1/a.txt?"))
+}
+
+func TestQiniuTemporaryUrl(t *testing.T) {
+	var factory = filesystem.New(filesystem.Config{
+		Default: "qiniu",
+		Disks: map[string]contracts.Fields{
+			"qiniu": {
+				"driver":     "qiniu",
+				"ttl":        3600,
+				"private":    true,
+				"domain":     "https://image.example.com",
+				"bucket":     "goal",
+				"access_key": "access",
+				"secret_key": "secret",
+			},
+		},
+	}).(*filesystem.Factory)
+
+	var temporary, err = factory.TemporaryUrl("avatar.png", time.Minute, file.WithDownload("头像.png"))
+	assert.Nil(t, err)
+	var parsed, _ = url.Parse(temporary)
+	assert.Equal(t, "头像.png", parsed.Query().Get("attname"))
+	assert.NotEmpty(t, parsed.Query().Get("token"))
+
+	var deadline, _ = strconv.ParseInt(parsed.Query().Get("e"), 10, 64)
+	assert.InDelta(t, time.Now().Add(time.Minute).Unix(), deadline, 5)
+}
+
+func TestUrlUnsupported(t *testing.T) {
+	var factory = filesystem.New(filesystem.Config{
+		Default: "memory",
+		Disks: map[string]contracts.Fields{
+			"memory": {"driver": "memory"},
+			"local":  {"driver": "local", "root": t.TempDir(), "perm": os.ModePerm},
+			"scoped": {"driver": "scoped", "disk": "memory", "prefix": "tenant/"},
+			"assets": {"driver": "readonly", "disk": "local"},
+			"mount":  {"driver": "mount", "mounts": map[string]string{"a": "scoped", "b": "assets"}},
+		},
+	}).(*filesystem.Factory)
+
+	var _, err = factory.UrlGenerator("memory")
+	assert.True(t, errors.Is(err, file.ErrUnsupported))
+
+	// 包装磁盘取决于被包装的磁盘
+	for _, name := range []string{"local", "scoped", "assets", "mount"} {
+		_, err = factory.UrlGenerator(name)
+		assert.True(t, errors.Is(err, file.ErrUnsupported), name)
+	}
+
+	_, err = factory.TemporaryUrl("a.txt", time.Minute)
+	assert.True(t, errors.Is(err, file.ErrUnsupported))
+	assert.Equal(t, "", factory.Url("a.txt"))
+}
@@ -0,0 +1,65 @@
+package filesystem
+
+import (
+	"errors"
+	"github.com/goal-web/filesystem/adapters"
+	"strings"
+)
+
+// InvalidUriErr 文件地址格式错误，正确的格式为 disk://path
+var InvalidUriErr = errors.New("invalid file uri, expected disk://path")
+
+// ParseUri 解析 disk://path 格式的文件地址
+func ParseUri(uri string) (disk, path string, err error) {
+	var index = strings.Index(uri, "://")
+	if index <= 0 {
+		return "", "", InvalidUriErr
+	}
+	return uri[:index], uri[index+3:], nil
+}
+
+// CopyBetween 在两个磁盘之间复制文件，同一个磁盘内直接调用 Copy，不同磁盘之间通过流复制并校验文件大小
+func (this *Factory) CopyBetween(srcDisk, srcPath, dstDisk, dstPath string) error {
+	if srcDisk == dstDisk {
+		return this.Disk(srcDisk).Copy(srcPath, dstPath)
+	}
+	var _, err = adapters.Transfer(this.Disk(srcDisk), srcPath, this.Disk(dstDisk), dstPath)
+	return err
+}
+
+// MoveBetween 在两个磁盘之间移动文件，复制成功后才会删除源文件
+func (this *Factory) MoveBetween(srcDisk, srcPath, dstDisk, dstPath string) error {
+	if srcDisk == dstDisk {
+		return this.Disk(srcDisk).Move(srcPath, dstPath)
+	}
+	if err := this.CopyBetween(srcDisk, srcPath, dstDisk, dstPath); err != nil {
+		return err
+	}
+	return this.Disk(srcDisk).Delete(srcPath)
+}
+
+// CopyUri 使用 disk://path 格式的地址复制文件，例如 CopyUri("local://a.txt", "qiniu://a.txt")
+func (this *Factory) CopyUri(from, to string) error {
+	var srcDisk, srcPath, err = ParseUri(from)
+	if err != nil {
+		return err
+	}
+	dstDisk, dstPath, err := ParseUri(to)
+	if err != nil {
+		return err
+	}
+	return this.CopyBetween(srcDisk, srcPath, dstDisk, dstPath)
+}
+
+// MoveUri 使用 disk://path 格式的地址移动文件
+func (this *Factory) MoveUri(from, to string) error {
+	var srcDisk, srcPath, err = ParseUri(from)
+	if err != nil {
+		return err
+	}
+	dstDisk, dstPath, err := ParseUri(to)
+	if err != nil {
+		return err
+	}
+	return this.MoveBetween(srcDisk, srcPath, dstDisk, dstPath)
+}
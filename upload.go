@@ -0,0 +1,312 @@
+package filesystem
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/goal-web/contracts"
+	"github.com/goal-web/filesystem/adapters"
+	"github.com/goal-web/filesystem/file"
+	"github.com/goal-web/supports/logs"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	pathpkg "path"
+	"strings"
+)
+
+var (
+	FileTooLargeErr       = errors.New("uploaded file is too large")
+	UploadTooLargeErr     = errors.New("upload exceeds the total size limit")
+	FileTypeNotAllowedErr = errors.New("uploaded file type is not allowed")
+	NoUploadedFilesErr    = errors.New("no files were uploaded")
+	MalformedUploadErr    = errors.New("malformed multipart upload")
+)
+
+const (
+	// DefaultMaxUploadFileSize 没有配置单个文件大小限制时使用的默认值
+	DefaultMaxUploadFileSize = 32 << 20
+
+	// UploadNameUuid 使用随机的 UUID 作为文件名
+	UploadNameUuid = "uuid"
+
+	// UploadNameHash 使用内容的 SHA-256 作为文件名，内容相同的文件只会保存一份
+	UploadNameHash = "hash"
+)
+
+// UploadOptions 上传文件时的可选参数
+type UploadOptions struct {
+	// Disk 保存文件的磁盘，为空时使用默认磁盘
+	Disk string
+
+	// Directory 保存文件的目录
+	Directory string
+
+	// Field 只接收该表单字段中的文件，为空时接收所有文件字段
+	Field string
+
+	// MaxFileSize 单个文件的最大字节数，为 0 时使用 DefaultMaxUploadFileSize，小于 0 时不限制
+	MaxFileSize int64
+
+	// MaxTotalSize 整个请求中所有表单内容的最大字节数，小于等于 0 时不限制
+	MaxTotalSize int64
+
+	// AllowedTypes 允许的 MIME 类型，根据文件内容检测，支持 image/* 这样的通配，为空时不限制
+	AllowedTypes []string
+
+	// AllowedExtensions 允许的扩展名，例如 .jpg，不区分大小写，为空时不限制
+	AllowedExtensions []string
+
+	// Naming 文件命名方式，UploadNameUuid（默认）或者 UploadNameHash
+	Naming string
+
+	// WriteOptions 写入文件时的参数，MIME 类型会自动设置为检测到的类型
+	WriteOptions []file.WriteOption
+}
+
+// UploadedFile 保存成功的文件
+type UploadedFile struct {
+	Field       string `json:"field"`
+	Name        string `json:"name"`
+	Disk        string `json:"disk"`
+	Path        string `json:"path"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type"`
+	Hash        string `json:"hash"`
+}
+
+// newUuid 生成随机的 UUID v4
+func newUuid() string {
+	var id = make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, id); err != nil {
+		panic(err)
+	}
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+	var encoded = hex.EncodeToString(id)
+	return encoded[:8] + "-" + encoded[8:12] + "-" + encoded[12:16] + "-" + encoded[16:20] + "-" + encoded[20:]
+}
+
+// allowed 判断 value 是否在列表中，列表为空时允许所有值，以 /* 结尾的规则匹配同一类 MIME 类型
+func allowed(value string, list []string) bool {
+	if len(list) == 0 {
+		return true
+	}
+	for _, rule := range list {
+		rule = strings.ToLower(rule)
+		if rule == value || strings.HasSuffix(rule, "/*") && strings.HasPrefix(value, strings.TrimSuffix(rule, "*")) {
+			return true
+		}
+	}
+	return false
+}
+
+// uploadReader 在读取时统计文件大小以及请求的总大小，超过限制时返回错误
+type uploadReader struct {
+	reader io.Reader
+	size   int64
+	limit  int64
+	total  *int64
+	max    int64
+}
+
+func (this *uploadReader) Read(p []byte) (int, error) {
+	var n, err = this.reader.Read(p)
+	this.size += int64(n)
+	*this.total += int64(n)
+	if this.limit >= 0 && this.size > this.limit {
+		return n, FileTooLargeErr
+	}
+	if this.max > 0 && *this.total > this.max {
+		return n, UploadTooLargeErr
+	}
+	return n, err
+}
+
+// Upload 将 multipart/form-data 请求中的文件流式写入磁盘，不会把整个文件读入内存
+// 任意一个文件失败时会删除本次请求已经保存的文件
+func Upload(disk contracts.FileSystem, r *http.Request, opts UploadOptions) ([]UploadedFile, error) {
+	var reader, err = r.MultipartReader()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", MalformedUploadErr, err)
+	}
+	if opts.MaxFileSize == 0 {
+		opts.MaxFileSize = DefaultMaxUploadFileSize
+	}
+
+	var (
+		uploaded []UploadedFile
+		// created 本次请求新建的文件，按哈希命名的文件可能同时属于其他请求，不会被删除
+		created []string
+		total   int64
+	)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			var stored *UploadedFile
+			var isNew bool
+			if stored, isNew, err = upload(disk, part, &total, opts); stored != nil {
+				uploaded = append(uploaded, *stored)
+				if isNew {
+					created = append(created, stored.Path)
+				}
+			}
+			part.Close()
+		} else {
+			err = fmt.Errorf("%w: %v", MalformedUploadErr, err)
+		}
+		if err != nil {
+			for _, path := range created {
+				if deleteErr := disk.Delete(path); deleteErr != nil {
+					logs.WithError(deleteErr).WithField("disk", disk.Name()).WithField("path", path).Warn("filesystem.Upload: failed to delete uploaded file")
+				}
+			}
+			return nil, err
+		}
+	}
+
+	if len(uploaded) == 0 {
+		return nil, NoUploadedFilesErr
+	}
+	return uploaded, nil
+}
+
+// upload 保存一个表单字段，不需要保存的字段返回 nil，isNew 表示文件是否由本次上传独占创建，失败时可以删除
+func upload(disk contracts.FileSystem, part *multipart.Part, total *int64, opts UploadOptions) (stored *UploadedFile, isNew bool, err error) {
+	var counter = &uploadReader{reader: part, limit: opts.MaxFileSize, total: total, max: opts.MaxTotalSize}
+	if part.FileName() == "" || opts.Field != "" && part.FormName() != opts.Field {
+		// 普通字段同样计入请求的总大小
+		counter.limit = -1
+		_, err = io.Copy(io.Discard, counter)
+		return nil, false, err
+	}
+
+	var extension = strings.ToLower(pathpkg.Ext(part.FileName()))
+	if !allowed(extension, opts.AllowedExtensions) {
+		return nil, false, FileTypeNotAllowedErr
+	}
+
+	// 根据文件内容检测 MIME 类型，无法识别时使用扩展名对应的类型
+	var buffered = bufio.NewReaderSize(counter, 512)
+	head, err := buffered.Peek(512)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, false, err
+	}
+	var contentType, _, _ = mime.ParseMediaType(http.DetectContentType(head))
+	if byExtension := mime.TypeByExtension(extension); contentType == "application/octet-stream" && byExtension != "" {
+		contentType, _, _ = mime.ParseMediaType(byExtension)
+	}
+	if !allowed(contentType, opts.AllowedTypes) {
+		return nil, false, FileTypeNotAllowedErr
+	}
+
+	var (
+		hasher = sha256.New()
+		name   = newUuid()
+		path   = pathpkg.Join(opts.Directory, name+extension)
+		writes = append([]file.WriteOption{file.WithContentType(contentType)}, opts.WriteOptions...)
+	)
+	if opts.Naming == UploadNameHash {
+		// 写入完成后才能知道文件名，先写入临时文件
+		path = pathpkg.Join(opts.Directory, ".upload-"+name)
+	}
+	size, err := adapters.PutStream(disk, path, io.TeeReader(buffered, hasher), writes...)
+	if err != nil {
+		_ = disk.Delete(path)
+		return nil, false, err
+	}
+
+	stored = &UploadedFile{
+		Field:       part.FormName(),
+		Name:        part.FileName(),
+		Disk:        disk.Name(),
+		Path:        path,
+		Size:        size,
+		ContentType: contentType,
+		Hash:        hex.EncodeToString(hasher.Sum(nil)),
+	}
+	if opts.Naming != UploadNameHash {
+		return stored, true, nil
+	}
+
+	// 内容相同的文件已经存在时删除临时文件
+	stored.Path = pathpkg.Join(opts.Directory, stored.Hash+extension)
+	if disk.Exists(stored.Path) {
+		return stored, false, disk.Delete(path)
+	}
+	// Exists 与 Move 之间没有原子性，相同内容的并发上传可能都会走到这里，
+	// 文件可能已经被其他请求返回给客户端，因此不视为本次上传创建
+	if err = disk.Move(path, stored.Path); err != nil {
+		_ = disk.Delete(path)
+		if disk.Exists(stored.Path) {
+			return stored, false, nil
+		}
+		return nil, false, err
+	}
+	return stored, false, nil
+}
+
+// uploadStatus 获取上传错误对应的 HTTP 状态码
+func uploadStatus(err error) int {
+	switch {
+	case errors.Is(err, FileTooLargeErr), errors.Is(err, UploadTooLargeErr):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, FileTypeNotAllowedErr):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, NoUploadedFilesErr), errors.Is(err, MalformedUploadErr):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Upload 将请求中的文件保存到 opts.Disk 指定的磁盘
+func (this *Factory) Upload(r *http.Request, opts UploadOptions) ([]UploadedFile, error) {
+	return Upload(this.Disk(this.diskName(opts.Disk)), r, opts)
+}
+
+// UploadHandler 创建接收 multipart/form-data 上传的 http.Handler，只支持 POST
+// 成功时返回 201 以及 {"files": [...]}，失败时返回 {"error": "..."}，文件过大时状态码为 413，类型不允许时为 415
+func (this *Factory) UploadHandler(opts UploadOptions) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": http.StatusText(http.StatusMethodNotAllowed)})
+			return
+		}
+
+		var files, err = this.Upload(r, opts)
+		if err != nil {
+			var status, message = uploadStatus(err), err.Error()
+			if status == http.StatusInternalServerError {
+				// 不向客户端暴露磁盘的错误信息
+				logs.WithError(err).WithField("disk", this.diskName(opts.Disk)).Error("filesystem.UploadHandler: failed to store upload")
+				message = http.StatusText(status)
+			}
+			w.WriteHeader(status)
+			_ = json.NewEncoder(w).Encode(map[string]string{"error": message})
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string][]UploadedFile{"files": files})
+	})
+}
+
+// diskName 名称为空时使用默认磁盘
+func (this *Factory) diskName(name string) string {
+	if name == "" {
+		return this.config.Default
+	}
+	return name
+}